@@ -0,0 +1,240 @@
+package builtin
+
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Applying goals to lists, see http://www.swi-prolog.org/pldoc/man?section=apply
+
+// callGoal returns the goal 'call(G, Args...)'.
+func callGoal(g syntax.Term, args ...syntax.Term) syntax.Term {
+	return syntax.NewCompound("call", append([]syntax.Term{g}, args...)...)
+}
+
+// freshList returns a list of n unbound variables.
+func freshList(n int) syntax.Term {
+	vars := make([]syntax.Term, n)
+	for i := range vars {
+		vars[i] = syntax.NewVariable("_")
+	}
+	return syntax.NewList(vars)
+}
+
+// Maplist2 implements maplist(Goal, List), calling Goal with each element of
+// List. It fails if any call fails.
+var Maplist2 = newMaplist(2)
+
+// Maplist3 implements maplist(Goal, List1, List2), calling Goal with each pair
+// of corresponding elements.
+var Maplist3 = newMaplist(3)
+
+// Maplist4 implements maplist(Goal, List1, List2, List3), calling Goal with
+// the corresponding elements of all three lists.
+var Maplist4 = newMaplist(4)
+
+// knownLength returns the length of the first proper list of lists, or -1
+// if none of them are proper lists.
+func knownLength(lists []syntax.Term) int {
+	for _, l := range lists {
+		if terms, tail := partialList(l); tail == syntax.EmptyList {
+			return len(terms)
+		}
+	}
+	return -1
+}
+
+// unifyLengths unifies each of the lists with a list of n elements,
+// returning the ith element of each list, in order, as elems[i].
+func unifyLengths(lists []syntax.Term, n int) (elems [][]syntax.Term, ok bool) {
+	var fresh []syntax.Term
+	for range lists {
+		fresh = append(fresh, freshList(n))
+	}
+	t, m := syntax.NewCompound("$lists", lists...), syntax.NewCompound("$lists", fresh...)
+	if !unifies(t, m) {
+		return nil, false
+	}
+	t.Unify(m)
+
+	elems = make([][]syntax.Term, n)
+	for _, l := range lists {
+		terms, _ := partialList(l)
+		for i, t := range terms {
+			elems[i] = append(elems[i], t)
+		}
+	}
+	return elems, true
+}
+
+func newMaplist(nArgs int) syntax.Clause {
+	return &generator{
+		name:  "maplist",
+		nArgs: nArgs,
+		generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+			g, lists := args[0], args[1:]
+
+			// if the length of any of the lists is known, the others are
+			// constrained to it and the calls can be made in sequence
+			n := knownLength(lists)
+			if n < 0 {
+				return tryRules(args,
+					func() ([]syntax.Term, *syntax.Goal) {
+						head := []syntax.Term{g}
+						for range lists {
+							head = append(head, syntax.EmptyList)
+						}
+						return head, nil
+					},
+					func() ([]syntax.Term, *syntax.Goal) {
+						head, elems, rest := []syntax.Term{g}, []syntax.Term{}, []syntax.Term{g}
+						for range lists {
+							x, xs := syntax.NewVariable("X"), syntax.NewVariable("Xs")
+							head = append(head, cons(x, xs))
+							elems = append(elems, x)
+							rest = append(rest, xs)
+						}
+						return head, syntax.NewGoal(
+							callGoal(g, elems...),
+							syntax.NewCompound("maplist", rest...),
+						)
+					},
+				)
+			}
+
+			done := false
+			return func() (*syntax.Goal, bool, error) {
+				if done {
+					return nil, false, nil
+				}
+				done = true
+				elems, ok := unifyLengths(lists, n)
+				if !ok {
+					return nil, false, nil
+				}
+				calls := make([]syntax.Term, n)
+				for i := range calls {
+					calls[i] = callGoal(g, elems[i]...)
+				}
+				return syntax.GoalFromSlice(calls), true, nil
+			}
+		},
+	}
+}
+
+// Foldl4 implements foldl(Goal, List, V0, V), a left fold of List. Goal is
+// called as call(Goal, Elem, Acc0, Acc) for each element, where the first
+// Acc0 is V0 and the last Acc is V.
+var Foldl4 = newFoldl(4)
+
+// Foldl5 implements foldl(Goal, List1, List2, V0, V), folding the
+// corresponding elements of two lists.
+var Foldl5 = newFoldl(5)
+
+// Foldl6 implements foldl(Goal, List1, List2, List3, V0, V), folding the
+// corresponding elements of three lists.
+var Foldl6 = newFoldl(6)
+
+func newFoldl(nArgs int) syntax.Clause {
+	return &generator{
+		name:  "foldl",
+		nArgs: nArgs,
+		generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+			g, lists, v0, v := args[0], args[1:nArgs-2], args[nArgs-2], args[nArgs-1]
+
+			n := knownLength(lists)
+			if n < 0 {
+				return tryRules(args,
+					func() ([]syntax.Term, *syntax.Goal) {
+						head := []syntax.Term{g}
+						for range lists {
+							head = append(head, syntax.EmptyList)
+						}
+						return append(head, v0, v0), nil
+					},
+					func() ([]syntax.Term, *syntax.Goal) {
+						head, elems, rest := []syntax.Term{g}, []syntax.Term{}, []syntax.Term{g}
+						for range lists {
+							x, xs := syntax.NewVariable("X"), syntax.NewVariable("Xs")
+							head = append(head, cons(x, xs))
+							elems = append(elems, x)
+							rest = append(rest, xs)
+						}
+						v1 := syntax.NewVariable("V1")
+						return append(head, v0, v), syntax.NewGoal(
+							callGoal(g, append(elems, v0, v1)...),
+							syntax.NewCompound("foldl", append(rest, v1, v)...),
+						)
+					},
+				)
+			}
+
+			done := false
+			return func() (*syntax.Goal, bool, error) {
+				if done {
+					return nil, false, nil
+				}
+				done = true
+				elems, ok := unifyLengths(lists, n)
+				if !ok {
+					return nil, false, nil
+				}
+				if n == 0 {
+					return nil, v.Unify(v0), nil
+				}
+				calls := make([]syntax.Term, n)
+				acc := v0
+				for i := range calls {
+					next := v
+					if i < n-1 {
+						next = syntax.NewVariable("V")
+					}
+					calls[i] = callGoal(g, append(elems[i], acc, next)...)
+					acc = next
+				}
+				return syntax.GoalFromSlice(calls), true, nil
+			}
+		},
+	}
+}
+
+// succeeds reports whether a goal has a solution. The goal is evaluated on a
+// copy, so no bindings are made.
+func succeeds(p *syntax.Prog, goal syntax.Term) (bool, error) {
+	r := p.Query(toGoal(syntax.Copy(goal)))
+	defer r.Close()
+	if r.Next() {
+		return true, nil
+	}
+	return false, r.Err()
+}
+
+func newFilter(name string, keep bool) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 3,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			terms, err := syntax.ListToSlice(args[1])
+			if err != nil {
+				return nil, false, err
+			}
+			var filtered []syntax.Term
+			for _, t := range terms {
+				ok, err := succeeds(p, callGoal(args[0], t))
+				if err != nil {
+					return nil, false, err
+				}
+				if ok == keep {
+					filtered = append(filtered, t)
+				}
+			}
+			return nil, args[2].Unify(syntax.NewList(filtered)), nil
+		},
+	}
+}
+
+// Include3 implements include(Goal, List, Included), where Included holds the
+// elements of List for which call(Goal, Elem) succeeds. Bindings made by Goal
+// aren't kept.
+var Include3 = newFilter("include", true)
+
+// Exclude3 implements exclude(Goal, List, Excluded), where Excluded holds the
+// elements of List for which call(Goal, Elem) fails.
+var Exclude3 = newFilter("exclude", false)
@@ -0,0 +1,121 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestMaplist(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		double(X, Y) :- Y is X * 2.
+		add(X, Y, Z) :- Z is X + Y.
+	`)
+	maplist := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("maplist", args...) }
+	integer, succ := syntax.Atom("integer"), syntax.Atom("succ")
+
+	tests := []struct {
+		goal syntax.Term
+		exp  int
+	}{
+		{maplist(integer, ints(1, 2, 3)), 1},
+		{maplist(integer, list(syntax.Integer(1), syntax.Atom("a"), syntax.Integer(3))), 0},
+		{maplist(integer, syntax.EmptyList), 1},
+		{maplist(succ, ints(1, 2), ints(2, 3)), 1},
+		{maplist(succ, ints(1, 2), ints(2, 4)), 0},
+		{maplist(succ, ints(1, 2), ints(2)), 0},
+	}
+	for _, test := range tests {
+		if n := countSolutions(t, syntax.NewGoal(test.goal)); n != test.exp {
+			t.Errorf("%s: expected %d solutions, got %d", test.goal, test.exp, n)
+		}
+	}
+
+	ys := syntax.NewVariable("Ys")
+	testSolutions(t, p, ys, goal(maplist(succ, ints(1, 2, 3), ys)), ints(2, 3, 4))
+	xs := syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(maplist(succ, xs, ints(2, 3, 4))), ints(1, 2, 3))
+	ys = syntax.NewVariable("Ys")
+	testSolutions(t, p, ys, goal(maplist(syntax.Atom("double"), ints(1, 2, 3), ys)), ints(2, 4, 6))
+	ys = syntax.NewVariable("Ys")
+	testSolutions(t, p, ys, goal(maplist(syntax.NewCompound("add", syntax.Integer(10)), ints(1, 2), ys)), ints(11, 12))
+	zs := syntax.NewVariable("Zs")
+	testSolutions(t, p, zs, goal(maplist(syntax.Atom("add"), ints(1, 2), ints(10, 20), zs)), ints(11, 22))
+
+	// lists of unknown length are enumerated
+	xs, n := syntax.NewVariable("Xs"), syntax.NewVariable("N")
+	testSolutions(t, p, n, goal(
+		maplist(syntax.NewCompound("=", syntax.Atom("a")), xs),
+		syntax.NewCompound("length", xs, n),
+		syntax.NewCompound(">=", n, syntax.Integer(2)),
+		syntax.Cut,
+	), syntax.Integer(2))
+}
+
+func TestIncludeExclude(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		small(X) :- X < 3.
+	`)
+	mixed := list(syntax.Integer(1), syntax.Atom("a"), syntax.Integer(2), syntax.Atom("b"))
+
+	xs := syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("include", syntax.Atom("integer"), mixed, xs)), ints(1, 2))
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("exclude", syntax.Atom("atom"), mixed, xs)), ints(1, 2))
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("include", syntax.Atom("small"), ints(1, 5, 2, 4), xs)), ints(1, 2))
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("exclude", syntax.Atom("small"), ints(1, 5, 2, 4), xs)), ints(5, 4))
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("include", syntax.Atom("fail"), ints(1, 2), xs)), syntax.EmptyList)
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("include", syntax.NewCompound(">", syntax.Integer(2)), ints(1, 2, 3), xs)), ints(1))
+
+	for _, g := range []syntax.Term{
+		syntax.NewCompound("include", syntax.Atom("integer"), syntax.NewVariable("L"), syntax.NewVariable("V")),
+		syntax.NewCompound("include", syntax.Integer(1), ints(1), syntax.NewVariable("V")),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
+
+func TestFoldl(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		sum(E, A0, A) :- A is A0 + E.
+		dot(X, Y, A0, A) :- A is A0 + X * Y.
+		sum3(X, Y, Z, A0, A) :- A is A0 + X + Y + Z.
+		push(E, L, [E|L]).
+	`)
+	foldl := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("foldl", args...) }
+	sum := syntax.Atom("sum")
+
+	v := syntax.NewVariable("V")
+	testSolutions(t, p, v, goal(foldl(sum, ints(1, 2, 3), syntax.Integer(0), v)), syntax.Integer(6))
+	v = syntax.NewVariable("V")
+	testSolutions(t, p, v, goal(foldl(sum, syntax.EmptyList, syntax.Integer(0), v)), syntax.Integer(0))
+	v = syntax.NewVariable("V")
+	testSolutions(t, p, v, goal(foldl(sum, ints(5), syntax.Integer(1), v)), syntax.Integer(6))
+	v = syntax.NewVariable("V")
+	testSolutions(t, p, v, goal(foldl(syntax.Atom("push"), ints(1, 2, 3), syntax.EmptyList, v)), ints(3, 2, 1))
+	v = syntax.NewVariable("V")
+	testSolutions(t, p, v, goal(foldl(syntax.Atom("dot"), ints(1, 2, 3), ints(4, 5, 6), syntax.Integer(0), v)), syntax.Integer(32))
+	v = syntax.NewVariable("V")
+	testSolutions(t, p, v, goal(foldl(syntax.Atom("sum3"), ints(1, 2), ints(3, 4), ints(5, 6), syntax.Integer(0), v)), syntax.Integer(21))
+	v = syntax.NewVariable("V")
+	testSolutions(t, p, v, goal(foldl(syntax.Atom("dot"), ints(1, 2), ints(4), syntax.Integer(0), v)))
+
+	// lists of unknown length are enumerated
+	l, n := syntax.NewVariable("L"), syntax.NewVariable("N")
+	v = syntax.NewVariable("V")
+	testSolutions(t, p, n, goal(
+		foldl(syntax.Atom("push"), l, syntax.EmptyList, v),
+		syntax.NewCompound("length", v, syntax.Integer(2)),
+		syntax.NewCompound("length", l, n),
+		syntax.Cut,
+	), syntax.Integer(2))
+}
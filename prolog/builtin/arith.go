@@ -0,0 +1,464 @@
+package builtin
+
+import (
+	"math"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Arithmetic, see http://www.swi-prolog.org/pldoc/man?section=arith
+
+// EvalArith evaluates an arithmetic expression, returning either an Integer or
+// a Float64. Operations on two integers produce an integer, wrapping on
+// overflow, while operations involving a float produce a float.
+//
+// Supported functions are +/2, -/2, */2, //2, ///2, mod/2, **/2, -/1, +/1,
+// abs/1, max/2, min/2, sqrt/1, sin/1, cos/1, tan/1, exp/1, log/1, float/1,
+// integer/1, truncate/1, round/1, ceiling/1 and floor/1.
+func EvalArith(t syntax.Term) (syntax.Term, error) {
+	switch t := deref(t).(type) {
+	case syntax.Integer, syntax.Float64:
+		return t, nil
+	case *syntax.Variable:
+		return nil, instantiationErr()
+	case syntax.Atom:
+		return nil, typeErr("evaluable", indicator(t, 0))
+	case *syntax.Compound:
+		args := t.Args()
+		vals := make([]syntax.Term, len(args))
+		for i, arg := range args {
+			val, err := EvalArith(arg)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		switch len(vals) {
+		case 1:
+			if fn, ok := unaryFuncs[t.Functor()]; ok {
+				return fn(t, vals[0])
+			}
+		case 2:
+			if fn, ok := binaryFuncs[t.Functor()]; ok {
+				return fn(t, vals[0], vals[1])
+			}
+		}
+		return nil, typeErr("evaluable", indicator(t.Functor(), len(args)))
+	default:
+		return nil, typeErr("evaluable", t)
+	}
+}
+
+// indicator returns the predicate indicator 'Name/Arity'.
+func indicator(name syntax.Atom, arity int) syntax.Term {
+	return syntax.NewCompound("/", name, syntax.Integer(arity))
+}
+
+// toFloat converts an evaluated number to a float.
+func toFloat(t syntax.Term) float64 {
+	if i, ok := t.(syntax.Integer); ok {
+		return float64(i)
+	}
+	return float64(t.(syntax.Float64))
+}
+
+// toInts returns the values of two evaluated numbers if both are integers.
+func toInts(a, b syntax.Term) (x, y syntax.Integer, ok bool) {
+	x, okX := a.(syntax.Integer)
+	y, okY := b.(syntax.Integer)
+	return x, y, okX && okY
+}
+
+// mustInt returns the value of an evaluated number, returning a type error if
+// it's not an integer.
+func mustInt(t syntax.Term) (syntax.Integer, error) {
+	i, ok := t.(syntax.Integer)
+	if !ok {
+		return 0, typeErr("integer", t)
+	}
+	return i, nil
+}
+
+// checkFloat returns an evaluation error if f isn't a finite number:
+// float_overflow if it's infinite, or undefined if it's NaN.
+func checkFloat(expr syntax.Term, f float64) (syntax.Term, error) {
+	if math.IsInf(f, 0) {
+		return nil, evaluationErr("float_overflow")
+	}
+	if math.IsNaN(f) {
+		return nil, evaluationErr("undefined")
+	}
+	return syntax.Float64(f), nil
+}
+
+type unaryFunc func(expr, x syntax.Term) (syntax.Term, error)
+
+type binaryFunc func(expr, x, y syntax.Term) (syntax.Term, error)
+
+// floatFunc creates a function of one argument which always produces a float.
+func floatFunc(fn func(float64) float64) unaryFunc {
+	return func(expr, x syntax.Term) (syntax.Term, error) {
+		return checkFloat(expr, fn(toFloat(x)))
+	}
+}
+
+// ln returns the natural logarithm of f, which is undefined rather than -Inf
+// for 0.
+func ln(f float64) float64 {
+	if f == 0 {
+		return math.NaN()
+	}
+	return math.Log(f)
+}
+
+// roundFunc creates a function which rounds its argument to an integer.
+func roundFunc(fn func(float64) float64) unaryFunc {
+	return func(expr, x syntax.Term) (syntax.Term, error) {
+		if i, ok := x.(syntax.Integer); ok {
+			return i, nil
+		}
+		f := fn(toFloat(x))
+		if math.IsNaN(f) {
+			return nil, evaluationErr("undefined")
+		}
+		// -math.MinInt is the smallest float greater than every integer
+		if f < math.MinInt || f >= -math.MinInt {
+			return nil, evaluationErr("int_overflow")
+		}
+		return syntax.Integer(f), nil
+	}
+}
+
+var unaryFuncs = map[syntax.Atom]unaryFunc{
+	"-": func(expr, x syntax.Term) (syntax.Term, error) {
+		if i, ok := x.(syntax.Integer); ok {
+			return -i, nil
+		}
+		return -x.(syntax.Float64), nil
+	},
+	"+": func(expr, x syntax.Term) (syntax.Term, error) { return x, nil },
+	"abs": func(expr, x syntax.Term) (syntax.Term, error) {
+		if i, ok := x.(syntax.Integer); ok {
+			if i < 0 {
+				return -i, nil
+			}
+			return i, nil
+		}
+		return syntax.Float64(math.Abs(toFloat(x))), nil
+	},
+	"sqrt":  floatFunc(math.Sqrt),
+	"sin":   floatFunc(math.Sin),
+	"cos":   floatFunc(math.Cos),
+	"tan":   floatFunc(math.Tan),
+	"exp":   floatFunc(math.Exp),
+	"log":   floatFunc(ln),
+	"float": floatFunc(func(f float64) float64 { return f }),
+
+	"integer":  roundFunc(math.Round),
+	"truncate": roundFunc(math.Trunc),
+	"round":    roundFunc(math.Round),
+	"ceiling":  roundFunc(math.Ceil),
+	"floor":    roundFunc(math.Floor),
+}
+
+var binaryFuncs = map[syntax.Atom]binaryFunc{
+	"+": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		if a, b, ok := toInts(x, y); ok {
+			return a + b, nil
+		}
+		return checkFloat(expr, toFloat(x)+toFloat(y))
+	},
+	"-": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		if a, b, ok := toInts(x, y); ok {
+			return a - b, nil
+		}
+		return checkFloat(expr, toFloat(x)-toFloat(y))
+	},
+	"*": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		if a, b, ok := toInts(x, y); ok {
+			return a * b, nil
+		}
+		return checkFloat(expr, toFloat(x)*toFloat(y))
+	},
+	// '/' produces an integer if both arguments are integers and the
+	// division is exact, otherwise a float.
+	"/": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		if a, b, ok := toInts(x, y); ok {
+			if b == 0 {
+				return nil, evaluationErr("zero_divisor")
+			}
+			if a%b == 0 {
+				return a / b, nil
+			}
+		}
+		if toFloat(y) == 0 {
+			return nil, evaluationErr("zero_divisor")
+		}
+		return checkFloat(expr, toFloat(x)/toFloat(y))
+	},
+	// '//' is integer division, truncating towards zero.
+	"//": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		a, err := mustInt(x)
+		if err != nil {
+			return nil, err
+		}
+		b, err := mustInt(y)
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return nil, evaluationErr("zero_divisor")
+		}
+		return a / b, nil
+	},
+	// mod takes the sign of the divisor.
+	"mod": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		a, err := mustInt(x)
+		if err != nil {
+			return nil, err
+		}
+		b, err := mustInt(y)
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return nil, evaluationErr("zero_divisor")
+		}
+		m := a % b
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		return m, nil
+	},
+	// '**' produces an integer for integer arguments with a non-negative
+	// exponent.
+	"**": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		if a, b, ok := toInts(x, y); ok && b >= 0 {
+			r := syntax.Integer(1)
+			for ; b > 0; b >>= 1 {
+				if b&1 == 1 {
+					r *= a
+				}
+				a *= a
+			}
+			return r, nil
+		}
+		if toFloat(x) == 0 && toFloat(y) < 0 {
+			return nil, evaluationErr("undefined")
+		}
+		return checkFloat(expr, math.Pow(toFloat(x), toFloat(y)))
+	},
+	"max": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		if compareNum(x, y) < 0 {
+			return y, nil
+		}
+		return x, nil
+	},
+	"min": func(expr, x, y syntax.Term) (syntax.Term, error) {
+		if compareNum(x, y) > 0 {
+			return y, nil
+		}
+		return x, nil
+	},
+}
+
+// compareNum compares two evaluated numbers by value, returning -1, 0 or 1.
+func compareNum(x, y syntax.Term) int {
+	if a, b, ok := toInts(x, y); ok {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	a, b := toFloat(x), toFloat(y)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Arithmetic comparison, which evaluate both arguments and compare the results
+// by value.
+var (
+	ArithEq2  = newArithCompare("=:=", func(c int) bool { return c == 0 })
+	ArithNeq2 = newArithCompare("=\\=", func(c int) bool { return c != 0 })
+	ArithLt2  = newArithCompare("<", func(c int) bool { return c < 0 })
+	ArithGt2  = newArithCompare(">", func(c int) bool { return c > 0 })
+	ArithLe2  = newArithCompare("=<", func(c int) bool { return c <= 0 })
+	ArithGe2  = newArithCompare(">=", func(c int) bool { return c >= 0 })
+)
+
+func newArithCompare(name string, cmp func(c int) bool) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 2,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			x, err := EvalArith(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			y, err := EvalArith(args[1])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, cmp(compareNum(x, y)), nil
+		},
+	}
+}
+
+// intArg returns the value of an integer argument, reporting false if the
+// argument is unbound.
+func intArg(t syntax.Term) (syntax.Integer, bool, error) {
+	switch n := deref(t).(type) {
+	case *syntax.Variable:
+		return 0, false, nil
+	case syntax.Integer:
+		return n, true, nil
+	default:
+		return 0, false, typeErr("integer", t)
+	}
+}
+
+// newSucc returns a builtin implementing succ/2 or a variant of it, where
+// pred returns the predecessor of a non-negative integer, false if it has
+// none.
+func newSucc(name string, pred func(y syntax.Integer) (syntax.Integer, bool)) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 2,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			x, xOk, err := intArg(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			y, yOk, err := intArg(args[1])
+			if err != nil {
+				return nil, false, err
+			}
+			if xOk && x < 0 {
+				return nil, false, typeErr("not_less_than_zero", args[0])
+			}
+			if yOk && y < 0 {
+				return nil, false, typeErr("not_less_than_zero", args[1])
+			}
+			switch {
+			case yOk:
+				x, ok := pred(y)
+				if !ok {
+					return nil, false, nil
+				}
+				return nil, args[0].Unify(x), nil
+			case xOk:
+				return nil, args[1].Unify(x + 1), nil
+			}
+			return nil, false, instantiationErr()
+		},
+	}
+}
+
+// Succ2 implements succ(X, Y), which holds if Y is X + 1 and both are
+// non-negative integers. Either argument may be unbound. succ(X, 0) fails,
+// and negative integers raise a type error.
+var Succ2 = newSucc("succ", func(y syntax.Integer) (syntax.Integer, bool) {
+	return y - 1, y > 0
+})
+
+// SuccOrZero2 implements succ_or_zero(X, Y). Like succ/2, but the
+// predecessor of 0 is 0, so succ_or_zero(X, 0) gives X = 0.
+var SuccOrZero2 = newSucc("succ_or_zero", func(y syntax.Integer) (syntax.Integer, bool) {
+	if y == 0 {
+		return 0, true
+	}
+	return y - 1, true
+})
+
+// Plus3 implements plus(X, Y, Z), which holds if Z is X + Y. Any one of the
+// integer arguments may be unbound.
+var Plus3 syntax.Clause = &builtin{
+	name:  "plus",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		var (
+			n     [3]syntax.Integer
+			bound [3]bool
+		)
+		for i, arg := range args {
+			var err error
+			if n[i], bound[i], err = intArg(arg); err != nil {
+				return nil, false, err
+			}
+		}
+		switch {
+		case bound[0] && bound[1]:
+			return nil, args[2].Unify(n[0] + n[1]), nil
+		case bound[0] && bound[2]:
+			return nil, args[1].Unify(n[2] - n[0]), nil
+		case bound[1] && bound[2]:
+			return nil, args[0].Unify(n[2] - n[1]), nil
+		}
+		// at least two of the arguments are unbound
+		return nil, false, instantiationErr()
+	},
+}
+
+// Between3 implements between(Low, High, X), which holds if X is an integer
+// from Low to High inclusive. If X is unbound, between backtracks over each
+// integer of the range. High may be the atom 'inf' for an unbounded range.
+var Between3 syntax.Clause = &generator{
+	name:  "between",
+	nArgs: 3,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		low, high, err := betweenArgs(args)
+		x, xOk := syntax.Integer(0), false
+		if err == nil {
+			x, xOk, err = intArg(args[2])
+		}
+		done := false
+		return func() (*syntax.Goal, bool, error) {
+			switch {
+			case err != nil:
+				return nil, false, err
+			case done:
+				return nil, false, nil
+			case xOk:
+				done = true
+				return nil, low <= x && x <= high, nil
+			case low > high:
+				return nil, false, nil
+			}
+			n := low
+			if low == high {
+				done = true
+			} else {
+				low++
+			}
+			return nil, args[2].Unify(n), nil
+		}
+	},
+}
+
+// betweenArgs returns the range of between/3.
+func betweenArgs(args []syntax.Term) (low, high syntax.Integer, err error) {
+	low, ok, err := intArg(args[0])
+	if err == nil && !ok {
+		err = instantiationErr()
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	switch deref(args[1]) {
+	case syntax.Atom("inf"), syntax.Atom("infinite"):
+		return low, math.MaxInt, nil
+	}
+	high, ok, err = intArg(args[1])
+	if err == nil && !ok {
+		err = instantiationErr()
+	}
+	return low, high, err
+}
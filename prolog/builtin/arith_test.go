@@ -0,0 +1,317 @@
+package builtin
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestEvalArith(t *testing.T) {
+	i := func(n int) syntax.Term { return syntax.Integer(n) }
+	f := func(n float64) syntax.Term { return syntax.Float64(n) }
+	fn := func(name string, args ...syntax.Term) syntax.Term {
+		return syntax.NewCompound(syntax.Atom(name), args...)
+	}
+
+	tests := []struct {
+		expr syntax.Term
+		exp  syntax.Term
+	}{
+		{i(1), i(1)},
+		{f(1.5), f(1.5)},
+		{bound("X", i(2)), i(2)},
+		{fn("+", i(1), i(2)), i(3)},
+		{fn("+", i(1), f(2)), f(3)},
+		{fn("-", i(1), i(2)), i(-1)},
+		{fn("-", f(1.5), i(2)), f(-0.5)},
+		{fn("*", i(3), i(4)), i(12)},
+		{fn("*", i(3), f(0.5)), f(1.5)},
+		{fn("/", i(6), i(3)), i(2)},
+		{fn("/", i(7), i(2)), f(3.5)},
+		{fn("/", f(7), i(2)), f(3.5)},
+		{fn("//", i(7), i(2)), i(3)},
+		{fn("//", i(-7), i(2)), i(-3)},
+		{fn("mod", i(7), i(2)), i(1)},
+		{fn("mod", i(-7), i(2)), i(1)},
+		{fn("mod", i(7), i(-2)), i(-1)},
+		{fn("**", i(2), i(10)), i(1024)},
+		{fn("**", i(2), i(-1)), f(0.5)},
+		{fn("**", f(2), i(2)), f(4)},
+		{fn("-", i(3)), i(-3)},
+		{fn("-", f(3.5)), f(-3.5)},
+		{fn("+", i(3)), i(3)},
+		{fn("abs", i(-3)), i(3)},
+		{fn("abs", f(-3.5)), f(3.5)},
+		{fn("max", i(1), i(2)), i(2)},
+		{fn("max", i(3), f(2.5)), i(3)},
+		{fn("min", i(1), i(2)), i(1)},
+		{fn("min", i(3), f(2.5)), f(2.5)},
+		{fn("sqrt", i(16)), f(4)},
+		{fn("sin", i(0)), f(0)},
+		{fn("cos", i(0)), f(1)},
+		{fn("tan", i(0)), f(0)},
+		{fn("exp", i(0)), f(1)},
+		{fn("log", i(1)), f(0)},
+		{fn("float", i(2)), f(2)},
+		{fn("integer", f(2.5)), i(3)},
+		{fn("integer", i(2)), i(2)},
+		{fn("truncate", f(-2.5)), i(-2)},
+		{fn("round", f(2.4)), i(2)},
+		{fn("ceiling", f(2.1)), i(3)},
+		{fn("floor", f(-2.1)), i(-3)},
+		{fn("+", fn("*", i(2), i(3)), fn("-", i(1))), i(5)},
+		// integer overflow wraps
+		{fn("+", i(math.MaxInt64), i(1)), i(math.MinInt64)},
+	}
+	for _, test := range tests {
+		got, err := EvalArith(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got != test.exp {
+			t.Errorf("%s: expected %s (%T) got %s (%T)", test.expr, test.exp, test.exp, got, got)
+		}
+	}
+
+	errs := []syntax.Term{
+		syntax.NewVariable("X"),
+		syntax.Atom("foo"),
+		fn("foo", i(1)),
+		fn("+", i(1), syntax.Atom("a")),
+		fn("+", i(1), syntax.NewVariable("X")),
+		fn("/", i(1), i(0)),
+		fn("/", f(1), f(0)),
+		fn("//", i(1), i(0)),
+		fn("//", f(1), i(2)),
+		fn("mod", i(1), i(0)),
+		fn("mod", f(1), i(2)),
+		fn("sqrt", i(-1)),
+		fn("log", i(0)),
+	}
+	for _, expr := range errs {
+		if got, err := EvalArith(expr); err == nil {
+			t.Errorf("%s: expected error, got %s", expr, got)
+		}
+	}
+}
+
+func TestEvalArithEvaluationErrors(t *testing.T) {
+	f := func(n float64) syntax.Term { return syntax.Float64(n) }
+	fn := func(name string, args ...syntax.Term) syntax.Term {
+		return syntax.NewCompound(syntax.Atom(name), args...)
+	}
+
+	tests := []struct {
+		expr  syntax.Term
+		cause string
+	}{
+		{fn("truncate", f(1.0e30)), "int_overflow"},
+		{fn("round", f(-1.0e30)), "int_overflow"},
+		{fn("ceiling", f(9.223372036854775807e18)), "int_overflow"},
+		{fn("floor", fn("/", f(1), f(0))), "zero_divisor"},
+		{fn("exp", f(1000)), "float_overflow"},
+		{fn("*", f(1.0e200), f(1.0e200)), "float_overflow"},
+		{fn("-", f(-1.0e308), f(1.0e308)), "float_overflow"},
+		{fn("**", f(10), f(400)), "float_overflow"},
+		{fn("sqrt", f(-1)), "undefined"},
+		{fn("log", f(0)), "undefined"},
+		{fn("**", f(0), f(-1)), "undefined"},
+	}
+	for _, test := range tests {
+		_, err := EvalArith(test.expr)
+		exp := syntax.EvaluationErrorTerm(test.cause)
+		if e, ok := err.(*syntax.PrologError); !ok || !variant(e.Term, exp) {
+			t.Errorf("%s: expected %s got %v", test.expr, exp, err)
+		}
+	}
+	if got, err := EvalArith(fn("truncate", f(-9.223372036854775808e18))); err != nil || got != syntax.Integer(math.MinInt64) {
+		t.Errorf("truncate(-2**63): expected %d got %v %v", math.MinInt64, got, err)
+	}
+}
+
+func TestIs(t *testing.T) {
+	x := syntax.NewVariable("X")
+	expr := syntax.NewCompound("+", syntax.Integer(1), syntax.Integer(2))
+	all, err := DefaultProg().Query(syntax.NewGoal(syntax.NewCompound("is", x, expr))).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0][x] != syntax.Integer(3) {
+		t.Errorf("X is 1 + 2: expected X = 3, got %v", all)
+	}
+
+	testCalls(t, Is2, []callTest{
+		{args: args(syntax.Integer(3), expr), matches: true},
+		{args: args(syntax.Integer(4), expr), matches: false},
+		{args: args(syntax.NewVariable("X"), syntax.Atom("foo")), err: true},
+	})
+
+	r := DefaultProg().Query(syntax.NewGoal(syntax.NewCompound("is", x, syntax.NewVariable("Y"))))
+	if r.Next() || r.Err() == nil {
+		t.Errorf("expected instantiation error")
+	}
+}
+
+func TestArithCompare(t *testing.T) {
+	i := func(n int) syntax.Term { return syntax.Integer(n) }
+	f := func(n float64) syntax.Term { return syntax.Float64(n) }
+	plus := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("+", a, b) }
+
+	tests := []struct {
+		a, b        syntax.Term
+		eq, lt, gt  bool
+		neq, le, ge bool
+	}{
+		{a: i(1), b: i(1), eq: true, le: true, ge: true},
+		{a: i(1), b: i(2), lt: true, neq: true, le: true},
+		{a: i(2), b: i(1), gt: true, neq: true, ge: true},
+		{a: i(1), b: f(1), eq: true, le: true, ge: true},
+		{a: f(1.5), b: i(1), gt: true, neq: true, ge: true},
+		{a: plus(i(1), i(2)), b: i(3), eq: true, le: true, ge: true},
+		{a: plus(i(1), f(0.5)), b: plus(i(1), i(1)), lt: true, neq: true, le: true},
+	}
+	for _, test := range tests {
+		for _, c := range []struct {
+			clause syntax.Clause
+			exp    bool
+		}{
+			{ArithEq2, test.eq}, {ArithNeq2, test.neq},
+			{ArithLt2, test.lt}, {ArithGt2, test.gt},
+			{ArithLe2, test.le}, {ArithGe2, test.ge},
+		} {
+			testCalls(t, c.clause, []callTest{{args: args(test.a, test.b), matches: c.exp}})
+		}
+	}
+
+	// =:= compares by value, while == compares structure
+	testCalls(t, ArithEq2, []callTest{{args: args(i(1), f(1)), matches: true}})
+	testCalls(t, Equal2, []callTest{{args: args(i(1), f(1)), matches: false}})
+
+	// errors are reported through the results
+	for _, clause := range []syntax.Clause{ArithEq2, ArithNeq2, ArithLt2, ArithGt2, ArithLe2, ArithGe2} {
+		name, _ := clause.Signature()
+		for _, goal := range []syntax.Term{
+			syntax.NewCompound(name, i(1), syntax.Atom("foo")),
+			syntax.NewCompound(name, syntax.NewVariable("X"), i(1)),
+		} {
+			r := DefaultProg().Query(syntax.NewGoal(goal))
+			if r.Next() {
+				t.Errorf("%s: expected no solutions", goal)
+			}
+			if r.Err() == nil {
+				t.Errorf("%s: expected error", goal)
+			}
+		}
+	}
+}
+
+func TestSucc(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("succ", syntax.Integer(3), x)), syntax.Integer(4))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("succ", syntax.Integer(0), x)), syntax.Integer(1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("succ", x, syntax.Integer(4))), syntax.Integer(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("succ", x, syntax.Integer(1))), syntax.Integer(0))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("succ", x, syntax.Integer(0))))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Succ2, []callTest{
+		{args: args(syntax.Integer(0), syntax.Integer(1)), matches: true},
+		{args: args(syntax.Integer(1), syntax.Integer(1)), matches: false},
+		{args: args(syntax.Integer(0), syntax.Integer(0)), matches: false},
+		{args: args(v(), v()), err: true},
+		{args: args(syntax.Integer(-1), v()), err: true},
+		{args: args(v(), syntax.Integer(-1)), err: true},
+		{args: args(syntax.Atom("a"), v()), err: true},
+		{args: args(v(), syntax.Atom("a")), err: true},
+		{args: args(syntax.Float64(1), v()), err: true},
+	})
+
+	// negative integers are type errors, not domain errors
+	_, _, err := Succ2.Call(syntax.NewProg(), args(syntax.Integer(-1), v()))
+	exp := syntax.TypeErrorTerm("not_less_than_zero", syntax.Integer(-1))
+	if e, ok := err.(*syntax.PrologError); !ok || !variant(e.Term, exp) {
+		t.Errorf("succ(-1, V): expected %s got %v", exp, err)
+	}
+}
+
+func TestSuccOrZero(t *testing.T) {
+	p := DefaultProg()
+	succ := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("succ_or_zero", a, b) }
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(succ(syntax.Integer(0), x)), syntax.Integer(1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(succ(x, syntax.Integer(4))), syntax.Integer(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(succ(x, syntax.Integer(1))), syntax.Integer(0))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(succ(x, syntax.Integer(0))), syntax.Integer(0))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, SuccOrZero2, []callTest{
+		{args: args(syntax.Integer(2), syntax.Integer(3)), matches: true},
+		{args: args(syntax.Integer(0), syntax.Integer(0)), matches: true},
+		{args: args(syntax.Integer(1), syntax.Integer(1)), matches: false},
+		{args: args(v(), v()), err: true},
+		{args: args(syntax.Integer(-1), v()), err: true},
+		{args: args(v(), syntax.Integer(-1)), err: true},
+		{args: args(syntax.Float64(1), v()), err: true},
+	})
+}
+
+func TestPlus(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("plus", syntax.Integer(1), syntax.Integer(2), x)), syntax.Integer(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("plus", syntax.Integer(1), x, syntax.Integer(5))), syntax.Integer(4))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("plus", x, syntax.Integer(2), syntax.Integer(5))), syntax.Integer(3))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Plus3, []callTest{
+		{args: args(syntax.Integer(1), syntax.Integer(2), syntax.Integer(3)), matches: true},
+		{args: args(syntax.Integer(1), syntax.Integer(2), syntax.Integer(4)), matches: false},
+		{args: args(syntax.Integer(1), v(), v()), err: true},
+		{args: args(v(), v(), v()), err: true},
+		{args: args(syntax.Integer(1), syntax.Atom("a"), v()), err: true},
+	})
+}
+
+func TestBetween(t *testing.T) {
+	p := DefaultProg()
+	between := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("between", args...) }
+	i := func(n int) syntax.Term { return syntax.Integer(n) }
+
+	x, xs := syntax.NewVariable("X"), syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("findall", x, between(i(1), i(5), x), xs)),
+		ints(1, 2, 3, 4, 5))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(between(i(-1), i(1), x)), i(-1), i(0), i(1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(between(i(3), i(3), x)), i(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(between(i(5), i(3), x)))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(between(i(1), syntax.Atom("inf"), x), syntax.NewCompound(">=", x, i(3)), syntax.Cut), i(3))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Between3, []callTest{
+		{args: args(i(1), i(3), i(2)), matches: true},
+		{args: args(i(1), i(3), i(1)), matches: true},
+		{args: args(i(1), i(3), i(3)), matches: true},
+		{args: args(i(1), i(3), i(4)), matches: false},
+		{args: args(i(1), syntax.Atom("inf"), i(1000)), matches: true},
+		{args: args(v(), i(3), v()), err: true},
+		{args: args(i(1), v(), v()), err: true},
+		{args: args(i(1), syntax.Atom("a"), v()), err: true},
+		{args: args(i(1), i(3), syntax.Atom("a")), err: true},
+		{args: args(syntax.Float64(1), i(3), v()), err: true},
+	})
+}
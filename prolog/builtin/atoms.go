@@ -0,0 +1,548 @@
+package builtin
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Analysing and constructing atoms, see http://www.swi-prolog.org/pldoc/man?section=manipatom
+
+// textArg returns the text of an atom or string argument.
+func textArg(t syntax.Term) (string, error) {
+	switch a := deref(t).(type) {
+	case syntax.Atom:
+		return string(a), nil
+	case syntax.String:
+		return string(a), nil
+	default:
+		return "", typeErr("atom", t)
+	}
+}
+
+// lengthArg checks that a length argument is either unbound or a
+// non-negative integer.
+func lengthArg(t syntax.Term) error {
+	switch n := deref(t).(type) {
+	case *syntax.Variable:
+		return nil
+	case syntax.Integer:
+		if n < 0 {
+			return domainErr("not_less_than_zero", t)
+		}
+		return nil
+	default:
+		return typeErr("integer", t)
+	}
+}
+
+// chars returns a list of the characters of s, as single character atoms.
+func chars(s string) syntax.Term {
+	var terms []syntax.Term
+	for _, r := range s {
+		terms = append(terms, syntax.Atom(string(r)))
+	}
+	return syntax.NewList(terms)
+}
+
+// charsToString returns the text of a list of single character atoms, or of
+// a string.
+func charsToString(t syntax.Term) (string, error) {
+	if s, ok := deref(t).(syntax.String); ok {
+		return string(s), nil
+	}
+	terms, err := syntax.ListToSlice(t)
+	if err != nil {
+		return "", err
+	}
+	var b []byte
+	for _, c := range terms {
+		a, ok := deref(c).(syntax.Atom)
+		if !ok {
+			return "", typeErr("character", c)
+		}
+		if utf8.RuneCountInString(string(a)) != 1 {
+			return "", typeErr("character", c)
+		}
+		b = append(b, a...)
+	}
+	return string(b), nil
+}
+
+// codes returns a list of the character codes of s.
+func codes(s string) syntax.Term {
+	var terms []syntax.Term
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		terms = append(terms, syntax.Integer(r))
+		s = s[size:]
+	}
+	return syntax.NewList(terms)
+}
+
+// codesToString returns the text of a list of character codes, or of a
+// string.
+func codesToString(t syntax.Term) (string, error) {
+	if s, ok := deref(t).(syntax.String); ok {
+		return string(s), nil
+	}
+	terms, err := syntax.ListToSlice(t)
+	if err != nil {
+		return "", err
+	}
+	var b []byte
+	for _, c := range terms {
+		code, ok := deref(c).(syntax.Integer)
+		if !ok {
+			return "", typeErr("integer", c)
+		}
+		if !validCode(code) {
+			return "", domainErr("character_code", c)
+		}
+		b = utf8.AppendRune(b, rune(code))
+	}
+	return string(b), nil
+}
+
+// unifyText unifies t with list(s), a list of the characters or codes of s.
+// If t is a string, it's compared with s instead.
+func unifyText(t syntax.Term, s string, list func(string) syntax.Term) bool {
+	if str, ok := deref(t).(syntax.String); ok {
+		return string(str) == s
+	}
+	return t.Unify(list(s))
+}
+
+// validCode reports whether i is the code of a Unicode character.
+func validCode(i syntax.Integer) bool {
+	return i >= 0 && i <= utf8.MaxRune && utf8.ValidRune(rune(i))
+}
+
+// numberText returns the text of a number argument.
+func numberText(t syntax.Term) (string, error) {
+	switch n := deref(t).(type) {
+	case syntax.Integer:
+		return n.String(), nil
+	case syntax.Float64:
+		return formatFloat(n), nil
+	default:
+		return "", typeErr("number", t)
+	}
+}
+
+// parseNumber parses the text of a number, returning a syntax error if it
+// isn't one.
+func parseNumber(s string) (syntax.Term, error) {
+	n, err := parse.Number(s)
+	if err != nil {
+		return nil, &syntax.PrologError{Term: syntax.SyntaxErrorTerm(err.Error())}
+	}
+	return n, nil
+}
+
+// AtomLength2 implements atom_length(Atom, Length), unifying Length with the
+// number of characters of Atom.
+var AtomLength2 syntax.Clause = &builtin{
+	name:  "atom_length",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		s, err := textArg(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		if err := lengthArg(args[1]); err != nil {
+			return nil, false, err
+		}
+		return nil, args[1].Unify(syntax.Integer(utf8.RuneCountInString(s))), nil
+	},
+}
+
+// AtomConcat3 implements atom_concat(A, B, C), where C is the concatenation
+// of the atoms A and B. If A and B aren't both bound, C must be, and
+// atom_concat backtracks over the ways to split C into A and B.
+var AtomConcat3 syntax.Clause = &generator{
+	name:  "atom_concat",
+	nArgs: 3,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		a, b, c := deref(args[0]), deref(args[1]), deref(args[2])
+		_, aUnbound := a.(*syntax.Variable)
+		_, bUnbound := b.(*syntax.Variable)
+		if !aUnbound && !bUnbound {
+			done := false
+			return func() (*syntax.Goal, bool, error) {
+				if done {
+					return nil, false, nil
+				}
+				done = true
+				x, err := textArg(a)
+				if err != nil {
+					return nil, false, err
+				}
+				y, err := textArg(b)
+				if err != nil {
+					return nil, false, err
+				}
+				return nil, c.Unify(syntax.Atom(x + y)), nil
+			}
+		}
+
+		s, err := textArg(c)
+		for _, t := range []syntax.Term{a, b} {
+			switch t.(type) {
+			case *syntax.Variable, syntax.Atom:
+			default:
+				err = typeErr("atom", t)
+			}
+		}
+		// the byte offsets of each split, one per character boundary
+		var splits []int
+		for i := range s {
+			splits = append(splits, i)
+		}
+		splits = append(splits, len(s))
+
+		return func() (*syntax.Goal, bool, error) {
+			if err != nil {
+				return nil, false, err
+			}
+			target := syntax.NewCompound("-", a, b)
+			for len(splits) > 0 {
+				i := splits[0]
+				splits = splits[1:]
+				split := syntax.NewCompound("-", syntax.Atom(s[:i]), syntax.Atom(s[i:]))
+				if unifies(target, split) {
+					return nil, target.Unify(split), nil
+				}
+			}
+			return nil, false, nil
+		}
+	},
+}
+
+// AtomChars2 implements atom_chars(Atom, Chars), where Chars is the list of
+// characters of Atom as single character atoms. If Atom is unbound, it's
+// constructed from Chars.
+var AtomChars2 syntax.Clause = &builtin{
+	name:  "atom_chars",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := textArg(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, unifyText(args[1], s, chars), nil
+		}
+		s, err := charsToString(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(syntax.Atom(s)), nil
+	},
+}
+
+// AtomCodes2 implements atom_codes(Atom, Codes), where Codes is the list of
+// character codes of Atom. If Atom is unbound, it's constructed from Codes.
+var AtomCodes2 syntax.Clause = &builtin{
+	name:  "atom_codes",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := textArg(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, unifyText(args[1], s, codes), nil
+		}
+		s, err := codesToString(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(syntax.Atom(s)), nil
+	},
+}
+
+// NumberCodes2 implements number_codes(Number, Codes), where Codes is the list
+// of character codes of Number as it would be written. If Number is unbound,
+// Codes is parsed as a number.
+var NumberCodes2 syntax.Clause = &builtin{
+	name:  "number_codes",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := numberText(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, unifyText(args[1], s, codes), nil
+		}
+		s, err := codesToString(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		n, err := parseNumber(s)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(n), nil
+	},
+}
+
+// CharCode2 implements char_code(Char, Code), relating a single character
+// atom to its character code.
+var CharCode2 syntax.Clause = &builtin{
+	name:  "char_code",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := textArg(args[0])
+			if err != nil || utf8.RuneCountInString(s) != 1 {
+				return nil, false, typeErr("character", args[0])
+			}
+			r, _ := utf8.DecodeRuneInString(s)
+			return nil, args[1].Unify(syntax.Integer(r)), nil
+		}
+		code, ok := deref(args[1]).(syntax.Integer)
+		if !ok {
+			return nil, false, typeErr("integer", args[1])
+		}
+		if !validCode(code) {
+			return nil, false, domainErr("character_code", args[1])
+		}
+		return nil, args[0].Unify(syntax.Atom(string(rune(code)))), nil
+	},
+}
+
+// NumberChars2 implements number_chars(Number, Chars), where Chars is the list
+// of characters of Number as it would be written. If Number is unbound, Chars
+// is parsed as a number.
+var NumberChars2 syntax.Clause = &builtin{
+	name:  "number_chars",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := numberText(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, unifyText(args[1], s, chars), nil
+		}
+		s, err := charsToString(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		n, err := parseNumber(s)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(n), nil
+	},
+}
+
+// AtomNumber2 implements atom_number(Atom, Number). If Atom is bound, it's
+// parsed as a number, failing if it isn't one. Otherwise Atom is unified with
+// the text of Number.
+var AtomNumber2 syntax.Clause = &builtin{
+	name:  "atom_number",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := textArg(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			n, err := parse.Number(s)
+			if err != nil {
+				return nil, false, nil
+			}
+			return nil, args[1].Unify(n), nil
+		}
+		s, err := numberText(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(syntax.Atom(s)), nil
+	},
+}
+
+// SubAtom5 implements sub_atom(Atom, Before, Length, After, SubAtom), where
+// SubAtom is a substring of Atom starting after Before characters, of Length
+// characters and followed by After characters. sub_atom backtracks over every
+// substring matching the bound arguments.
+var SubAtom5 syntax.Clause = &generator{
+	name:  "sub_atom",
+	nArgs: 5,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		s, err := textArg(args[0])
+		for _, arg := range args[1:4] {
+			if err == nil {
+				err = lengthArg(arg)
+			}
+		}
+		if err == nil {
+			switch deref(args[4]).(type) {
+			case *syntax.Variable, syntax.Atom:
+			default:
+				err = typeErr("atom", args[4])
+			}
+		}
+		runes := []rune(s)
+		n := len(runes)
+
+		// bound arguments restrict the substrings which have to be tried
+		known := func(t syntax.Term) (int, bool) {
+			i, ok := deref(t).(syntax.Integer)
+			return int(i), ok
+		}
+		fixedBefore, hasBefore := known(args[1])
+		fixedLength, hasLength := known(args[2])
+		fixedAfter, hasAfter := known(args[3])
+		if sub, ok := deref(args[4]).(syntax.Atom); ok && !hasLength {
+			fixedLength, hasLength = utf8.RuneCountInString(string(sub)), true
+		}
+		lengths := func(before int) (lo, hi int) {
+			switch {
+			case hasLength:
+				return fixedLength, fixedLength
+			case hasAfter:
+				return n - before - fixedAfter, n - before - fixedAfter
+			}
+			return 0, n - before
+		}
+		before, last := 0, n
+		if hasBefore {
+			before, last = fixedBefore, fixedBefore
+		}
+		length := -1 // the next length to try, -1 before the first
+
+		target := syntax.NewCompound("sub_atom", args[1:]...)
+		return func() (*syntax.Goal, bool, error) {
+			if err != nil {
+				return nil, false, err
+			}
+			for ; before <= last; before, length = before+1, -1 {
+				lo, hi := lengths(before)
+				if length < lo {
+					length = lo
+				}
+				for ; length <= hi; length++ {
+					if length < 0 || before+length > n {
+						continue
+					}
+					after := n - before - length
+					match := syntax.NewCompound("sub_atom",
+						syntax.Integer(before), syntax.Integer(length), syntax.Integer(after),
+						syntax.Atom(string(runes[before:before+length])))
+					if unifies(target, match) {
+						length++
+						return nil, target.Unify(match), nil
+					}
+				}
+			}
+			return nil, false, nil
+		}
+	},
+}
+
+// newCaseConv returns a builtin for a predicate which unifies its second
+// argument with the text of the atom in its first, converted by conv.
+func newCaseConv(name string, conv func(string) string) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 2,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			s, err := textArg(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, args[1].Unify(syntax.Atom(conv(s))), nil
+		},
+	}
+}
+
+// UpcaseAtom2 implements upcase_atom(Atom, Upper), where Upper is Atom with
+// all letters converted to upper case.
+var UpcaseAtom2 = newCaseConv("upcase_atom", strings.ToUpper)
+
+// DowncaseAtom2 implements downcase_atom(Atom, Lower), where Lower is Atom
+// with all letters converted to lower case.
+var DowncaseAtom2 = newCaseConv("downcase_atom", strings.ToLower)
+
+// atomicText returns the text of an atom or number argument.
+func atomicText(t syntax.Term) (string, error) {
+	switch a := deref(t).(type) {
+	case syntax.Atom:
+		return string(a), nil
+	case syntax.String:
+		return string(a), nil
+	case syntax.Integer, syntax.Float64:
+		return numberText(a)
+	default:
+		return "", typeErr("atomic", t)
+	}
+}
+
+// atomicListConcat joins the text of a list of atomic terms with sep.
+func atomicListConcat(list syntax.Term, sep string) (syntax.Atom, error) {
+	terms, err := syntax.ListToSlice(list)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		if parts[i], err = atomicText(t); err != nil {
+			return "", err
+		}
+	}
+	return syntax.Atom(strings.Join(parts, sep)), nil
+}
+
+// AtomicListConcat2 implements atomic_list_concat(List, Atom), where Atom is
+// the concatenation of the text of the atoms and numbers in List.
+var AtomicListConcat2 syntax.Clause = &builtin{
+	name:  "atomic_list_concat",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		a, err := atomicListConcat(args[0], "")
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[1].Unify(a), nil
+	},
+}
+
+// AtomicListConcat3 implements atomic_list_concat(List, Separator, Atom). Like
+// atomic_list_concat/2, but with Separator between each element. If List isn't
+// fully bound, Atom is instead split on Separator, which mustn't be empty,
+// and List is unified with the list of parts.
+var AtomicListConcat3 syntax.Clause = &builtin{
+	name:  "atomic_list_concat",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		sep, err := atomicText(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		if _, ok := deref(args[2]).(*syntax.Variable); ok || syntax.IsGround(args[0]) {
+			a, err := atomicListConcat(args[0], sep)
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, args[2].Unify(a), nil
+		}
+		s, err := atomicText(args[2])
+		if err != nil {
+			return nil, false, err
+		}
+		if sep == "" {
+			return nil, false, domainErr("non_empty_atom", args[1])
+		}
+		var parts []syntax.Term
+		for _, part := range strings.Split(s, sep) {
+			parts = append(parts, syntax.Atom(part))
+		}
+		return nil, args[0].Unify(syntax.NewList(parts)), nil
+	},
+}
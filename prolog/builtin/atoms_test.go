@@ -0,0 +1,328 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestAtomLength(t *testing.T) {
+	v := func() *syntax.Variable { return syntax.NewVariable("L") }
+	testCalls(t, AtomLength2, []callTest{
+		{args: args(syntax.Atom("hello"), syntax.Integer(5)), matches: true},
+		{args: args(syntax.Atom("héllo"), syntax.Integer(5)), matches: true},
+		{args: args(syntax.Atom(""), syntax.Integer(0)), matches: true},
+		{args: args(syntax.Atom("hello"), syntax.Integer(4)), matches: false},
+		{args: args(syntax.Atom("hello"), v()), matches: true},
+		{args: args(v(), syntax.Integer(4)), err: true},
+		{args: args(syntax.Integer(1), v()), err: true},
+		{args: args(syntax.Atom("a"), syntax.Atom("b")), err: true},
+		{args: args(syntax.Atom("a"), syntax.Integer(-1)), err: true},
+	})
+
+	l := syntax.NewVariable("L")
+	testSolutions(t, DefaultProg(), l, goal(syntax.NewCompound("atom_length", syntax.Atom("日本語"), l)), syntax.Integer(3))
+}
+
+func TestAtomConcat(t *testing.T) {
+	concat := func(a, b, c syntax.Term) syntax.Term { return syntax.NewCompound("atom_concat", a, b, c) }
+	pair := func(a, b string) syntax.Term { return syntax.NewCompound("-", syntax.Atom(a), syntax.Atom(b)) }
+	p := DefaultProg()
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(syntax.Atom("hello"), syntax.Atom(" world"), x)), syntax.Atom("hello world"))
+	testSolutions(t, p, x, goal(concat(syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("ab")), syntax.NewCompound("=", x, syntax.Atom("ok"))), syntax.Atom("ok"))
+	testSolutions(t, p, x, goal(concat(syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("ba"))))
+
+	// split mode
+	x, y, z := syntax.NewVariable("X"), syntax.NewVariable("Y"), syntax.NewVariable("Z")
+	testSolutions(t, p, z, goal(concat(x, y, syntax.Atom("abc")), syntax.NewCompound("=", z, syntax.NewCompound("-", x, y))),
+		pair("", "abc"), pair("a", "bc"), pair("ab", "c"), pair("abc", ""))
+	x, y, z = syntax.NewVariable("X"), syntax.NewVariable("Y"), syntax.NewVariable("Z")
+	testSolutions(t, p, z, goal(concat(x, y, syntax.Atom("hé")), syntax.NewCompound("=", z, syntax.NewCompound("-", x, y))),
+		pair("", "hé"), pair("h", "é"), pair("hé", ""))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(x, syntax.Atom("ing"), syntax.Atom("testing"))), syntax.Atom("test"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(syntax.Atom("test"), x, syntax.Atom("testing"))), syntax.Atom("ing"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(syntax.Atom("foo"), x, syntax.Atom("testing"))))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, AtomConcat3, []callTest{
+		{args: args(v(), v(), v()), err: true},
+		{args: args(syntax.Atom("a"), v(), v()), err: true},
+		{args: args(syntax.Integer(1), syntax.Atom("a"), v()), err: true},
+		{args: args(v(), syntax.Integer(1), syntax.Atom("a")), err: true},
+	})
+}
+
+func TestAtomChars(t *testing.T) {
+	chars := func(s ...string) syntax.Term {
+		var terms []syntax.Term
+		for _, c := range s {
+			terms = append(terms, syntax.Atom(c))
+		}
+		return list(terms...)
+	}
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_chars", syntax.Atom("héllo"), x)), chars("h", "é", "l", "l", "o"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_chars", syntax.Atom(""), x)), syntax.EmptyList)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_chars", x, chars("a", "b", "c"))), syntax.Atom("abc"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_chars", syntax.Atom("ab"), list(x, syntax.Atom("b")))), syntax.Atom("a"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_chars", x, syntax.String("abc"))), syntax.Atom("abc"))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, AtomChars2, []callTest{
+		{args: args(syntax.Atom("ab"), chars("a", "b")), matches: true},
+		{args: args(syntax.Atom("ab"), chars("a")), matches: false},
+		{args: args(syntax.Atom("ab"), syntax.String("ab")), matches: true},
+		{args: args(syntax.Atom("ab"), syntax.String("a")), matches: false},
+		{args: args(v(), v()), err: true},
+		{args: args(v(), list(syntax.Atom("a"), v())), err: true},
+		{args: args(v(), list(syntax.Atom("ab"))), err: true},
+		{args: args(v(), list(syntax.Integer(1))), err: true},
+		{args: args(syntax.Integer(1), v()), err: true},
+	})
+}
+
+// ints returns a list of integers.
+func ints(n ...int) syntax.Term {
+	var terms []syntax.Term
+	for _, i := range n {
+		terms = append(terms, syntax.Integer(i))
+	}
+	return list(terms...)
+}
+
+func TestAtomCodes(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_codes", syntax.Atom("hello"), x)), ints(104, 101, 108, 108, 111))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_codes", syntax.Atom("hé"), x)), ints(104, 233))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_codes", x, ints(104, 101, 108, 108, 111))), syntax.Atom("hello"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_codes", x, syntax.EmptyList)), syntax.Atom(""))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_codes", x, syntax.String("abc"))), syntax.Atom("abc"))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, AtomCodes2, []callTest{
+		{args: args(syntax.Atom("ab"), ints(97, 98)), matches: true},
+		{args: args(syntax.Atom("ab"), ints(97)), matches: false},
+		{args: args(syntax.Atom("ab"), syntax.String("ab")), matches: true},
+		{args: args(v(), v()), err: true},
+		{args: args(v(), list(syntax.Atom("a"))), err: true},
+		{args: args(v(), ints(-1)), err: true},
+		{args: args(v(), ints(0x110000)), err: true},
+		{args: args(syntax.Integer(1), v()), err: true},
+	})
+}
+
+func TestNumberCodes(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_codes", syntax.Integer(42), x)), ints(52, 50))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_codes", syntax.Float64(-1.5), x)), ints('-', '1', '.', '5'))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_codes", x, ints(52, 50))), syntax.Integer(42))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_codes", x, ints(' ', '3', '.', '5'))), syntax.Float64(3.5))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_codes", x, ints('0', 'x', 'f'))), syntax.Integer(15))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_codes", x, syntax.String("42"))), syntax.Integer(42))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, NumberCodes2, []callTest{
+		{args: args(syntax.Integer(7), ints('7')), matches: true},
+		{args: args(syntax.Integer(7), ints('8')), matches: false},
+		{args: args(syntax.Integer(7), syntax.String("7")), matches: true},
+		{args: args(v(), syntax.String("4a")), err: true},
+		{args: args(v(), ints('a')), err: true},
+		{args: args(v(), ints('4', ' ')), err: true},
+		{args: args(v(), v()), err: true},
+		{args: args(syntax.Atom("a"), v()), err: true},
+	})
+}
+
+func TestCharCode(t *testing.T) {
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, CharCode2, []callTest{
+		{args: args(syntax.Atom("a"), syntax.Integer(97)), matches: true},
+		{args: args(syntax.Atom("é"), syntax.Integer(233)), matches: true},
+		{args: args(syntax.Atom("a"), syntax.Integer(98)), matches: false},
+		{args: args(syntax.Atom("a"), v()), matches: true},
+		{args: args(v(), syntax.Integer(97)), matches: true},
+		{args: args(v(), v()), err: true},
+		{args: args(syntax.Atom("ab"), v()), err: true},
+		{args: args(syntax.Integer(1), v()), err: true},
+		{args: args(v(), syntax.Integer(-1)), err: true},
+		{args: args(v(), syntax.Atom("a")), err: true},
+	})
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, DefaultProg(), x, goal(syntax.NewCompound("char_code", x, syntax.Integer(0x65e5))), syntax.Atom("日"))
+}
+
+func TestNumberChars(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_chars", syntax.Integer(42), x)), list(syntax.Atom("4"), syntax.Atom("2")))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_chars", syntax.Float64(3.25), x)), chars("3.25"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_chars", x, chars("-17"))), syntax.Integer(-17))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_chars", x, chars("1.0e3"))), syntax.Float64(1000))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("number_chars", x, syntax.String("-2.5"))), syntax.Float64(-2.5))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, NumberChars2, []callTest{
+		{args: args(syntax.Integer(42), chars("42")), matches: true},
+		{args: args(syntax.Integer(42), chars("24")), matches: false},
+		{args: args(v(), chars("4a")), err: true},
+		{args: args(v(), v()), err: true},
+		{args: args(syntax.Atom("a"), v()), err: true},
+	})
+}
+
+func TestAtomNumber(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_number", syntax.Atom("3.14"), x)), syntax.Float64(3.14))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_number", syntax.Atom("42"), x)), syntax.Integer(42))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_number", x, syntax.Integer(42))), syntax.Atom("42"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("atom_number", x, syntax.Float64(2))), syntax.Atom("2.0"))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, AtomNumber2, []callTest{
+		{args: args(syntax.Atom("42"), syntax.Integer(42)), matches: true},
+		{args: args(syntax.Atom("42"), syntax.Integer(43)), matches: false},
+		{args: args(syntax.Atom("abc"), v()), matches: false},
+		{args: args(syntax.Atom(""), v()), matches: false},
+		{args: args(syntax.Atom("4 2"), v()), matches: false},
+		{args: args(syntax.Atom("1e"), v()), matches: false},
+		{args: args(v(), v()), err: true},
+		{args: args(v(), syntax.Atom("a")), err: true},
+		{args: args(syntax.Integer(1), v()), err: true},
+	})
+}
+
+func TestSubAtom(t *testing.T) {
+	p := DefaultProg()
+	subAtom := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("sub_atom", args...) }
+	abc := syntax.Atom("abc")
+
+	// all substrings
+	b, l, a, s := syntax.NewVariable("B"), syntax.NewVariable("L"), syntax.NewVariable("A"), syntax.NewVariable("S")
+	var exp []syntax.Term
+	for _, sub := range []string{"", "a", "ab", "abc", "", "b", "bc", "", "c", ""} {
+		exp = append(exp, syntax.Atom(sub))
+	}
+	testSolutions(t, p, s, goal(subAtom(abc, b, l, a, s)), exp...)
+
+	// occurrences of a substring
+	b = syntax.NewVariable("B")
+	testSolutions(t, p, b, goal(subAtom(syntax.Atom("abcabc"), b, syntax.NewVariable("L"), syntax.NewVariable("A"), syntax.Atom("bc"))),
+		syntax.Integer(1), syntax.Integer(4))
+	b = syntax.NewVariable("B")
+	testSolutions(t, p, b, goal(subAtom(syntax.Atom("héllo"), b, syntax.NewVariable("L"), syntax.NewVariable("A"), syntax.Atom("l"))),
+		syntax.Integer(2), syntax.Integer(3))
+
+	// fixed positions
+	s = syntax.NewVariable("S")
+	testSolutions(t, p, s, goal(subAtom(syntax.Atom("hello"), syntax.Integer(1), syntax.Integer(3), syntax.NewVariable("A"), s)),
+		syntax.Atom("ell"))
+	s = syntax.NewVariable("S")
+	testSolutions(t, p, s, goal(subAtom(syntax.Atom("hello"), syntax.NewVariable("B"), syntax.NewVariable("L"), syntax.Integer(0), s)),
+		syntax.Atom("hello"), syntax.Atom("ello"), syntax.Atom("llo"), syntax.Atom("lo"), syntax.Atom("o"), syntax.Atom(""))
+	s = syntax.NewVariable("S")
+	testSolutions(t, p, s, goal(subAtom(syntax.Atom("hello"), syntax.NewVariable("B"), syntax.Integer(2), syntax.Integer(1), s)),
+		syntax.Atom("ll"))
+	s = syntax.NewVariable("S")
+	testSolutions(t, p, s, goal(subAtom(syntax.Atom("hello"), syntax.Integer(4), syntax.Integer(2), syntax.NewVariable("A"), s)))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, SubAtom5, []callTest{
+		{args: args(abc, syntax.Integer(1), syntax.Integer(1), syntax.Integer(1), syntax.Atom("b")), matches: true},
+		{args: args(abc, syntax.Integer(0), syntax.Integer(1), syntax.Integer(1), syntax.Atom("a")), matches: false},
+		{args: args(abc, v(), v(), v(), syntax.Atom("d")), matches: false},
+		{args: args(abc, v(), syntax.Integer(4), v(), v()), matches: false},
+		{args: args(v(), v(), v(), v(), v()), err: true},
+		{args: args(syntax.Integer(1), v(), v(), v(), v()), err: true},
+		{args: args(abc, syntax.Atom("a"), v(), v(), v()), err: true},
+		{args: args(abc, v(), syntax.Integer(-1), v(), v()), err: true},
+		{args: args(abc, v(), v(), v(), syntax.Integer(1)), err: true},
+	})
+}
+
+func TestCaseConv(t *testing.T) {
+	v := func() *syntax.Variable { return syntax.NewVariable("X") }
+	testCalls(t, UpcaseAtom2, []callTest{
+		{args: args(syntax.Atom("hello"), syntax.Atom("HELLO")), matches: true},
+		{args: args(syntax.Atom("café"), syntax.Atom("CAFÉ")), matches: true},
+		{args: args(syntax.Atom("Hello World 1"), syntax.Atom("HELLO WORLD 1")), matches: true},
+		{args: args(syntax.Atom("hello"), syntax.Atom("hello")), matches: false},
+		{args: args(syntax.Atom("hello"), v()), matches: true},
+		{args: args(v(), syntax.Atom("HELLO")), err: true},
+		{args: args(syntax.Integer(1), v()), err: true},
+	})
+	testCalls(t, DowncaseAtom2, []callTest{
+		{args: args(syntax.Atom("WORLD"), syntax.Atom("world")), matches: true},
+		{args: args(syntax.Atom("ÀÉÎ"), syntax.Atom("àéî")), matches: true},
+		{args: args(syntax.Atom("world"), syntax.Atom("WORLD")), matches: false},
+	})
+
+	x := v()
+	testSolutions(t, DefaultProg(), x, goal(syntax.NewCompound("upcase_atom", syntax.Atom("café"), x)), syntax.Atom("CAFÉ"))
+}
+
+func TestAtomicListConcat(t *testing.T) {
+	p := DefaultProg()
+	a, b, c := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("c")
+	concat := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("atomic_list_concat", args...) }
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(list(syntax.Atom("hello"), syntax.Atom(" "), syntax.Atom("world")), x)), syntax.Atom("hello world"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(list(a, syntax.Integer(1), syntax.Float64(2.5)), x)), syntax.Atom("a12.5"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(syntax.EmptyList, x)), syntax.Atom(""))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(list(a, b, c), syntax.Atom("-"), x)), syntax.Atom("a-b-c"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(list(a, b, c), syntax.Atom(", "), x)), syntax.Atom("a, b, c"))
+
+	// split
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(x, syntax.Atom("-"), syntax.Atom("a-b-c"))), list(a, b, c))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(x, syntax.Atom("-"), syntax.Atom("-a--"))),
+		list(syntax.Atom(""), a, syntax.Atom(""), syntax.Atom("")))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(concat(list(a, x), syntax.Atom("-"), syntax.Atom("a-b"))), b)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, nil, goal(concat(list(b, x), syntax.Atom("-"), syntax.Atom("a-b"))))
+
+	testCalls(t, AtomicListConcat3, []callTest{
+		{args: args(list(a, b), syntax.Atom("-"), syntax.Atom("a-b")), matches: true},
+		{args: args(list(a, b), syntax.Atom("-"), syntax.Atom("ab")), matches: false},
+		{args: args(syntax.NewVariable("L"), syntax.Atom(""), syntax.Atom("ab")), err: true},
+		{args: args(syntax.NewVariable("L"), syntax.Atom("-"), syntax.NewVariable("A")), err: true},
+		{args: args(list(a, syntax.NewVariable("B")), syntax.NewVariable("S"), syntax.Atom("ab")), err: true},
+		{args: args(list(syntax.NewCompound("f", a)), syntax.Atom("-"), syntax.NewVariable("A")), err: true},
+	})
+}
@@ -0,0 +1,108 @@
+package builtin
+
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Attributed variables, see http://www.swi-prolog.org/pldoc/man?section=attvar
+//
+// When a variable with attributes is bound, the hook
+// 'attr_unify_hook(Module, Attr, Value)' is called for each of its
+// attributes, see syntax.AttrUnifyHook. SWI-Prolog calls
+// 'Module:attr_unify_hook(Attr, Value)' instead, but this interpreter has no
+// modules, so the module is passed as the first argument. The hook's clauses
+// are defined by the program, usually one or more for each module, such as
+// DifUnifyHook3 for the module dif.
+
+// attrArgs returns the variable and module arguments of put_attr/3 and
+// get_attr/3. v is nil if the first argument isn't an unbound variable.
+func attrArgs(args []syntax.Term) (v *syntax.Variable, module syntax.Atom, err error) {
+	m := deref(args[1])
+	module, ok := m.(syntax.Atom)
+	if !ok {
+		return nil, "", typeErr("atom", m)
+	}
+	v, _ = deref(args[0]).(*syntax.Variable)
+	return v, module, nil
+}
+
+// PutAttr3 implements put_attr(Var, Module, Value), storing Value as the
+// attribute of Var for Module and replacing any value already stored. The
+// attribute is removed when put_attr is backtracked over.
+var PutAttr3 syntax.Clause = &builtin{
+	name:  "put_attr",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		v, module, err := attrArgs(args)
+		if err != nil {
+			return nil, false, err
+		}
+		if v == nil {
+			return nil, false, &syntax.PrologError{Term: syntax.UninstantiationErrorTerm(deref(args[0]))}
+		}
+		v.PutAttr(string(module), args[2])
+		return nil, true, nil
+	},
+}
+
+// GetAttr3 implements get_attr(Var, Module, Value), unifying Value with the
+// attribute of Var for Module. It fails if Var isn't an unbound variable or
+// has no attribute for Module.
+var GetAttr3 syntax.Clause = &builtin{
+	name:  "get_attr",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		v, module, err := attrArgs(args)
+		if err != nil || v == nil {
+			return nil, false, err
+		}
+		attr := v.GetAttr(string(module))
+		return nil, attr != nil && args[2].Unify(attr), nil
+	},
+}
+
+// Dif2 implements dif(A, B), which constrains A and B to never become
+// identical. It succeeds if A and B can't be unified and fails if they're
+// already identical. Otherwise the goal is attached to the variables of A and
+// B under the module dif, and checked again whenever one of them is bound.
+var Dif2 syntax.Clause = &builtin{
+	name:  "dif",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if !unifies(args[0], args[1]) {
+			return nil, true, nil
+		}
+		if syntax.Compare(args[0], args[1]) == 0 {
+			return nil, false, nil
+		}
+		goal := syntax.NewCompound("dif", args[0], args[1])
+		for _, v := range termVars(goal) {
+			var pending []syntax.Term
+			if attr := v.GetAttr("dif"); attr != nil {
+				var err error
+				if pending, err = syntax.ListToSlice(attr); err != nil {
+					return nil, false, err
+				}
+			}
+			if !containsTerm(pending, goal) {
+				v.PutAttr("dif", syntax.NewList(append(pending, goal)))
+			}
+		}
+		return nil, true, nil
+	},
+}
+
+// DifUnifyHook3 is the attr_unify_hook/3 clause of the module dif. It checks
+// each of the dif/2 goals attached to a variable which has been bound.
+var DifUnifyHook3 syntax.Clause = &builtin{
+	name:  string(syntax.AttrUnifyHook),
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if deref(args[0]) != syntax.Atom("dif") {
+			return nil, false, nil
+		}
+		goals, err := syntax.ListToSlice(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return syntax.GoalFromSlice(goals), true, nil
+	},
+}
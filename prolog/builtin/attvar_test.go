@@ -0,0 +1,128 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestAttributes(t *testing.T) {
+	p := DefaultProg()
+	put := func(v, m, val syntax.Term) syntax.Term { return syntax.NewCompound("put_attr", v, m, val) }
+	get := func(v, m, val syntax.Term) syntax.Term { return syntax.NewCompound("get_attr", v, m, val) }
+	m := syntax.Atom("m")
+
+	x, a := syntax.NewVariable("X"), syntax.NewVariable("A")
+	testSolutions(t, p, a, goal(put(x, m, syntax.Integer(1)), put(x, m, syntax.Integer(2)), get(x, m, a)), syntax.Integer(2))
+	if x.GetAttr("m") != nil {
+		t.Errorf("expected query to remove attribute, got %s", x.GetAttr("m"))
+	}
+	x, a = syntax.NewVariable("X"), syntax.NewVariable("A")
+	testSolutions(t, p, a, goal(put(x, m, syntax.Integer(1)), get(x, syntax.Atom("other"), a)))
+	a = syntax.NewVariable("A")
+	testSolutions(t, p, a, goal(get(syntax.Atom("foo"), m, a)))
+
+	// attributes are removed on backtracking
+	x, a = syntax.NewVariable("X"), syntax.NewVariable("A")
+	mod := syntax.NewVariable("M")
+	testSolutions(t, p, a, goal(
+		syntax.NewCompound("member", mod, list(syntax.Atom("a"), syntax.Atom("b"))),
+		put(x, mod, syntax.Integer(1)),
+		syntax.NewCompound("==", mod, syntax.Atom("b")),
+		get(x, syntax.Atom("a"), a),
+	))
+
+	for _, g := range []syntax.Term{
+		put(syntax.Atom("foo"), m, syntax.Integer(1)),
+		put(syntax.NewVariable("X"), syntax.NewVariable("M"), syntax.Integer(1)),
+		put(syntax.NewVariable("X"), syntax.Integer(1), syntax.Integer(1)),
+		get(syntax.NewVariable("X"), syntax.Integer(1), syntax.NewVariable("A")),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
+
+func TestAttrUnifyHook(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		domain(X, Lo, Hi) :- put_attr(X, domain, Lo-Hi).
+		attr_unify_hook(domain, Lo-Hi, V) :- integer(V), V >= Lo, V =< Hi.
+	`)
+	domain := func(v syntax.Term) syntax.Term {
+		return syntax.NewCompound("domain", v, syntax.Integer(1), syntax.Integer(10))
+	}
+	unify := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("=", a, b) }
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(domain(x), unify(x, syntax.Integer(5))), syntax.Integer(5))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(domain(x), unify(x, syntax.Integer(11))))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(domain(x), unify(x, syntax.Atom("a"))))
+
+	// the hook is called however the variable is bound
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(domain(x), syntax.NewCompound("member", x, ints(0, 3, 12, 7))),
+		syntax.Integer(3), syntax.Integer(7))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(domain(x), syntax.NewCompound("between", syntax.Integer(8), syntax.Integer(12), x)),
+		syntax.Integer(8), syntax.Integer(9), syntax.Integer(10))
+
+	// binding another variable to an attributed one keeps the attributes
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(domain(x), unify(y, x), unify(y, syntax.Integer(20))))
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(domain(x), unify(x, y), unify(y, syntax.Integer(2))), syntax.Integer(2))
+}
+
+func TestDif(t *testing.T) {
+	p := DefaultProg()
+	dif := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("dif", a, b) }
+	unify := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("=", a, b) }
+	a, b := syntax.Atom("a"), syntax.Atom("b")
+	f := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("f", args...) }
+
+	tests := []struct {
+		goal []syntax.Term
+		exp  int
+	}{
+		{goal(dif(syntax.Integer(1), syntax.Integer(1))), 0},
+		{goal(dif(a, b)), 1},
+		{goal(dif(syntax.NewVariable("X"), syntax.NewVariable("Y"))), 1},
+	}
+	for _, test := range tests {
+		if n := len(solutions(t, p, nil, test.goal...)); n != test.exp {
+			t.Errorf("%s: expected %d solutions got %d", test.goal, test.exp, n)
+		}
+	}
+
+	// the constraint is checked when the variables are bound
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(dif(x, syntax.Integer(1)), unify(x, syntax.Integer(2))), syntax.Integer(2))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(dif(x, syntax.Integer(1)), unify(x, syntax.Integer(1))))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(dif(x, b), syntax.NewCompound("member", x, list(a, b, syntax.Atom("c")))),
+		a, syntax.Atom("c"))
+
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(dif(x, y), unify(x, y)))
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(dif(x, y), unify(x, a), unify(y, b)), a)
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(dif(x, y), unify(x, a), unify(y, a)))
+
+	// compound terms only fail once they become identical
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(dif(f(x, a), f(b, y)), unify(x, b)), b)
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(dif(f(x, a), f(b, y)), unify(x, b), unify(y, a)))
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(dif(f(x, a), f(b, y)), unify(y, b), unify(x, b)), b)
+
+	// variables bound to constrained variables are checked too
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	testSolutions(t, p, x, goal(dif(x, a), unify(y, x), unify(y, a)))
+}
@@ -9,17 +9,159 @@ import (
 type builtin struct {
 	name  string
 	nArgs int
-	call  func(arg []syntax.Term) (*syntax.Goal, bool)
+	call  func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error)
 }
 
 func (b *builtin) Signature() (syntax.Atom, int) {
 	return syntax.Atom(b.name), b.nArgs
 }
 
-func (b *builtin) Call(args []syntax.Term) (*syntax.Goal, bool) {
-	return b.call(args)
+func (b *builtin) Call(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+	return b.call(p, args)
 }
 
 func (b *builtin) String() string {
 	return fmt.Sprintf("%s/%d", b.name, b.nArgs)
 }
+
+// generator is a builtin which may match more than once. generate returns a
+// function which is called for each match, see syntax.Generator.
+type generator struct {
+	name     string
+	nArgs    int
+	generate func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error)
+}
+
+func (g *generator) Signature() (syntax.Atom, int) {
+	return syntax.Atom(g.name), g.nArgs
+}
+
+// Call returns the first match of the generator.
+func (g *generator) Call(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+	return g.generate(p, args)()
+}
+
+func (g *generator) Generate(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+	return g.generate(p, args)
+}
+
+func (g *generator) String() string {
+	return fmt.Sprintf("%s/%d", g.name, g.nArgs)
+}
+
+// unifies reports whether two terms unify, without binding any variables.
+func unifies(a, b syntax.Term) bool {
+	cp := syntax.Copy(syntax.NewCompound("=", a, b)).(*syntax.Compound).Args()
+	return cp[0].Unify(cp[1])
+}
+
+// deref returns the term a variable is bound to, see syntax.Deref.
+func deref(t syntax.Term) syntax.Term {
+	return syntax.Deref(t)
+}
+
+// typeErr returns the error for an argument which isn't of the expected type.
+// If the argument is an unbound variable, an instantiation error is returned.
+func typeErr(exp string, t syntax.Term) error {
+	if _, ok := deref(t).(*syntax.Variable); ok {
+		return instantiationErr()
+	}
+	return &syntax.PrologError{Term: syntax.TypeErrorTerm(exp, deref(t))}
+}
+
+// instantiationErr returns the error for an argument which must be bound.
+func instantiationErr() error {
+	return &syntax.PrologError{Term: syntax.InstantiationErrorTerm()}
+}
+
+// domainErr returns the error for an argument whose value is outside of the
+// domain accepted by a predicate.
+func domainErr(domain string, t syntax.Term) error {
+	return &syntax.PrologError{Term: syntax.DomainErrorTerm(domain, deref(t))}
+}
+
+// evaluationErr returns the error for an arithmetic expression which can't
+// be evaluated.
+func evaluationErr(cause string) error {
+	return &syntax.PrologError{Term: syntax.EvaluationErrorTerm(cause)}
+}
+
+// clauses holds all standard builtins.
+var clauses = []syntax.Clause{
+	True0, Fail0, False0, Not1, Forall2, Throw1, Catch3,
+	Call1, Call2, Call3, Call4, Call5, Call6, Call7, Call8,
+	Once1,
+	Unify2, UnifyWithOccursCheck2, NotUnify2, Equal2, NotEqual2, Compare3,
+	Functor3, Arg3, Univ2, CopyTerm2, TermVariables2, Numbervars3,
+	PutAttr3, GetAttr3, Dif2, DifUnifyHook3,
+	Is2, ArithEq2, ArithNeq2, ArithLt2, ArithGt2, ArithLe2, ArithGe2,
+	Succ2, SuccOrZero2, Plus3, Between3,
+	Assert1, Asserta1, Assertz1, Retract1, Retractall1, Abolish1, Clause2,
+	PredicateProperty2,
+	NbSetval2, NbGetval2, Flag3,
+	Findall3, Bagof3, AggregateAll3,
+	Msort2, Sort2, Keysort2, Predsort3,
+	Member2, Select3, Permutation2, Append3, Append2, Length2, Last2, Reverse2,
+	Nth0_3, Nth1_3, Numlist3,
+	SumList2, MaxList2, MinList2,
+	Subtract3, Intersection3, Union3, ListToSet2,
+	Maplist2, Maplist3, Maplist4, Include3, Exclude3,
+	Foldl4, Foldl5, Foldl6, Phrase2, Phrase3,
+	Var1, Nonvar1, Integer1, Float1, Atom1, Number1, String1, Ground1,
+	Compound1, Atomic1, Callable1, IsList1,
+	Write1, Writeq1, WriteCanonical1, Nl0, Format2, WithOutputTo2, Read1, ReadTerm2,
+	AtomLength2, AtomConcat3, AtomChars2, AtomCodes2, NumberCodes2, CharCode2,
+	NumberChars2, AtomNumber2, SubAtom5, UpcaseAtom2, DowncaseAtom2,
+	AtomicListConcat2, AtomicListConcat3, TermToAtom2, AtomToTerm3,
+	StringChars2, StringCodes2, StringLength2, SplitString4,
+	CharType2,
+}
+
+// DefaultProg returns a program pre-loaded with all standard builtins.
+func DefaultProg() *syntax.Prog {
+	return syntax.NewProg(clauses...)
+}
+
+// toGoal converts a term to a goal, splitting conjunctions such as '(a, b)'
+// into their separate terms. The atom '!' is converted to a cut.
+func toGoal(t syntax.Term) *syntax.Goal {
+	var terms []syntax.Term
+	for {
+		t = deref(t)
+		c, ok := t.(*syntax.Compound)
+		if !ok || c.Functor() != "," || len(c.Args()) != 2 {
+			break
+		}
+		args := c.Args()
+		terms = append(terms, goalTerm(args[0]))
+		t = args[1]
+	}
+	terms = append(terms, goalTerm(t))
+	return syntax.GoalFromSlice(terms)
+}
+
+func goalTerm(t syntax.Term) syntax.Term {
+	if t = deref(t); t == syntax.Atom("!") {
+		return syntax.Cut
+	}
+	return t
+}
+
+// fromGoal converts a goal to a term, joining its terms into a conjunction.
+// It's the inverse of toGoal.
+func fromGoal(g *syntax.Goal) syntax.Term {
+	terms := g.ToSlice()
+	if len(terms) == 0 {
+		return syntax.Atom("true")
+	}
+	for i, t := range terms {
+		if t == syntax.Cut {
+			terms[i] = syntax.Atom("!")
+		}
+	}
+	t := terms[len(terms)-1]
+	for i := len(terms) - 2; i >= 0; i-- {
+		t = syntax.NewCompound(",", terms[i], t)
+	}
+	return t
+}
@@ -0,0 +1,168 @@
+package builtin
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Character properties, see http://www.swi-prolog.org/pldoc/man?section=chartype
+
+// charType is a type of char_type/2. Types with an argument, such as
+// upper(Lower), relate the character to another term.
+type charType struct {
+	name syntax.Atom
+	arg  bool
+	// test reports whether r has the type, returning the type's argument.
+	test func(r rune) (arg syntax.Term, ok bool)
+}
+
+// is returns the test of a type without an argument.
+func is(fn func(r rune) bool) func(r rune) (syntax.Term, bool) {
+	return func(r rune) (syntax.Term, bool) { return nil, fn(r) }
+}
+
+func isAlnum(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// charTypes holds the types of char_type/2 in the order they're enumerated.
+var charTypes = []charType{
+	{"alnum", false, is(isAlnum)},
+	{"alpha", false, is(func(r rune) bool { return isAlnum(r) || r == '_' })},
+	{"csym", false, is(func(r rune) bool { return isAlnum(r) || r == '_' })},
+	{"csymf", false, is(func(r rune) bool { return unicode.IsLetter(r) || r == '_' })},
+	{"ascii", false, is(func(r rune) bool { return r <= unicode.MaxASCII })},
+	{"white", false, is(func(r rune) bool { return r == ' ' || r == '\t' })},
+	{"cntrl", false, is(unicode.IsControl)},
+	{"space", false, is(unicode.IsSpace)},
+	{"end_of_line", false, is(func(r rune) bool { return r == '\n' || r == '\r' })},
+	{"graph", false, is(func(r rune) bool { return unicode.IsGraphic(r) && !unicode.IsSpace(r) })},
+	{"print", false, is(unicode.IsPrint)},
+	{"punct", false, is(func(r rune) bool {
+		return unicode.IsGraphic(r) && !unicode.IsSpace(r) && !isAlnum(r)
+	})},
+	{"digit", true, func(r rune) (syntax.Term, bool) {
+		if r < '0' || r > '9' {
+			return nil, false
+		}
+		return syntax.Integer(r - '0'), true
+	}},
+	{"upper", false, is(unicode.IsUpper)},
+	{"upper", true, func(r rune) (syntax.Term, bool) {
+		if !unicode.IsUpper(r) {
+			return nil, false
+		}
+		return syntax.Atom(unicode.ToLower(r)), true
+	}},
+	{"lower", false, is(unicode.IsLower)},
+	{"lower", true, func(r rune) (syntax.Term, bool) {
+		if !unicode.IsLower(r) {
+			return nil, false
+		}
+		return syntax.Atom(unicode.ToUpper(r)), true
+	}},
+	{"to_lower", true, func(r rune) (syntax.Term, bool) { return syntax.Atom(unicode.ToLower(r)), true }},
+	{"to_upper", true, func(r rune) (syntax.Term, bool) { return syntax.Atom(unicode.ToUpper(r)), true }},
+}
+
+// term returns the type's term for r, such as upper(a) for 'A'.
+func (ct charType) term(r rune) (syntax.Term, bool) {
+	arg, ok := ct.test(r)
+	if !ok {
+		return nil, false
+	}
+	if !ct.arg {
+		return ct.name, true
+	}
+	return syntax.NewCompound(ct.name, arg), true
+}
+
+// charTypesOf returns the types of char_type/2 which may unify with t.
+func charTypesOf(t syntax.Term) ([]charType, error) {
+	var name syntax.Atom
+	arg := false
+	switch t := deref(t).(type) {
+	case *syntax.Variable:
+		return charTypes, nil
+	case syntax.Atom:
+		name = t
+	case *syntax.Compound:
+		if len(t.Args()) != 1 {
+			return nil, domainErr("char_type", t)
+		}
+		name, arg = t.Functor(), true
+	default:
+		return nil, domainErr("char_type", t)
+	}
+	for _, ct := range charTypes {
+		if ct.name == name && ct.arg == arg {
+			return []charType{ct}, nil
+		}
+	}
+	return nil, domainErr("char_type", t)
+}
+
+// CharType2 implements char_type(Char, Type), which holds if the single
+// character atom Char has the type Type:
+//
+//	alnum            a letter or digit
+//	alpha            a letter, digit or underscore, like csym
+//	csymf            a letter or underscore, which can start a C symbol
+//	ascii            a 7 bit ASCII character
+//	white            a space or tab
+//	cntrl            a control character
+//	space            a white space character, including newlines
+//	end_of_line      a newline or carriage return
+//	graph            a visible character, neither space nor control
+//	print            a graph or space character
+//	punct            a graph character which isn't a letter or digit
+//	digit(Weight)    a digit from 0 to 9 with the value Weight
+//	upper, lower     an upper or lower case letter
+//	upper(Lower)     an upper case letter with the lower case Lower
+//	lower(Upper)     a lower case letter with the upper case Upper
+//	to_lower(Lower)  Lower is the character in lower case
+//	to_upper(Upper)  Upper is the character in upper case
+//
+// If Char or Type is unbound, char_type backtracks over each character and
+// type.
+var CharType2 syntax.Clause = &generator{
+	name:  "char_type",
+	nArgs: 2,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		types, err := charTypesOf(args[1])
+		// the characters to try, enumerating all characters if Char is unbound
+		next, last := rune(0), rune(unicode.MaxRune)
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok && err == nil {
+			s, e := textArg(args[0])
+			if e != nil || utf8.RuneCountInString(s) != 1 {
+				err = typeErr("character", args[0])
+			}
+			next, _ = utf8.DecodeRuneInString(s)
+			last = next
+		}
+		target := syntax.NewCompound("-", args[0], args[1])
+		i := 0 // the next type of next to try
+		return func() (*syntax.Goal, bool, error) {
+			if err != nil {
+				return nil, false, err
+			}
+			for ; next <= last; next, i = next+1, 0 {
+				if !utf8.ValidRune(next) {
+					continue
+				}
+				for ; i < len(types); i++ {
+					t, ok := types[i].term(next)
+					if !ok {
+						continue
+					}
+					match := syntax.NewCompound("-", syntax.Atom(next), t)
+					if unifies(target, match) {
+						i++
+						return nil, target.Unify(match), nil
+					}
+				}
+			}
+			return nil, false, nil
+		}
+	},
+}
@@ -0,0 +1,59 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestCharType(t *testing.T) {
+	p := DefaultProg()
+	charType := func(c, t syntax.Term) syntax.Term { return syntax.NewCompound("char_type", c, t) }
+	upper := func(t syntax.Term) syntax.Term { return syntax.NewCompound("upper", t) }
+	digit := func(t syntax.Term) syntax.Term { return syntax.NewCompound("digit", t) }
+
+	testCalls(t, CharType2, []callTest{
+		{args: args(syntax.Atom("a"), syntax.Atom("alpha")), matches: true},
+		{args: args(syntax.Atom("é"), syntax.Atom("alpha")), matches: true},
+		{args: args(syntax.Atom("_"), syntax.Atom("alpha")), matches: true},
+		{args: args(syntax.Atom("_"), syntax.Atom("alnum")), matches: false},
+		{args: args(syntax.Atom("-"), syntax.Atom("alpha")), matches: false},
+		{args: args(syntax.Atom("1"), digit(syntax.Integer(1))), matches: true},
+		{args: args(syntax.Atom("1"), digit(syntax.Integer(2))), matches: false},
+		{args: args(syntax.Atom(" "), syntax.Atom("space")), matches: true},
+		{args: args(syntax.Atom("\n"), syntax.Atom("space")), matches: true},
+		{args: args(syntax.Atom("\n"), syntax.Atom("white")), matches: false},
+		{args: args(syntax.Atom("!"), syntax.Atom("punct")), matches: true},
+		{args: args(syntax.Atom("a"), syntax.Atom("punct")), matches: false},
+		{args: args(syntax.Atom("É"), upper(syntax.Atom("é"))), matches: true},
+		{args: args(syntax.Atom("a"), syntax.Atom("upper")), matches: false},
+		{args: args(syntax.Atom("a"), syntax.NewCompound("to_upper", syntax.Atom("A"))), matches: true},
+		{args: args(syntax.Atom("é"), syntax.Atom("ascii")), matches: false},
+		{args: args(syntax.Atom("ab"), syntax.Atom("alpha")), err: true},
+		{args: args(syntax.Integer(1), syntax.Atom("alpha")), err: true},
+		{args: args(syntax.Atom("a"), syntax.Atom("foo")), err: true},
+		{args: args(syntax.Atom("a"), syntax.Integer(1)), err: true},
+	})
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(charType(syntax.Atom("A"), upper(x))), syntax.Atom("a"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(charType(syntax.Atom("7"), digit(x))), syntax.Integer(7))
+
+	// enumerate characters
+	x = syntax.NewVariable("X")
+	var digits []syntax.Term
+	for c := '0'; c <= '9'; c++ {
+		digits = append(digits, syntax.Atom(c))
+	}
+	testSolutions(t, p, x, goal(charType(x, digit(syntax.NewVariable("_")))), digits...)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(charType(x, upper(syntax.Atom("q")))), syntax.Atom("Q"))
+
+	// enumerate types
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(charType(syntax.Atom("5"), x)),
+		syntax.Atom("alnum"), syntax.Atom("alpha"), syntax.Atom("csym"), syntax.Atom("ascii"),
+		syntax.Atom("graph"), syntax.Atom("print"), digit(syntax.Integer(5)),
+		syntax.NewCompound("to_lower", syntax.Atom("5")), syntax.NewCompound("to_upper", syntax.Atom("5")))
+}
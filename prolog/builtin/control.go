@@ -0,0 +1,195 @@
+package builtin
+
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Control constructs, see http://www.swi-prolog.org/pldoc/man?section=control
+
+// True0 always succeeds.
+var True0 syntax.Clause = &builtin{
+	name:  "true",
+	nArgs: 0,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, true, nil
+	},
+}
+
+// Fail0 always fails.
+var Fail0 syntax.Clause = &builtin{
+	name:  "fail",
+	nArgs: 0,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, false, nil
+	},
+}
+
+// False0 is an alias for Fail0.
+var False0 syntax.Clause = &builtin{
+	name:  "false",
+	nArgs: 0,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, false, nil
+	},
+}
+
+// Not1 implements negation as failure, '\+'. It succeeds if its argument has
+// no solutions. The goal is evaluated on a copy of the argument, so bindings
+// made during evaluation are never visible to the caller.
+var Not1 syntax.Clause = &builtin{
+	name:  "\\+",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		r := p.Query(toGoal(syntax.Copy(args[0])))
+		defer r.Close()
+		if r.Next() {
+			return nil, false, nil
+		}
+		if err := r.Err(); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	},
+}
+
+// Forall2 implements forall(Cond, Action), which succeeds if Action succeeds
+// for every solution of Cond. Like \+, it's evaluated on a copy of its
+// arguments, so no bindings are made.
+var Forall2 syntax.Clause = &builtin{
+	name:  "forall",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		// copy both arguments together so they share variables
+		cp := syntax.Copy(syntax.NewCompound("forall", args...)).(*syntax.Compound).Args()
+		cond, action := cp[0], cp[1]
+		g, err := addArgs(cond, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		r := p.Query(toGoal(g))
+		defer r.Close()
+		for r.Next() {
+			ok, err := succeeds(p, action)
+			if err != nil || !ok {
+				return nil, false, err
+			}
+		}
+		return nil, r.Err() == nil, r.Err()
+	},
+}
+
+// Meta-call predicates call/1 through call/8. call(Goal, Arg1, ...) appends
+// the additional arguments to Goal before calling it.
+var (
+	Call1 = newCall(1)
+	Call2 = newCall(2)
+	Call3 = newCall(3)
+	Call4 = newCall(4)
+	Call5 = newCall(5)
+	Call6 = newCall(6)
+	Call7 = newCall(7)
+	Call8 = newCall(8)
+)
+
+func newCall(nArgs int) syntax.Clause {
+	return &builtin{
+		name:  "call",
+		nArgs: nArgs,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			goal, err := addArgs(args[0], args[1:])
+			if err != nil {
+				return nil, false, err
+			}
+			return toGoal(goal), true, nil
+		},
+	}
+}
+
+// addArgs appends arguments to a callable term.
+func addArgs(t syntax.Term, extra []syntax.Term) (syntax.Term, error) {
+	t = deref(t)
+	if len(extra) == 0 {
+		if t.Callable() == nil {
+			return nil, typeErr("callable", t)
+		}
+		return t, nil
+	}
+	switch t := t.(type) {
+	case syntax.Atom:
+		return syntax.NewCompound(t, extra...), nil
+	case *syntax.Compound:
+		return syntax.NewCompound(t.Functor(), append(t.Args(), extra...)...), nil
+	}
+	return nil, typeErr("callable", t)
+}
+
+// Once1 calls its argument, committing to its first solution. It's equivalent
+// to 'call(Goal), !'.
+var Once1 syntax.Clause = &builtin{
+	name:  "once",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		goal, err := addArgs(args[0], nil)
+		if err != nil {
+			return nil, false, err
+		}
+		terms := append(toGoal(goal).ToSlice(), syntax.Cut)
+		return syntax.GoalFromSlice(terms), true, nil
+	},
+}
+
+// Throw1 implements throw(Ball), raising a copy of Ball as a
+// *syntax.PrologError. The error unwinds evaluation until it's caught by
+// catch/3.
+var Throw1 syntax.Clause = &builtin{
+	name:  "throw",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); ok {
+			return nil, false, instantiationErr()
+		}
+		return nil, false, &syntax.PrologError{Term: syntax.Copy(args[0])}
+	},
+}
+
+// Catch3 implements catch(Goal, Catcher, Recovery). It behaves like
+// call(Goal), but if Goal raises an error whose term unifies with Catcher,
+// the bindings made by Goal are undone and Recovery is called instead.
+// Errors raised after Goal succeeds, including those of Recovery, aren't
+// caught.
+var Catch3 syntax.Clause = &generator{
+	name:  "catch",
+	nArgs: 3,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		goal, catcher, recovery := args[0], args[1], args[2]
+		var r *syntax.Results
+		done := false
+		return func() (*syntax.Goal, bool, error) {
+			if done {
+				return nil, false, nil
+			}
+			if r == nil {
+				g, err := addArgs(goal, nil)
+				if err != nil {
+					return nil, false, err
+				}
+				r = p.Query(toGoal(g))
+			}
+			if r.Next() {
+				return nil, true, nil
+			}
+			done = true
+			err := r.Err()
+			// restore the bindings held before the goal was called
+			r.Close()
+			e, ok := err.(*syntax.PrologError)
+			if !ok || !unifies(catcher, e.Term) {
+				return nil, false, err
+			}
+			catcher.Unify(e.Term)
+			g, err := addArgs(recovery, nil)
+			if err != nil {
+				return nil, false, err
+			}
+			return toGoal(g), true, nil
+		}
+	},
+}
@@ -0,0 +1,419 @@
+package builtin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// countSolutions queries the default program, returning the number of
+// solutions of the goal.
+func countSolutions(t *testing.T, goal *syntax.Goal) int {
+	return countProgSolutions(t, DefaultProg(), goal)
+}
+
+// countProgSolutions is like countSolutions, querying p.
+func countProgSolutions(t *testing.T, p *syntax.Prog, goal *syntax.Goal) int {
+	r := p.Query(goal)
+	n := 0
+	for r.Next() {
+		n++
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("%s: %v", goal, err)
+	}
+	return n
+}
+
+func TestTrueFail(t *testing.T) {
+	tests := []struct {
+		goal *syntax.Goal
+		exp  int
+	}{
+		{syntax.NewGoal(syntax.NewCompound("true")), 1},
+		{syntax.NewGoal(syntax.NewCompound("fail")), 0},
+		{syntax.NewGoal(syntax.NewCompound("false")), 0},
+		{syntax.NewGoal(syntax.Atom("true"), syntax.Atom("true")), 1},
+		{syntax.NewGoal(syntax.Atom("true"), syntax.Atom("fail")), 0},
+	}
+	for _, test := range tests {
+		if n := countSolutions(t, test.goal); n != test.exp {
+			t.Errorf("%s: expected %d solutions, got %d", test.goal, test.exp, n)
+		}
+	}
+}
+
+func TestNot(t *testing.T) {
+	not := func(t syntax.Term) syntax.Term { return syntax.NewCompound("\\+", t) }
+	likes := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("likes", a, b) }
+
+	p := DefaultProg()
+	p.Add(syntax.NewCompound("likes", syntax.Atom("bob"), syntax.Atom("pizza")))
+
+	x := syntax.NewVariable("X")
+	tests := []struct {
+		goal syntax.Term
+		exp  int
+	}{
+		{not(syntax.Atom("fail")), 1},
+		{not(syntax.Atom("true")), 0},
+		{not(likes(syntax.Atom("bob"), syntax.Atom("beer"))), 1},
+		{not(likes(syntax.Atom("bob"), x)), 0},
+		{not(not(likes(syntax.Atom("bob"), x))), 1},
+		{not(syntax.NewCompound(",", syntax.Atom("true"), syntax.Atom("fail"))), 1},
+	}
+	for _, test := range tests {
+		r := p.Query(syntax.NewGoal(test.goal))
+		n := 0
+		for r.Next() {
+			n++
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%s: %v", test.goal, err)
+		}
+		if n != test.exp {
+			t.Errorf("%s: expected %d solutions, got %d", test.goal, test.exp, n)
+		}
+	}
+	if x.Value() != nil {
+		t.Errorf("expected X to be unbound, got %s", x.Value())
+	}
+
+	// the argument must be callable
+	r := p.Query(syntax.NewGoal(not(syntax.NewVariable("Y"))))
+	if r.Next() || r.Err() == nil {
+		t.Errorf("expected error for unbound goal")
+	}
+}
+
+// consult parses a program and adds its clauses to p.
+func consult(t *testing.T, p *syntax.Prog, src string) {
+	clauses, err := parse.Parse(src)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	for _, c := range clauses {
+		p.Add(c)
+	}
+}
+
+func list(terms ...syntax.Term) syntax.Term { return syntax.NewList(terms) }
+
+func TestCall(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		likes(bob, pizza).
+		likes(bob, beer).
+	`)
+	call := func(args ...syntax.Term) *syntax.Goal {
+		return syntax.NewGoal(syntax.NewCompound("call", args...))
+	}
+
+	x := syntax.NewVariable("X")
+	r := p.Query(call(syntax.NewCompound("member", x), list(syntax.Integer(1), syntax.Integer(2), syntax.Integer(3))))
+	var got []syntax.Term
+	for r.Next() {
+		got = append(got, x.Value())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != syntax.Integer(1) || got[2] != syntax.Integer(3) {
+		t.Errorf("call(member(X), [1, 2, 3]): expected X = 1, 2, 3 got %v", got)
+	}
+
+	y := func() syntax.Term { return syntax.NewVariable("Y") }
+	tests := []struct {
+		goal *syntax.Goal
+		exp  int
+	}{
+		{call(syntax.Atom("true")), 1},
+		{call(syntax.Atom("fail")), 0},
+		{call(syntax.Atom("likes"), syntax.Atom("bob"), y()), 2},
+		{call(syntax.NewCompound("likes", syntax.Atom("bob")), syntax.Atom("beer")), 1},
+		{call(syntax.NewCompound(",", syntax.Atom("true"), syntax.NewCompound("likes", syntax.Atom("bob"), y()))), 2},
+		{call(bound("G", syntax.Atom("true"))), 1},
+	}
+	for _, test := range tests {
+		r := p.Query(test.goal)
+		n := 0
+		for r.Next() {
+			n++
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%s: %v", test.goal, err)
+		}
+		if n != test.exp {
+			t.Errorf("%s: expected %d solutions, got %d", test.goal, test.exp, n)
+		}
+	}
+
+	errs := []*syntax.Goal{
+		call(syntax.NewVariable("G")),
+		call(syntax.NewVariable("G"), syntax.Atom("foo")),
+		call(syntax.Integer(1)),
+		call(syntax.Integer(1), syntax.Atom("foo")),
+	}
+	for _, goal := range errs {
+		r := p.Query(goal)
+		if r.Next() || r.Err() == nil {
+			t.Errorf("%s: expected type error", goal)
+		}
+	}
+}
+
+func TestOnce(t *testing.T) {
+	p := DefaultProg()
+	once := func(t syntax.Term) syntax.Term { return syntax.NewCompound("once", t) }
+	member := func(x, l syntax.Term) syntax.Term { return syntax.NewCompound("member", x, l) }
+	nums := list(syntax.Integer(1), syntax.Integer(2), syntax.Integer(3))
+
+	x := syntax.NewVariable("X")
+	all, err := p.Query(syntax.NewGoal(once(member(x, nums)))).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0][x] != syntax.Integer(1) {
+		t.Errorf("once(member(X, [1, 2, 3])): expected X = 1, got %v", all)
+	}
+
+	// once only cuts the alternatives of its own goal
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	all, err = p.Query(syntax.NewGoal(
+		member(y, list(syntax.Atom("a"), syntax.Atom("b"))),
+		once(member(x, nums)),
+	)).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0][y] != syntax.Atom("a") || all[1][y] != syntax.Atom("b") {
+		t.Errorf("expected Y = a and Y = b, got %v", all)
+	}
+
+	if n := countSolutions(t, syntax.NewGoal(once(syntax.Atom("fail")))); n != 0 {
+		t.Errorf("once(fail): expected no solutions, got %d", n)
+	}
+}
+
+func TestCut(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		first(X, L) :- member(X, L), !.
+		pick(X) :- member(X, [a, b]).
+		pick(c).
+		cut_pick(X) :- member(X, [a, b]), !.
+		cut_pick(c).
+	`)
+	tests := []struct {
+		goal *syntax.Goal
+		exp  int
+	}{
+		{syntax.NewGoal(syntax.NewCompound("first", syntax.NewVariable("X"), list(syntax.Integer(1), syntax.Integer(2)))), 1},
+		{syntax.NewGoal(syntax.NewCompound("pick", syntax.NewVariable("X"))), 3},
+		{syntax.NewGoal(syntax.NewCompound("cut_pick", syntax.NewVariable("X"))), 1},
+		{syntax.NewGoal(
+			syntax.NewCompound("pick", syntax.NewVariable("X")),
+			syntax.NewCompound("cut_pick", syntax.NewVariable("Y")),
+		), 3},
+		{syntax.NewGoal(syntax.NewCompound("pick", syntax.NewVariable("X")), syntax.Cut), 1},
+		{syntax.NewGoal(syntax.Cut), 1},
+		{syntax.NewGoal(syntax.NewCompound("call", syntax.NewCompound(",",
+			syntax.NewCompound("pick", syntax.NewVariable("X")), syntax.Atom("!"),
+		))), 1},
+	}
+	for _, test := range tests {
+		r := p.Query(test.goal)
+		n := 0
+		for r.Next() {
+			n++
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%s: %v", test.goal, err)
+		}
+		if n != test.exp {
+			t.Errorf("%s: expected %d solutions, got %d", test.goal, test.exp, n)
+		}
+	}
+}
+
+func TestCatch(t *testing.T) {
+	catch := func(g, c, r syntax.Term) syntax.Term { return syntax.NewCompound("catch", g, c, r) }
+	throw := func(t syntax.Term) syntax.Term { return syntax.NewCompound("throw", t) }
+	and := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound(",", a, b) }
+	member := func(x, l syntax.Term) syntax.Term { return syntax.NewCompound("member", x, l) }
+	nums := list(syntax.Integer(1), syntax.Integer(2), syntax.Integer(3))
+	foo, bar := syntax.Atom("foo"), syntax.Atom("bar")
+
+	p := DefaultProg()
+	e := syntax.NewVariable("E")
+	testSolutions(t, p, e, goal(catch(throw(foo), e, syntax.Atom("true"))), foo)
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(catch(member(x, nums), syntax.NewVariable("_"), syntax.Atom("true"))),
+		syntax.Integer(1), syntax.Integer(2), syntax.Integer(3))
+
+	// cuts are local to the goal
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(catch(and(member(x, nums), syntax.Atom("!")), syntax.NewVariable("_"), syntax.Atom("true"))),
+		syntax.Integer(1))
+
+	// solutions found before the error are kept
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(catch(
+		and(member(x, nums), syntax.NewCompound("=<", x, syntax.Integer(1))),
+		syntax.NewVariable("_"), syntax.Atom("true"),
+	)), syntax.Integer(1))
+
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	found := func(t syntax.Term) syntax.Term { return syntax.NewCompound("found", t) }
+	testSolutions(t, p, y, goal(catch(
+		and(member(x, nums), and(syntax.NewCompound(">", x, syntax.Integer(1)), throw(found(x)))),
+		found(y), syntax.Atom("true"),
+	)), syntax.Integer(2))
+
+	// bindings made by the goal are undone before calling the recovery
+	x, e = syntax.NewVariable("X"), syntax.NewVariable("E")
+	all, err := p.Query(syntax.NewGoal(catch(
+		and(syntax.NewCompound("=", x, foo), throw(syntax.NewCompound("e", x))),
+		e, syntax.Atom("true"),
+	))).All()
+	if err != nil || len(all) != 1 {
+		t.Fatalf("expected 1 solution got %d %v", len(all), err)
+	}
+	if all[0][x] != nil {
+		t.Errorf("expected X to be unbound, got %s", all[0][x])
+	}
+	if exp := syntax.NewCompound("e", foo); syntax.Compare(all[0][e], exp) != 0 {
+		t.Errorf("expected E = %s got %s", exp, all[0][e])
+	}
+
+	// nested catches
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(catch(
+		catch(throw(foo), bar, syntax.NewCompound("=", x, bar)),
+		foo, syntax.NewCompound("=", x, foo),
+	)), foo)
+
+	// errors raised by builtins are ISO error terms
+	typ := syntax.NewVariable("T")
+	testSolutions(t, p, typ, goal(catch(
+		syntax.NewCompound("atom_length", syntax.NewCompound("f", foo), syntax.NewVariable("_")),
+		syntax.NewCompound("error", syntax.NewCompound("type_error", typ, syntax.NewVariable("_")), syntax.NewVariable("_")),
+		syntax.Atom("true"),
+	)), syntax.Atom("atom"))
+
+	tests := []struct {
+		goal syntax.Term
+		err  syntax.Term
+	}{
+		{throw(foo), foo},
+		{catch(throw(foo), bar, syntax.Atom("true")), foo},
+		{catch(throw(foo), syntax.NewVariable("_"), throw(bar)), bar},
+		{throw(syntax.NewVariable("_")), syntax.InstantiationErrorTerm()},
+		{catch(syntax.NewVariable("_"), syntax.NewVariable("_"), syntax.Atom("true")), syntax.InstantiationErrorTerm()},
+		{catch(syntax.Integer(1), syntax.NewVariable("_"), syntax.Atom("true")), syntax.TypeErrorTerm("callable", syntax.Integer(1))},
+	}
+	for _, test := range tests {
+		_, _, err := p.Query(syntax.NewGoal(test.goal)).First()
+		e, ok := err.(*syntax.PrologError)
+		switch {
+		case err == nil:
+			t.Errorf("%s: expected error", test.goal)
+		case !ok || !variant(e.Term, test.err):
+			t.Errorf("%s: expected exception %s got %v", test.goal, test.err, err)
+		}
+	}
+}
+
+func TestForall(t *testing.T) {
+	forall := func(c, a syntax.Term) syntax.Term { return syntax.NewCompound("forall", c, a) }
+	member := func(x, l syntax.Term) syntax.Term { return syntax.NewCompound("member", x, l) }
+	even := func(x syntax.Term) syntax.Term {
+		return syntax.NewCompound("is", syntax.Integer(0), syntax.NewCompound("mod", x, syntax.Integer(2)))
+	}
+	x := syntax.NewVariable("X")
+	tests := []struct {
+		goal syntax.Term
+		exp  int
+	}{
+		{forall(member(x, ints(2, 4, 6)), even(x)), 1},
+		{forall(member(x, ints(2, 3, 6)), even(x)), 0},
+		{forall(syntax.Atom("fail"), syntax.Atom("fail")), 1},
+		{forall(member(x, ints(1, 2)), syntax.NewCompound("=", x, syntax.Integer(1))), 0},
+	}
+	for _, test := range tests {
+		if n := countSolutions(t, syntax.NewGoal(test.goal)); n != test.exp {
+			t.Errorf("%s: expected %d solutions, got %d", test.goal, test.exp, n)
+		}
+	}
+
+	// no bindings are made
+	x = syntax.NewVariable("X")
+	all, err := DefaultProg().Query(syntax.NewGoal(forall(member(x, ints(1)), syntax.Atom("true")))).All()
+	if err != nil || len(all) != 1 || all[0][x] != nil {
+		t.Errorf("expected 1 solution leaving X unbound, got %v %v", all, err)
+	}
+
+	if _, _, err := DefaultProg().Query(syntax.NewGoal(forall(syntax.Integer(1), syntax.Atom("true")))).First(); err == nil {
+		t.Errorf("expected error for uncallable condition")
+	}
+}
+
+func TestQueryContextNested(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `loop :- loop.`)
+	for _, g := range []string{
+		`findall(X, loop, L)`,
+		`catch(loop, _, true)`,
+		`\+ loop`,
+		`forall(loop, true)`,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		done := make(chan error)
+		go func() {
+			_, _, err := p.QueryContext(ctx, toGoal(parseTerm(t, g))).First()
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != context.DeadlineExceeded {
+				t.Errorf("%s: expected %v, got %v", g, context.DeadlineExceeded, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: query was not cancelled", g)
+		}
+		cancel()
+	}
+}
+
+func TestQueryLimitsNested(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		loop :- loop.
+		deep :- deep.
+		deep.
+	`)
+	for _, g := range []string{`findall(X, loop, L)`, `catch(loop, _, true)`, `\+ loop`} {
+		if _, _, err := p.QueryWithLimit(toGoal(parseTerm(t, g)), 1000).First(); err != syntax.ErrStepLimitExceeded {
+			t.Errorf("%s: expected %v, got %v", g, syntax.ErrStepLimitExceeded, err)
+		}
+	}
+	// each call of deep leaves a choicepoint
+	for _, g := range []string{`findall(X, deep, L)`, `catch(deep, _, true)`, `\+ \+ deep`} {
+		if _, _, err := p.QueryWithDepth(toGoal(parseTerm(t, g)), 100).First(); err != syntax.ErrDepthLimitExceeded {
+			t.Errorf("%s: expected %v, got %v", g, syntax.ErrDepthLimitExceeded, err)
+		}
+	}
+
+	// nested queries count towards the limits of the query calling them
+	g := toGoal(parseTerm(t, `findall(X, member(X, [a, b, c]), L)`))
+	if _, _, err := p.QueryWithLimit(g, 3).First(); err != syntax.ErrStepLimitExceeded {
+		t.Errorf("%s: expected %v, got %v", g, syntax.ErrStepLimitExceeded, err)
+	}
+	if _, ok, err := p.QueryWithLimit(g, 100).First(); !ok || err != nil {
+		t.Errorf("%s: expected a solution, got %t %v", g, ok, err)
+	}
+}
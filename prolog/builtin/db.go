@@ -0,0 +1,365 @@
+package builtin
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Database, see http://www.swi-prolog.org/pldoc/man?section=db
+
+// toClause converts a term of the form 'Head :- Body', or a fact, to a clause.
+// The term is copied, so later bindings of its variables don't alter the
+// clause.
+func toClause(t syntax.Term) (syntax.Clause, error) {
+	t = syntax.Copy(t)
+	head, body := t, syntax.Term(nil)
+	if c, ok := t.(*syntax.Compound); ok && c.Functor() == ":-" && len(c.Args()) == 2 {
+		args := c.Args()
+		head, body = args[0], args[1]
+	}
+
+	var functor syntax.Atom
+	var args []syntax.Term
+	switch h := head.(type) {
+	case *syntax.Variable:
+		return nil, instantiationErr()
+	case syntax.Atom:
+		functor = h
+	case *syntax.Compound:
+		functor, args = h.Functor(), h.Args()
+	default:
+		return nil, typeErr("callable", h)
+	}
+
+	if body != nil {
+		if _, ok := body.(*syntax.Variable); ok {
+			return nil, instantiationErr()
+		}
+		if body.Callable() == nil {
+			return nil, typeErr("callable", body)
+		}
+		return syntax.NewRule(functor, args, toGoal(body)), nil
+	}
+	// facts with variables are rules without a body, so their variables are
+	// copied on each call
+	if !syntax.IsGround(head) {
+		return syntax.NewRule(functor, args, nil), nil
+	}
+	return syntax.NewCompound(functor, args...), nil
+}
+
+// newAssert creates a builtin which adds a clause to the program using add.
+func newAssert(name string, add func(p *syntax.Prog, c syntax.Clause)) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 1,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			c, err := toClause(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			add(p, c)
+			return nil, true, nil
+		},
+	}
+}
+
+// Asserta1, Assertz1 and Assert1 add a clause to the program. asserta adds the
+// clause before all other clauses of the predicate, while assertz and assert
+// add it after them.
+//
+// Goals which are already being evaluated don't see the new clause.
+var (
+	Asserta1 = newAssert("asserta", (*syntax.Prog).AddFirst)
+	Assertz1 = newAssert("assertz", (*syntax.Prog).Add)
+	Assert1  = newAssert("assert", (*syntax.Prog).Add)
+)
+
+// clauseParts returns the head and body of a user defined clause as terms.
+// Facts have a body of 'true'. ok is false for builtins.
+func clauseParts(c syntax.Clause) (head, body syntax.Term, ok bool) {
+	var h *syntax.Compound
+	var b *syntax.Goal
+	switch c := c.(type) {
+	case *syntax.Compound:
+		h = c
+	case *syntax.Rule:
+		h, b = c.Parts()
+	default:
+		return nil, nil, false
+	}
+	head = h
+	if len(h.Args()) == 0 {
+		head = h.Functor()
+	}
+	return head, fromGoal(b), true
+}
+
+// callableParts splits a term of the form 'Head :- Body' into its head and
+// body. Terms of other forms are returned as the head with a body of 'true'.
+func callableParts(t syntax.Term) (head, body syntax.Term, err error) {
+	head, body = deref(t), syntax.Atom("true")
+	if c, ok := head.(*syntax.Compound); ok && c.Functor() == ":-" && len(c.Args()) == 2 {
+		args := c.Args()
+		head, body = deref(args[0]), args[1]
+	}
+	switch head.(type) {
+	case *syntax.Variable:
+		return nil, nil, instantiationErr()
+	case syntax.Atom, *syntax.Compound:
+		return head, body, nil
+	}
+	return nil, nil, typeErr("callable", head)
+}
+
+// signature returns the name and arity of a callable term.
+func signature(t syntax.Term) (syntax.Atom, int) {
+	if c, ok := t.(*syntax.Compound); ok {
+		return c.Functor(), len(c.Args())
+	}
+	return t.(syntax.Atom), 0
+}
+
+// Retract1 implements retract(Clause), removing the first clause of the
+// program which unifies with Clause. Clause is either a fact or of the form
+// 'Head :- Body'.
+var Retract1 syntax.Clause = &builtin{
+	name:  "retract",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		head, body, err := callableParts(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		for _, c := range p.Clauses(signature(head)) {
+			h, b, ok := clauseParts(c)
+			if !ok {
+				continue
+			}
+			// attempt the match on a copy, so failed matches don't leave
+			// bindings behind
+			pattern := syntax.Copy(syntax.NewCompound(":-", head, body))
+			if !pattern.Unify(syntax.NewCompound(":-", h, b)) {
+				continue
+			}
+			if !p.RemoveClause(c) {
+				// retracted meanwhile by another query
+				continue
+			}
+			return nil, head.Unify(h) && body.Unify(b), nil
+		}
+		return nil, false, nil
+	},
+}
+
+// Retractall1 implements retractall(Head), removing all clauses whose head
+// unifies with Head. It always succeeds and never binds Head.
+var Retractall1 syntax.Clause = &builtin{
+	name:  "retractall",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		head := deref(args[0])
+		switch head.(type) {
+		case *syntax.Variable:
+			return nil, false, instantiationErr()
+		case syntax.Atom, *syntax.Compound:
+		default:
+			return nil, false, typeErr("callable", head)
+		}
+		for _, c := range p.Clauses(signature(head)) {
+			h, _, ok := clauseParts(c)
+			if ok && syntax.Copy(head).Unify(h) {
+				p.RemoveClause(c)
+			}
+		}
+		return nil, true, nil
+	},
+}
+
+// Abolish1 implements abolish(Name/Arity), removing all clauses of the
+// predicate. Unlike retractall/1, the predicate becomes undefined and calling
+// it is an existence error. Builtins can't be abolished.
+var Abolish1 syntax.Clause = &builtin{
+	name:  "abolish",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		pi := deref(args[0])
+		if _, ok := pi.(*syntax.Variable); ok {
+			return nil, false, instantiationErr()
+		}
+		c, ok := pi.(*syntax.Compound)
+		if !ok || c.Functor() != "/" || len(c.Args()) != 2 {
+			return nil, false, typeErr("predicate_indicator", pi)
+		}
+		name, arity := deref(c.Args()[0]), deref(c.Args()[1])
+		for _, arg := range []syntax.Term{name, arity} {
+			if _, ok := arg.(*syntax.Variable); ok {
+				return nil, false, instantiationErr()
+			}
+		}
+		functor, ok := name.(syntax.Atom)
+		if !ok {
+			return nil, false, typeErr("atom", name)
+		}
+		n, ok := arity.(syntax.Integer)
+		if !ok {
+			return nil, false, typeErr("integer", arity)
+		}
+		if n < 0 {
+			return nil, false, domainErr("not_less_than_zero", arity)
+		}
+		for _, c := range p.Clauses(functor, int(n)) {
+			if _, _, ok := clauseParts(c); !ok {
+				return nil, false, &syntax.PrologError{Term: syntax.PermissionErrorTerm(
+					syntax.Atom("modify"), syntax.Atom("static_procedure"), indicator(functor, int(n)))}
+			}
+		}
+		p.Abolish(functor, int(n))
+		return nil, true, nil
+	},
+}
+
+// Clause2 implements clause(Head, Body), which holds if the program has a
+// clause 'Head :- Body', where Body is 'true' for facts. clause backtracks
+// over each matching clause of the predicate, as it was when clause was
+// called. The clauses of builtins can't be accessed.
+var Clause2 syntax.Clause = &generator{
+	name:  "clause",
+	nArgs: 2,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		head, body := deref(args[0]), deref(args[1])
+		var err error
+		var clauses []syntax.Clause
+		switch head.(type) {
+		case *syntax.Variable:
+			err = instantiationErr()
+		case syntax.Atom, *syntax.Compound:
+			if _, ok := body.(*syntax.Variable); !ok && body.Callable() == nil {
+				err = typeErr("callable", body)
+				break
+			}
+			name, arity := signature(head)
+			clauses = p.Clauses(name, arity)
+			for _, c := range clauses {
+				if _, _, ok := clauseParts(c); !ok {
+					err = &syntax.PrologError{Term: syntax.PermissionErrorTerm(
+						syntax.Atom("access"), syntax.Atom("private_procedure"), indicator(name, arity))}
+				}
+			}
+		default:
+			err = typeErr("callable", head)
+		}
+		target := syntax.NewCompound(":-", head, body)
+		return func() (*syntax.Goal, bool, error) {
+			if err != nil {
+				return nil, false, err
+			}
+			for len(clauses) > 0 {
+				h, b, _ := clauseParts(clauses[0])
+				clauses = clauses[1:]
+				// rename the clause's variables, so they aren't bound
+				match := syntax.Copy(syntax.NewCompound(":-", h, b))
+				if unifies(target, match) {
+					return nil, target.Unify(match), nil
+				}
+			}
+			return nil, false, nil
+		}
+	},
+}
+
+// predicateHead returns the most general head of a predicate, such as
+// 'f(_, _)' for f/2.
+func predicateHead(name syntax.Atom, arity int) syntax.Term {
+	if arity == 0 {
+		return name
+	}
+	args := make([]syntax.Term, arity)
+	for i := range args {
+		args[i] = syntax.NewVariable("_")
+	}
+	return syntax.NewCompound(name, args...)
+}
+
+// predicateProperties returns the properties of a predicate reported by
+// predicate_property/2.
+func predicateProperties(p *syntax.Prog, name syntax.Atom, arity int) []syntax.Term {
+	clauses := p.Clauses(name, arity)
+	if len(clauses) == 0 {
+		return []syntax.Term{syntax.Atom("undefined")}
+	}
+	for _, c := range clauses {
+		if _, _, ok := clauseParts(c); !ok {
+			return []syntax.Term{syntax.Atom("defined"), syntax.Atom("built_in"), syntax.Atom("static")}
+		}
+	}
+	return []syntax.Term{
+		syntax.Atom("defined"),
+		syntax.Atom("dynamic"),
+		syntax.NewCompound("number_of_clauses", syntax.Integer(len(clauses))),
+	}
+}
+
+// PredicateProperty2 implements predicate_property(Head, Property), which
+// holds if the predicate of the callable term Head has the property:
+//
+//	defined               the predicate has clauses
+//	built_in              the predicate is a builtin
+//	static                the predicate can't be modified, true for builtins
+//	dynamic               the predicate can be modified by assert/1 and
+//	                      retract/1, true for all user defined predicates
+//	number_of_clauses(N)  a user defined predicate has N clauses
+//	undefined             the predicate has no clauses
+//
+// If Head is unbound, predicate_property backtracks over each predicate of
+// the program, and if Property is unbound, over each property.
+var PredicateProperty2 syntax.Clause = &generator{
+	name:  "predicate_property",
+	nArgs: 2,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		type pred struct {
+			name  syntax.Atom
+			arity int
+		}
+		var preds []pred
+		var err error
+		switch head := deref(args[0]).(type) {
+		case *syntax.Variable:
+			for _, s := range p.ListSignatures() {
+				i := strings.LastIndex(s, "/")
+				arity, _ := strconv.Atoi(s[i+1:])
+				preds = append(preds, pred{syntax.Atom(s[:i]), arity})
+			}
+		case syntax.Atom, *syntax.Compound:
+			name, arity := signature(head)
+			preds = append(preds, pred{name, arity})
+		default:
+			err = typeErr("callable", head)
+		}
+		target := syntax.NewCompound("-", args[0], args[1])
+		var props []syntax.Term
+		var head syntax.Term
+		return func() (*syntax.Goal, bool, error) {
+			if err != nil {
+				return nil, false, err
+			}
+			for {
+				for len(props) > 0 {
+					match := syntax.NewCompound("-", head, props[0])
+					props = props[1:]
+					if unifies(target, match) {
+						return nil, target.Unify(match), nil
+					}
+				}
+				if len(preds) == 0 {
+					return nil, false, nil
+				}
+				head = predicateHead(preds[0].name, preds[0].arity)
+				props = predicateProperties(p, preds[0].name, preds[0].arity)
+				preds = preds[1:]
+			}
+		}
+	},
+}
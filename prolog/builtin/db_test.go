@@ -0,0 +1,388 @@
+package builtin
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// solutions returns the values of v for each solution of the goal.
+func solutions(t *testing.T, p *syntax.Prog, v *syntax.Variable, goal ...syntax.Term) []syntax.Term {
+	all, err := p.Query(syntax.NewGoal(goal[0], goal[1:]...)).All()
+	if err != nil {
+		t.Errorf("%s: %v", goal, err)
+	}
+	vals := make([]syntax.Term, len(all))
+	for i, bindings := range all {
+		vals[i] = bindings[v]
+	}
+	return vals
+}
+
+// testSolutions asserts that the values of v for each solution of a goal
+// match exp.
+func testSolutions(t *testing.T, p *syntax.Prog, v *syntax.Variable, goal []syntax.Term, exp ...syntax.Term) {
+	got := solutions(t, p, v, goal...)
+	if len(got) != len(exp) {
+		t.Errorf("%s: expected %s = %s, got %s", goal, v, exp, got)
+		return
+	}
+	for i := range got {
+		if got[i] == nil || syntax.Compare(got[i], exp[i]) != 0 {
+			t.Errorf("%s: expected %s = %s, got %s", goal, v, exp, got)
+			return
+		}
+	}
+}
+
+func goal(terms ...syntax.Term) []syntax.Term { return terms }
+
+func TestAssert(t *testing.T) {
+	p := DefaultProg()
+	likes := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("likes", a, b) }
+	bob, x := syntax.Atom("bob"), syntax.NewVariable("X")
+
+	testSolutions(t, p, x, goal(likes(bob, x)))
+
+	a, b, c := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("c")
+	testSolutions(t, p, x, goal(
+		syntax.NewCompound("assert", likes(bob, b)),
+		syntax.NewCompound("assertz", likes(bob, c)),
+		syntax.NewCompound("asserta", likes(bob, a)),
+		syntax.NewCompound("=", x, syntax.Atom("ok")),
+	), syntax.Atom("ok"))
+	testSolutions(t, p, x, goal(likes(bob, x)), a, b, c)
+
+	// assert a rule, the asserted clause is independent of later bindings
+	y, z := syntax.NewVariable("Y"), syntax.NewVariable("Z")
+	rule := syntax.NewCompound(":-",
+		syntax.NewCompound("friend", y),
+		syntax.NewCompound(",", likes(y, z), syntax.NewCompound("==", z, c)),
+	)
+	testSolutions(t, p, y, goal(syntax.NewCompound("assertz", rule), syntax.NewCompound("=", y, bob)), bob)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("friend", x)), bob)
+
+	// clauses asserted during a query are seen by later goals
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(
+		syntax.NewCompound("assertz", syntax.NewCompound("counter", syntax.Integer(1))),
+		syntax.NewCompound("counter", x),
+	), syntax.Integer(1))
+
+	errs := []syntax.Term{
+		syntax.NewVariable("C"),
+		syntax.Integer(1),
+		syntax.NewCompound(":-", syntax.Atom("foo"), syntax.NewVariable("B")),
+		syntax.NewCompound(":-", syntax.Atom("foo"), syntax.Integer(1)),
+	}
+	for _, arg := range errs {
+		r := p.Query(syntax.NewGoal(syntax.NewCompound("assert", arg)))
+		if r.Next() || r.Err() == nil {
+			t.Errorf("assert(%s): expected error", arg)
+		}
+	}
+}
+
+func TestAssertOrder(t *testing.T) {
+	p := DefaultProg()
+	f := func(n int) syntax.Term { return syntax.NewCompound("f", syntax.Integer(n)) }
+	xs := syntax.NewVariable("Xs")
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, xs, goal(
+		syntax.NewCompound("assertz", f(1)),
+		syntax.NewCompound("asserta", f(0)),
+		syntax.NewCompound("assertz", f(2)),
+		syntax.NewCompound("asserta", f(-1)),
+		syntax.NewCompound("findall", x, syntax.NewCompound("f", x), xs),
+	), ints(-1, 0, 1, 2))
+
+	// once f/1 has been indexed, asserted clauses keep their order
+	testSolutions(t, p, x, goal(f(1), syntax.NewCompound("=", x, syntax.Atom("ok"))), syntax.Atom("ok"))
+	x, xs = syntax.NewVariable("X"), syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(
+		syntax.NewCompound("asserta", f(1)),
+		syntax.NewCompound("assertz", f(0)),
+		syntax.NewCompound("findall", x, syntax.NewCompound("f", x), xs),
+	), ints(1, -1, 0, 1, 2, 0))
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(syntax.NewCompound("findall", syntax.Atom("y"), f(1), xs)),
+		list(syntax.Atom("y"), syntax.Atom("y")))
+}
+
+func TestRetract(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		likes(bob, pizza).
+		likes(bob, beer).
+		likes(alice, beer).
+		likes(X, water) :- thirsty(X).
+		thirsty(bob).
+		counter(0).
+	`)
+	nLikes := func() int { return len(p.Clauses("likes", 2)) }
+	likes := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("likes", a, b) }
+	retract := func(t syntax.Term) syntax.Term { return syntax.NewCompound("retract", t) }
+	bob, beer := syntax.Atom("bob"), syntax.Atom("beer")
+
+	if n := nLikes(); n != 4 {
+		t.Fatalf("expected 4 clauses, got %d", n)
+	}
+
+	// retract the first matching clause and bind its variables
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(retract(likes(x, beer))), bob)
+	if n := nLikes(); n != 3 {
+		t.Errorf("expected 3 clauses, got %d", n)
+	}
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(likes(x, beer)), syntax.Atom("alice"))
+
+	// rules must match the body
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(retract(syntax.NewCompound(":-", likes(x, syntax.Atom("water")), syntax.Atom("true")))))
+	y, body := syntax.NewVariable("Y"), syntax.NewVariable("Body")
+	got := solutions(t, p, body, retract(syntax.NewCompound(":-", likes(y, syntax.Atom("water")), body)))
+	if len(got) != 1 {
+		t.Fatalf("expected 1 solution, got %v", got)
+	}
+	if c, ok := got[0].(*syntax.Compound); !ok || c.Functor() != "thirsty" || len(c.Args()) != 1 {
+		t.Errorf("expected Body = thirsty(_), got %s", got[0])
+	}
+	if n := nLikes(); n != 2 {
+		t.Errorf("expected 2 clauses, got %d", n)
+	}
+
+	// retract fails if nothing matches
+	if n := countSolutions(t, syntax.NewGoal(retract(likes(bob, syntax.Atom("nothing"))))); n != 0 {
+		t.Errorf("expected retract to fail")
+	}
+
+	// retract is commonly used to update a counter
+	n := syntax.NewVariable("N")
+	n1 := syntax.NewVariable("N1")
+	testSolutions(t, p, n1, goal(
+		retract(syntax.NewCompound("counter", n)),
+		syntax.NewCompound("is", n1, syntax.NewCompound("+", n, syntax.Integer(1))),
+		syntax.NewCompound("assert", syntax.NewCompound("counter", n1)),
+	), syntax.Integer(1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("counter", x)), syntax.Integer(1))
+}
+
+func TestRetractConcurrent(t *testing.T) {
+	p := DefaultProg()
+	const n = 1000
+	for i := 0; i < n; i++ {
+		p.Add(syntax.NewCompound("item", syntax.Integer(i)))
+	}
+
+	// each clause is retracted by exactly one goroutine
+	retracted := make(chan syntax.Term, 2*n)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				x := syntax.NewVariable("X")
+				bindings, ok, err := p.Query(syntax.NewGoal(syntax.NewCompound("retract", syntax.NewCompound("item", x)))).First()
+				if err != nil {
+					t.Error(err)
+				}
+				if !ok {
+					return
+				}
+				retracted <- bindings[x]
+			}
+		}()
+	}
+	wg.Wait()
+	close(retracted)
+	seen := map[syntax.Term]bool{}
+	for x := range retracted {
+		if seen[x] {
+			t.Errorf("item(%s) retracted twice", x)
+		}
+		seen[x] = true
+	}
+	if len(seen) != n {
+		t.Errorf("expected %d clauses to be retracted, got %d", n, len(seen))
+	}
+}
+
+func TestRetractall(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		likes(bob, pizza).
+		likes(bob, beer).
+		likes(alice, beer).
+		likes(X, water) :- thirsty(X).
+	`)
+	retractall := func(t syntax.Term) *syntax.Goal {
+		return syntax.NewGoal(syntax.NewCompound("retractall", t))
+	}
+
+	x := syntax.NewVariable("X")
+	if _, ok, err := p.Query(retractall(syntax.NewCompound("likes", x, syntax.Atom("beer")))).First(); !ok || err != nil {
+		t.Fatalf("retractall failed: %v", err)
+	}
+	if x.Value() != nil {
+		t.Errorf("retractall bound X to %s", x.Value())
+	}
+	if n := len(p.Clauses("likes", 2)); n != 2 {
+		t.Errorf("expected 2 clauses, got %d", n)
+	}
+
+	// always succeeds, even if nothing matches
+	if _, ok, err := p.Query(retractall(syntax.NewCompound("unknown", x))).First(); !ok || err != nil {
+		t.Errorf("expected retractall to succeed")
+	}
+
+	if _, ok, err := p.Query(retractall(syntax.NewCompound("likes", syntax.NewVariable("A"), syntax.NewVariable("B")))).First(); !ok || err != nil {
+		t.Fatalf("retractall failed: %v", err)
+	}
+	if n := len(p.Clauses("likes", 2)); n != 0 {
+		t.Errorf("expected no clauses, got %d", n)
+	}
+}
+
+func TestClause(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		likes(eric, pizza).
+		likes(eric, beer).
+		likes(bob, beer).
+		likes(X, water) :- thirsty(X), !.
+		thirsty(bob).
+	`)
+	clause := func(h, b syntax.Term) syntax.Term { return syntax.NewCompound("clause", h, b) }
+	likes := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("likes", a, b) }
+	eric, true_ := syntax.Atom("eric"), syntax.Atom("true")
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(clause(likes(eric, x), true_)), syntax.Atom("pizza"), syntax.Atom("beer"))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(clause(syntax.Atom("undefined"), x)))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(clause(syntax.NewCompound("undefined", syntax.Atom("a")), x)))
+
+	// rules
+	b := syntax.NewVariable("B")
+	got := solutions(t, p, b, clause(likes(eric, syntax.Atom("water")), b))
+	if exp := parseTerm(t, "(thirsty(eric), !)"); len(got) != 1 || !variant(got[0], exp) {
+		t.Errorf("expected body %s got %s", exp, got)
+	}
+	r := syntax.NewVariable("R")
+	x = syntax.NewVariable("X")
+	got = solutions(t, p, r, clause(likes(x, syntax.NewVariable("Y")), b), syntax.NewCompound("=", r, syntax.NewCompound("-", x, b)))
+	if exp := parseTerm(t, "[eric-true, eric-true, bob-true, A-(thirsty(A), !)]"); !variant(syntax.NewList(got), exp) {
+		t.Errorf("expected %s got %s", exp, got)
+	}
+
+	// the clauses aren't bound
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(clause(likes(eric, syntax.Atom("water")), syntax.NewVariable("_")), likes(x, syntax.Atom("water"))), syntax.Atom("bob"))
+
+	for _, g := range []syntax.Term{
+		clause(syntax.NewVariable("H"), syntax.NewVariable("B")),
+		clause(syntax.Integer(1), syntax.NewVariable("B")),
+		clause(likes(eric, x), syntax.Integer(1)),
+		clause(syntax.NewCompound("atom_length", syntax.Atom("a"), x), syntax.NewVariable("B")),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
+
+func TestPredicateProperty(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		likes(eric, pizza).
+		likes(bob, beer).
+	`)
+	prop := func(h, p syntax.Term) syntax.Term { return syntax.NewCompound("predicate_property", h, p) }
+	likes := syntax.NewCompound("likes", syntax.NewVariable("_"), syntax.NewVariable("_"))
+
+	tests := []struct {
+		goal syntax.Term
+		exp  int
+	}{
+		{prop(syntax.Atom("true"), syntax.Atom("built_in")), 1},
+		{prop(syntax.Atom("true"), syntax.Atom("dynamic")), 0},
+		{prop(likes, syntax.Atom("defined")), 1},
+		{prop(likes, syntax.Atom("dynamic")), 1},
+		{prop(likes, syntax.Atom("built_in")), 0},
+		{prop(syntax.Atom("nosuchpred"), syntax.Atom("defined")), 0},
+		{prop(syntax.Atom("nosuchpred"), syntax.Atom("undefined")), 1},
+	}
+	for _, test := range tests {
+		if n := len(solutions(t, p, nil, test.goal)); n != test.exp {
+			t.Errorf("%s: expected %d solutions got %d", test.goal, test.exp, n)
+		}
+	}
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(prop(likes, x)),
+		syntax.Atom("defined"), syntax.Atom("dynamic"), syntax.NewCompound("number_of_clauses", syntax.Integer(2)))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(prop(syntax.NewCompound("atom_length", syntax.Atom("a"), syntax.NewVariable("_")), x)),
+		syntax.Atom("defined"), syntax.Atom("built_in"), syntax.Atom("static"))
+
+	// enumerate the user defined predicates
+	h := syntax.NewVariable("H")
+	got := solutions(t, p, h, prop(h, syntax.Atom("dynamic")))
+	if len(got) != 1 || !variant(got[0], likes) {
+		t.Errorf("expected H = %s got %s", likes, got)
+	}
+
+	g := prop(syntax.Integer(1), syntax.NewVariable("P"))
+	if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+		t.Errorf("%s: expected error", g)
+	}
+}
+
+func TestAbolish(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		likes(eric, pizza).
+		likes(bob, beer).
+	`)
+	abolish := func(pi syntax.Term) syntax.Term { return syntax.NewCompound("abolish", pi) }
+	likesPI := syntax.NewCompound("/", syntax.Atom("likes"), syntax.Integer(2))
+	likes := syntax.NewCompound("likes", syntax.NewVariable("X"), syntax.NewVariable("Y"))
+
+	if _, ok, err := p.Query(syntax.NewGoal(abolish(likesPI))).First(); !ok || err != nil {
+		t.Fatalf("abolish failed: %v", err)
+	}
+	_, _, err := p.Query(syntax.NewGoal(likes)).First()
+	exp := syntax.ExistenceErrorTerm(syntax.Atom("procedure"), likesPI)
+	if e, ok := err.(*syntax.PrologError); !ok || !variant(e.Term, exp) {
+		t.Errorf("%s: expected %s got %v", likes, exp, err)
+	}
+	if n := len(solutions(t, p, nil, syntax.NewCompound("predicate_property", likes, syntax.Atom("defined")))); n != 0 {
+		t.Errorf("expected likes/2 to be undefined")
+	}
+
+	// asserting a clause defines the predicate again
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(
+		syntax.NewCompound("assertz", syntax.NewCompound("likes", syntax.Atom("alice"), syntax.Atom("tea"))),
+		syntax.NewCompound("likes", x, syntax.NewVariable("_")),
+	), syntax.Atom("alice"))
+
+	for _, pi := range []syntax.Term{
+		syntax.NewVariable("PI"),
+		syntax.Atom("likes"),
+		syntax.NewCompound("/", syntax.Atom("likes"), syntax.NewVariable("N")),
+		syntax.NewCompound("/", syntax.Integer(1), syntax.Integer(2)),
+		syntax.NewCompound("/", syntax.Atom("likes"), syntax.Integer(-1)),
+		syntax.NewCompound("/", syntax.Atom("atom_length"), syntax.Integer(2)),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(abolish(pi))).First(); err == nil {
+			t.Errorf("abolish(%s): expected error", pi)
+		}
+	}
+}
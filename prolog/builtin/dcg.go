@@ -0,0 +1,38 @@
+package builtin
+
+import (
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Calling grammar rules, see http://www.swi-prolog.org/pldoc/man?section=DCG
+
+// Phrase2 implements phrase(Body, List), which holds if the grammar rule
+// body parses all of List. It's equivalent to phrase(Body, List, []).
+var Phrase2 = newPhrase(2)
+
+// Phrase3 implements phrase(Body, List, Rest), which holds if the grammar
+// rule body parses a prefix of List, leaving Rest. Body is usually the name
+// of a non-terminal, but may be any grammar rule body, such as '[a], b'.
+var Phrase3 = newPhrase(3)
+
+func newPhrase(nArgs int) syntax.Clause {
+	return &builtin{
+		name:  "phrase",
+		nArgs: nArgs,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			body, list, rest := deref(args[0]), args[1], syntax.EmptyList
+			if nArgs == 3 {
+				rest = args[2]
+			}
+			if body.Callable() == nil {
+				return nil, false, typeErr("callable", body)
+			}
+			goal, err := parse.ExpandDCGBody(body, list, rest)
+			if err != nil {
+				return nil, false, typeErr("callable", body)
+			}
+			return goal, true, nil
+		},
+	}
+}
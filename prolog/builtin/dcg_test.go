@@ -0,0 +1,77 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestPhrase(t *testing.T) {
+	p := DefaultProg()
+	err := parse.LoadString(p, `
+		ab --> [a], [b].
+		as --> [].
+		as --> [a], as.
+		greeting(Name) --> [hello], [Name].
+		hi --> "hi".
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := func(s ...string) syntax.Term {
+		var terms []syntax.Term
+		for _, w := range s {
+			terms = append(terms, syntax.Atom(w))
+		}
+		return syntax.NewList(terms)
+	}
+	phrase := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("phrase", args...) }
+	ab := syntax.Atom("ab")
+
+	tests := []struct {
+		goal syntax.Term
+		exp  int
+	}{
+		{phrase(ab, words("a", "b")), 1},
+		{phrase(ab, words("a", "b", "c")), 0},
+		{phrase(ab, words("a")), 0},
+		{phrase(ab, words("a", "b"), syntax.EmptyList), 1},
+		{phrase(syntax.Atom("as"), words("a", "a", "a")), 1},
+		{phrase(syntax.NewCompound(",", words("a"), ab), words("a", "a", "b")), 1},
+		{phrase(syntax.EmptyList, syntax.EmptyList), 1},
+		{phrase(syntax.Atom("hi"), ints(104, 105)), 1},
+		{phrase(syntax.Atom("hi"), words("h", "i")), 0},
+	}
+	for _, test := range tests {
+		all, err := p.Query(syntax.NewGoal(test.goal)).All()
+		if err != nil {
+			t.Errorf("%s: %v", test.goal, err)
+		} else if len(all) != test.exp {
+			t.Errorf("%s: expected %d solutions got %d", test.goal, test.exp, len(all))
+		}
+	}
+
+	rest := syntax.NewVariable("Rest")
+	testSolutions(t, p, rest, goal(phrase(ab, words("a", "b", "c"), rest)), words("c"))
+	rest = syntax.NewVariable("Rest")
+	testSolutions(t, p, rest, goal(phrase(syntax.Atom("as"), words("a", "a"), rest)),
+		words("a", "a"), words("a"), words())
+
+	// non-terminal arguments and {} goals bind the caller's variables
+	name := syntax.NewVariable("Name")
+	testSolutions(t, p, name, goal(phrase(syntax.NewCompound("greeting", name), words("hello", "bob"), syntax.NewVariable("R"))),
+		syntax.Atom("bob"))
+	y, z := syntax.NewVariable("Y"), syntax.NewVariable("Z")
+	body := syntax.NewCompound(",", syntax.NewList([]syntax.Term{z}), syntax.NewCompound("{}", syntax.NewCompound("=", y, z)))
+	testSolutions(t, p, y, goal(phrase(body, words("a"))), syntax.Atom("a"))
+
+	for _, g := range []syntax.Term{
+		phrase(syntax.NewVariable("G"), words("a")),
+		phrase(syntax.Integer(1), words("a")),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package builtin
+
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Global variables, see http://www.swi-prolog.org/pldoc/man?section=gvar
+
+// globalName returns the name of a global variable.
+func globalName(t syntax.Term) (syntax.Atom, error) {
+	name, ok := deref(t).(syntax.Atom)
+	if !ok {
+		return "", typeErr("atom", t)
+	}
+	return name, nil
+}
+
+// NbSetval2 implements nb_setval(Name, Value), storing a copy of Value in the
+// global variable Name. The assignment isn't undone on backtracking.
+var NbSetval2 syntax.Clause = &builtin{
+	name:  "nb_setval",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		name, err := globalName(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		p.SetGlobal(name, args[1])
+		return nil, true, nil
+	},
+}
+
+// NbGetval2 implements nb_getval(Name, Value), unifying Value with the value
+// of the global variable Name. It's an existence error if Name hasn't been
+// set.
+var NbGetval2 syntax.Clause = &builtin{
+	name:  "nb_getval",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		name, err := globalName(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		value, ok := p.Global(name)
+		if !ok {
+			return nil, false, &syntax.PrologError{Term: syntax.ExistenceErrorTerm(syntax.Atom("variable"), name)}
+		}
+		return nil, args[1].Unify(value), nil
+	},
+}
+
+// Flag3 implements flag(Name, Old, New). Old is unified with the value of the
+// flag Name, then the flag is set to the value of the arithmetic expression
+// New. Flags start at 0. If Old doesn't unify, flag/3 fails and the flag
+// keeps its value.
+var Flag3 syntax.Clause = &builtin{
+	name:  "flag",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		name, err := globalName(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		matches := false
+		err = p.UpdateFlag(name, func(old syntax.Term) (syntax.Term, error) {
+			if matches = args[1].Unify(old); !matches {
+				return nil, nil
+			}
+			return EvalArith(args[2])
+		})
+		return nil, matches, err
+	},
+}
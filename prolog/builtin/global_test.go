@@ -0,0 +1,80 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestGlobals(t *testing.T) {
+	p := DefaultProg()
+	c := syntax.Atom("counter")
+	n, n1 := syntax.NewVariable("N"), syntax.NewVariable("N1")
+	incr := syntax.NewCompound(",",
+		syntax.NewCompound("member", syntax.NewVariable("_"), ints(1, 2, 3)),
+		syntax.NewCompound(",",
+			syntax.NewCompound("nb_getval", c, n),
+			syntax.NewCompound(",",
+				syntax.NewCompound("is", n1, syntax.NewCompound("+", n, syntax.Integer(1))),
+				syntax.NewCompound("nb_setval", c, n1),
+			),
+		),
+	)
+	// the counter keeps its value as findall/3 backtracks over each member
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(
+		syntax.NewCompound("nb_setval", c, syntax.Integer(0)),
+		syntax.NewCompound("findall", syntax.NewVariable("_"), incr, syntax.NewVariable("_")),
+		syntax.NewCompound("nb_getval", c, x),
+	), syntax.Integer(3))
+
+	// values are copied, so binding the original doesn't alter them
+	y, z := syntax.NewVariable("Y"), syntax.NewVariable("Z")
+	testSolutions(t, p, z, goal(
+		syntax.NewCompound("nb_setval", syntax.Atom("term"), syntax.NewCompound("f", y)),
+		syntax.NewCompound("=", y, syntax.Atom("a")),
+		syntax.NewCompound("nb_getval", syntax.Atom("term"), syntax.NewCompound("f", z)),
+		syntax.NewCompound("var", z),
+		syntax.NewCompound("=", z, syntax.Atom("ok")),
+	), syntax.Atom("ok"))
+
+	for _, g := range []syntax.Term{
+		syntax.NewCompound("nb_getval", syntax.Atom("unknown"), syntax.NewVariable("_")),
+		syntax.NewCompound("nb_getval", syntax.NewVariable("_"), syntax.NewVariable("_")),
+		syntax.NewCompound("nb_setval", syntax.Integer(1), syntax.Atom("a")),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
+
+func TestFlag(t *testing.T) {
+	p := DefaultProg()
+	c := syntax.Atom("counter")
+	for i := 0; i < 3; i++ {
+		x := syntax.NewVariable("X")
+		testSolutions(t, p, x, goal(syntax.NewCompound("flag", c, x, syntax.NewCompound("+", x, syntax.Integer(1)))), syntax.Integer(i))
+	}
+
+	// the flag keeps its value if Old doesn't unify
+	testSolutions(t, p, nil, goal(syntax.NewCompound("flag", c, syntax.Integer(0), syntax.Integer(100))))
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(
+		syntax.NewCompound("flag", c, syntax.NewVariable("_"), syntax.Integer(0)),
+		syntax.NewCompound("flag", c, x, x),
+	), syntax.Integer(0))
+
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("flag", syntax.Atom("other"), x, syntax.Float64(1.5))), syntax.Integer(0))
+
+	for _, g := range []syntax.Term{
+		syntax.NewCompound("flag", c, syntax.NewVariable("_"), syntax.Atom("a")),
+		syntax.NewCompound("flag", syntax.NewVariable("_"), syntax.NewVariable("_"), syntax.Integer(1)),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
@@ -1,11 +1,550 @@
 package builtin
 
-type write1 struct {
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// writeOpts controls how terms are formatted.
+type writeOpts struct {
+	quoted     bool // quote atoms which can't be read back as is
+	ignoreOps  bool // write operators in functional notation
+	numberVars bool // write '$VAR'(N) and '$VAR'(Name) terms as variable names
+
+	// visiting holds the bound variables whose values are being written. A
+	// variable found again while its value is written is part of a cyclic
+	// term, such as the value of X after 'X = f(X)', and is written as is.
+	visiting map[*syntax.Variable]bool
+}
+
+// formatTerm returns the text representation of a term.
+func formatTerm(t syntax.Term, opts writeOpts) string {
+	opts.visiting = map[*syntax.Variable]bool{}
+	return opts.term(t, 1200)
+}
+
+// term formats a term appearing in a context of precedence prec.
+func (o writeOpts) term(t syntax.Term, prec int) string {
+	if v, ok := t.(*syntax.Variable); ok && v.Value() != nil {
+		if o.visiting[v] {
+			return fmt.Sprint(v)
+		}
+		o.visiting[v] = true
+		defer delete(o.visiting, v)
+	}
+	switch t := deref(t).(type) {
+	case syntax.Atom:
+		s := o.atom(t)
+		if prec < 999 && isOp(string(t)) {
+			return "(" + s + ")"
+		}
+		return s
+	case syntax.String:
+		return o.str(t)
+	case syntax.Float64:
+		return formatFloat(t)
+	case *syntax.Compound:
+		return o.compound(t, prec)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func (o writeOpts) compound(c *syntax.Compound, prec int) string {
+	name, args := string(c.Functor()), c.Args()
+	if len(args) == 0 {
+		return o.atom(c.Functor())
+	}
+	if name == "." && len(args) == 2 {
+		return o.list(c)
+	}
+	if o.numberVars && name == "$VAR" && len(args) == 1 {
+		switch n := deref(args[0]).(type) {
+		case syntax.Integer:
+			if n >= 0 {
+				return varName(int(n))
+			}
+		case syntax.Atom:
+			// the name of a variable, such as '$VAR'('Foo')
+			return string(n)
+		}
+	}
+	if !o.ignoreOps {
+		if s, ok := o.operator(name, args, prec); ok {
+			return s
+		}
+	}
+	var b strings.Builder
+	b.WriteString(o.atom(c.Functor()))
+	b.WriteString("(")
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(o.term(arg, 999))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// list formats a list using the bracket notation, such as '[a,b|T]'.
+func (o writeOpts) list(c *syntax.Compound) string {
+	var b strings.Builder
+	b.WriteString("[")
+	var t syntax.Term = c
+	for i := 0; ; i++ {
+		l, ok := t.(*syntax.Compound)
+		if !ok || l.Functor() != "." || len(l.Args()) != 2 {
+			break
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		args := l.Args()
+		b.WriteString(o.term(args[0], 999))
+		if v, ok := args[1].(*syntax.Variable); ok && v.Value() != nil {
+			if o.visiting[v] {
+				// a cyclic list, such as the value of L after 'L = [a|L]'
+				t = v
+				break
+			}
+			o.visiting[v] = true
+			defer delete(o.visiting, v)
+		}
+		t = deref(args[1])
+	}
+	if t != syntax.EmptyList {
+		b.WriteString("|")
+		b.WriteString(o.term(t, 999))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// operator formats a compound term using operator notation, reporting false
+// if the functor isn't an operator of the term's arity.
+func (o writeOpts) operator(name string, args []syntax.Term, prec int) (string, bool) {
+	var (
+		s      string
+		opPrec int
+	)
+	switch len(args) {
+	case 2:
+		op, ok := parse.InfixOp(name)
+		if !ok {
+			return "", false
+		}
+		left, right := op.ArgPrecs()
+		opPrec = op.Prec
+		s = o.term(args[0], left)
+		switch {
+		case name == ",":
+			s += "," + o.term(args[1], right)
+		case isAlphaNumericAtom(name):
+			s += " " + o.atom(syntax.Atom(name)) + " " + o.term(args[1], right)
+		default:
+			s = glue(glue(s, o.atom(syntax.Atom(name))), o.term(args[1], right))
+		}
+	case 1:
+		if op, ok := parse.PrefixOp(name); ok {
+			_, right := op.ArgPrecs()
+			opPrec = op.Prec
+			arg := o.term(args[0], right)
+			switch deref(args[0]).(type) {
+			case syntax.Integer, syntax.Float64:
+				// '- 1' is the compound -(1), while '-1' is a number
+				s = o.atom(syntax.Atom(name)) + " " + arg
+			default:
+				if isAlphaNumericAtom(name) || strings.HasPrefix(arg, "(") {
+					s = o.atom(syntax.Atom(name)) + " " + arg
+				} else {
+					s = glue(o.atom(syntax.Atom(name)), arg)
+				}
+			}
+		} else if op, ok := parse.PostfixOp(name); ok {
+			left, _ := op.ArgPrecs()
+			opPrec = op.Prec
+			s = glue(o.term(args[0], left), o.atom(syntax.Atom(name)))
+		} else {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	if opPrec > prec {
+		s = "(" + s + ")"
+	}
+	return s, true
 }
 
-var Write1 = write1{}
+// varName returns the name written for the term '$VAR'(n): A through Z for
+// the first 26, then A1 through Z1 and so on.
+func varName(n int) string {
+	s := string(rune('A' + n%26))
+	if n >= 26 {
+		s += strconv.Itoa(n / 26)
+	}
+	return s
+}
+
+// atom formats an atom, quoting it if required.
+func (o writeOpts) atom(a syntax.Atom) string {
+	s := string(a)
+	if !o.quoted || !needsQuotes(s) {
+		return s
+	}
+	return quoteText(s, '\'')
+}
+
+// str formats a string, which is written within double quotes if quoted.
+func (o writeOpts) str(s syntax.String) string {
+	if !o.quoted {
+		return string(s)
+	}
+	return quoteText(string(s), '"')
+}
+
+// quoteText returns s within the quote character q, escaping q and any
+// characters that can't appear as is.
+func quoteText(s string, q rune) string {
+	var b strings.Builder
+	b.WriteRune(q)
+	for _, r := range s {
+		switch r {
+		case q:
+			b.WriteRune('\\')
+			b.WriteRune(q)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteRune(q)
+	return b.String()
+}
+
+// needsQuotes reports whether an atom must be quoted to be read back as the
+// same atom.
+func needsQuotes(s string) bool {
+	switch s {
+	case "", ",", "|":
+		return true
+	case "[]", "!", ";":
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(s); unicode.IsLower(r) {
+		return !isAlphaNumericAtom(s)
+	}
+	if strings.HasPrefix(s, "/*") {
+		// read as the start of a comment
+		return true
+	}
+	for _, r := range s {
+		if !isSymbolChar(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAlphaNumericAtom reports whether s consists of letters, digits and
+// underscores, starting with a lower case letter.
+func isAlphaNumericAtom(s string) bool {
+	for i, r := range s {
+		if i == 0 && !unicode.IsLower(r) {
+			return false
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isSymbolChar(r rune) bool {
+	return strings.ContainsRune(`\+-*/=<>:&.^~?@#$`, r)
+}
 
-type write2 struct {
+// isOp reports whether an atom is defined as an operator.
+func isOp(name string) bool {
+	_, prefix := parse.PrefixOp(name)
+	_, infix := parse.InfixOp(name)
+	_, postfix := parse.PostfixOp(name)
+	return prefix || infix || postfix
 }
 
-var Write2 = write2{}
+// glue concatenates two formatted terms, separating them with a space if
+// they would otherwise be read as a single token.
+func glue(a, b string) string {
+	x, _ := utf8.DecodeLastRuneInString(a)
+	y, _ := utf8.DecodeRuneInString(b)
+	alnum := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	if (isSymbolChar(x) && isSymbolChar(y)) || (alnum(x) && alnum(y)) {
+		return a + " " + b
+	}
+	return a + b
+}
+
+// formatFloat formats a float so it's always distinguishable from an integer,
+// such as '2.0' instead of '2'.
+func formatFloat(f syntax.Float64) string {
+	s := strconv.FormatFloat(float64(f), 'g', -1, 64)
+	if strings.ContainsAny(s, ".IN") {
+		return s
+	}
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
+}
+
+// newWrite returns a builtin which writes its argument to the output.
+func newWrite(name string, opts writeOpts) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 1,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			if _, err := io.WriteString(p.Output(), formatTerm(args[0], opts)); err != nil {
+				return nil, false, err
+			}
+			return nil, true, nil
+		},
+	}
+}
+
+// Write1 writes a term to the output, using operator notation where possible.
+// Terms of the form '$VAR'(N) are written as variable names, see Numbervars3.
+var Write1 = newWrite("write", writeOpts{numberVars: true})
+
+// Writeq1 writes a term like Write1, quoting atoms so the output can be read
+// back as the same term.
+var Writeq1 = newWrite("writeq", writeOpts{quoted: true, numberVars: true})
+
+// WriteCanonical1 writes a term with quoted atoms, ignoring operators.
+var WriteCanonical1 = newWrite("write_canonical", writeOpts{quoted: true, ignoreOps: true})
+
+// Nl0 writes a newline to the output.
+var Nl0 syntax.Clause = &builtin{
+	name:  "nl",
+	nArgs: 0,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, err := io.WriteString(p.Output(), "\n"); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	},
+}
+
+// formatErr returns the error raised by format/2 when the format doesn't
+// match its arguments, 'error(format(Msg), _)'.
+func formatErr(msg string) error {
+	formal := syntax.NewCompound("format", syntax.Atom(msg))
+	return &syntax.PrologError{Term: syntax.NewCompound("error", formal, syntax.NewVariable("_"))}
+}
+
+// format writes args to w as directed by the format string f, see Format2.
+func format(w io.Writer, f syntax.Term, args []syntax.Term) error {
+	s, err := textArg(f)
+	if err != nil {
+		return err
+	}
+	next := func() (syntax.Term, error) {
+		if len(args) == 0 {
+			return nil, formatErr("not enough arguments")
+		}
+		arg := deref(args[0])
+		args = args[1:]
+		return arg, nil
+	}
+
+	var b strings.Builder
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '~')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i+1:]
+
+		// an optional numeric argument, such as the digits of '~2f'
+		n := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+		if n < 0 {
+			return formatErr("truncated directive")
+		}
+		num := -1
+		if n > 0 {
+			num, _ = strconv.Atoi(s[:n])
+		}
+		c := s[n]
+		s = s[n+1:]
+
+		switch c {
+		case '~':
+			b.WriteByte('~')
+		case 'n':
+			for i := 0; i < num || i == 0; i++ {
+				b.WriteByte('\n')
+			}
+		case 't':
+			b.WriteByte('\t')
+		case 'w', 'q':
+			arg, err := next()
+			if err != nil {
+				return err
+			}
+			b.WriteString(formatTerm(arg, writeOpts{quoted: c == 'q', numberVars: true}))
+		case 'a':
+			arg, err := next()
+			if err != nil {
+				return err
+			}
+			text, err := textArg(arg)
+			if err != nil {
+				return err
+			}
+			b.WriteString(text)
+		case 'd':
+			arg, err := next()
+			if err != nil {
+				return err
+			}
+			i, ok := arg.(syntax.Integer)
+			if !ok {
+				return typeErr("integer", arg)
+			}
+			b.WriteString(i.String())
+		case 'f':
+			arg, err := next()
+			if err != nil {
+				return err
+			}
+			var f float64
+			switch n := arg.(type) {
+			case syntax.Integer:
+				f = float64(n)
+			case syntax.Float64:
+				f = float64(n)
+			default:
+				return typeErr("number", arg)
+			}
+			if num < 0 {
+				num = 6
+			}
+			b.WriteString(strconv.FormatFloat(f, 'f', num, 64))
+		default:
+			return formatErr(fmt.Sprintf("unknown directive ~%c", c))
+		}
+	}
+	if len(args) > 0 {
+		return formatErr("too many arguments")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// Format2 writes formatted output, where the first argument is an atom or
+// string with directives such as '~w' which consume the list of arguments in
+// the second:
+//
+//	~w   writes the next argument with write/1
+//	~q   writes the next argument with writeq/1
+//	~a   writes the next argument, which must be an atom or string
+//	~d   writes the next argument, which must be an integer
+//	~Nf  writes the next argument as a float with N digits, 6 by default
+//	~n   writes a newline
+//	~t   writes a tab
+//	~~   writes a '~'
+//
+// If the second argument isn't a list, it's treated as a single argument.
+var Format2 syntax.Clause = &builtin{
+	name:  "format",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		fargs, err := syntax.ListToSlice(args[1])
+		if _, tail := partialList(args[1]); tail != syntax.EmptyList {
+			if _, ok := tail.(*syntax.Variable); !ok {
+				fargs, err = []syntax.Term{args[1]}, nil
+			}
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if err := format(p.Output(), args[0], fargs); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	},
+}
+
+// outputSink parses the sink of with_output_to/2, such as atom(A), returning
+// the sink's argument and a function converting output to the term it's
+// unified with.
+func outputSink(t syntax.Term) (text func(string) syntax.Term, arg syntax.Term, err error) {
+	switch c := deref(t).(type) {
+	case *syntax.Variable:
+		return nil, nil, instantiationErr()
+	case *syntax.Compound:
+		if len(c.Args()) != 1 {
+			break
+		}
+		switch c.Functor() {
+		case "atom":
+			return func(s string) syntax.Term { return syntax.Atom(s) }, c.Args()[0], nil
+		case "string":
+			return stringTerm, c.Args()[0], nil
+		case "codes":
+			return codes, c.Args()[0], nil
+		case "chars":
+			return chars, c.Args()[0], nil
+		}
+	}
+	return nil, nil, domainErr("output_sink", t)
+}
+
+// WithOutputTo2 implements with_output_to(Sink, Goal), calling Goal like
+// once/1 with all output redirected, then unifying Sink with the output.
+// Sink is one of atom(A), string(S), codes(Codes) or chars(Chars).
+var WithOutputTo2 syntax.Clause = &builtin{
+	name:  "with_output_to",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		text, sink, err := outputSink(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		goal := syntax.Copy(args[1])
+		g, err := addArgs(goal, nil)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var b strings.Builder
+		p.PushOutput(&b)
+		r := p.Query(toGoal(g))
+		ok := r.Next()
+		if ok {
+			goal = syntax.Copy(goal)
+		}
+		err = r.Err()
+		r.Close()
+		p.PopOutput()
+
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		return nil, args[1].Unify(goal) && sink.Unify(text(b.String())), nil
+	},
+}
@@ -0,0 +1,303 @@
+package builtin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// parseTerm parses the source of a single term.
+func parseTerm(t *testing.T, src string) syntax.Term {
+	clauses, err := parse.Parse("t(" + src + ").")
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	switch c := clauses[0].(type) {
+	case *syntax.Compound:
+		return c.Args()[0]
+	case *syntax.Rule:
+		head, _ := c.Parts()
+		return head.Args()[0]
+	}
+	t.Fatalf("%s: unexpected clause %s", src, clauses[0])
+	return nil
+}
+
+// captureOutput calls fn with a program whose output is captured, returning
+// everything written.
+func captureOutput(fn func(p *syntax.Prog)) string {
+	var b bytes.Buffer
+	p := DefaultProg()
+	p.SetOutput(&b)
+	fn(p)
+	return b.String()
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		term                     string
+		write, writeq, canonical string
+	}{
+		{"foo", "foo", "foo", "foo"},
+		{"'hello world'", "hello world", "'hello world'", "'hello world'"},
+		{"'Foo'", "Foo", "'Foo'", "'Foo'"},
+		{"'it''s'", "it's", `'it\'s'`, `'it\'s'`},
+		{"[]", "[]", "[]", "[]"},
+		{"'[]'(a)", "[](a)", "[](a)", "[](a)"},
+		{"1.5", "1.5", "1.5", "1.5"},
+		{"2.0", "2.0", "2.0", "2.0"},
+		{"-3", "-3", "-3", "-3"},
+		{"f(a, 'B', 1)", "f(a,B,1)", "f(a,'B',1)", "f(a,'B',1)"},
+		{"'my f'(x)", "my f(x)", "'my f'(x)", "'my f'(x)"},
+		{"[a, b, c]", "[a,b,c]", "[a,b,c]", "[a,b,c]"},
+		{"[a, 'B'|c]", "[a,B|c]", "[a,'B'|c]", "[a,'B'|c]"},
+		{"[[1], f(x)]", "[[1],f(x)]", "[[1],f(x)]", "[[1],f(x)]"},
+		{"1 + 2 * 3", "1+2*3", "1+2*3", "+(1,*(2,3))"},
+		{"(1 + 2) * 3", "(1+2)*3", "(1+2)*3", "*(+(1,2),3)"},
+		{"1 - (2 - 3)", "1-(2-3)", "1-(2-3)", "-(1,-(2,3))"},
+		{"1 - 2 - 3", "1-2-3", "1-2-3", "-(-(1,2),3)"},
+		{"a:b:c", "a:b:c", "a:b:c", ":(a,:(b,c))"},
+		{"1 - -1", "1- -1", "1- -1", "-(1,-1)"},
+		{"- 1", "- 1", "- 1", "-(1)"},
+		{"-a", "-a", "-a", "-(a)"},
+		{"- (-a)", "- -a", "- -a", "-(-(a))"},
+		{"\\+ a", "\\+a", "\\+a", "\\+(a)"},
+		{"X is 1 mod 2", "X is 1 mod 2", "X is 1 mod 2", "is(X,mod(1,2))"},
+		{"(a :- b, c ; d)", "a:-b,c;d", "a:-b,c;d", ":-(a,;(','(b,c),d))"},
+		{"f((a, b))", "f((a,b))", "f((a,b))", "f(','(a,b))"},
+		{"f((a :- b))", "f((a:-b))", "f((a:-b))", "f(:-(a,b))"},
+		{"- - 1", "- - 1", "- - 1", "-(-(1))"},
+		{"a = (\\+b)", "a=(\\+b)", "a=(\\+b)", "=(a,\\+(b))"},
+		{"a = \\", "a=(\\)", "a=(\\)", "=(a,\\)"},
+		{"[-]", "[-]", "[-]", "[-]"},
+		{"- = (-)", "(-)=(-)", "(-)=(-)", "=(-,-)"},
+		{"'/*'", "/*", "'/*'", "'/*'"},
+		{"f('/**', //)", "f(/**,//)", "f('/**',//)", "f('/**',//)"},
+		{`"hello world"`, "hello world", `"hello world"`, `"hello world"`},
+		{`f("a""b", 'c')`, `f(a"b,c)`, `f("a\"b",c)`, `f("a\"b",c)`},
+	}
+	for _, test := range tests {
+		term := parseTerm(t, test.term)
+		for _, w := range []struct {
+			clause syntax.Clause
+			exp    string
+		}{
+			{Write1, test.write},
+			{Writeq1, test.writeq},
+			{WriteCanonical1, test.canonical},
+		} {
+			name, _ := w.clause.Signature()
+			got := captureOutput(func(p *syntax.Prog) {
+				if n := countProgSolutions(t, p, syntax.NewGoal(syntax.NewCompound(name, term))); n != 1 {
+					t.Errorf("%s(%s): expected 1 solution, got %d", w.clause, test.term, n)
+				}
+			})
+			if got != w.exp {
+				t.Errorf("%s(%s): expected %s got %s", w.clause, test.term, w.exp, got)
+			}
+		}
+	}
+}
+
+func TestWriteBindings(t *testing.T) {
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	goal := syntax.NewGoal(
+		syntax.NewCompound("=", x, syntax.NewCompound("f", y, syntax.Atom("Z"))),
+		syntax.NewCompound("=", y, parseTerm(t, "[1, 2]")),
+		syntax.NewCompound("writeq", x),
+		syntax.Atom("nl"),
+		syntax.NewCompound("write", y),
+		syntax.Atom("nl"),
+	)
+	got := captureOutput(func(p *syntax.Prog) { countProgSolutions(t, p, goal) })
+	if exp := "f([1,2],'Z')\n[1,2]\n"; got != exp {
+		t.Errorf("expected %q got %q", exp, got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		args   string
+		exp    string
+		err    bool
+	}{
+		{format: "hello ~w~n", args: "[world]", exp: "hello world\n"},
+		{format: "hello", args: "[]", exp: "hello"},
+		{format: "~w and ~w", args: "[f(X), [1, 2]]", exp: "f(X) and [1,2]"},
+		{format: "~q", args: "['A b']", exp: "'A b'"},
+		{format: "~a is ~d", args: "[x, 42]", exp: "x is 42"},
+		{format: "~f ~2f ~0f", args: "[1, 2.5, 3.7]", exp: "1.000000 2.50 4"},
+		{format: "a~tb~~c~2n", args: "[]", exp: "a\tb~c\n\n"},
+		{format: "~w!", args: "single", exp: "single!"},
+
+		{format: "~w ~w", args: "[a]", err: true},
+		{format: "~w", args: "[]", err: true},
+		{format: "~w", args: "[a, b]", err: true},
+		{format: "~d", args: "[a]", err: true},
+		{format: "~d", args: "[X]", err: true},
+		{format: "~a", args: "[1]", err: true},
+		{format: "~f", args: "[a]", err: true},
+		{format: "~z", args: "[]", err: true},
+		{format: "~", args: "[]", err: true},
+	}
+	for _, test := range tests {
+		fargs := parseTerm(t, test.args)
+		var got string
+		var err error
+		got = captureOutput(func(p *syntax.Prog) {
+			_, _, err = Format2.Call(p, args(syntax.Atom(test.format), fargs))
+		})
+		switch {
+		case test.err && err == nil:
+			t.Errorf("format(%q, %s): expected error", test.format, test.args)
+		case test.err:
+			if got != "" {
+				t.Errorf("format(%q, %s): wrote %q on error", test.format, test.args, got)
+			}
+		case err != nil:
+			t.Errorf("format(%q, %s): %v", test.format, test.args, err)
+		case got != test.exp:
+			t.Errorf("format(%q, %s): expected %q got %q", test.format, test.args, test.exp, got)
+		}
+	}
+}
+
+func TestFormatQuery(t *testing.T) {
+	goal := parseTerm(t, `format("hello ~w~n", [world])`)
+	got := captureOutput(func(p *syntax.Prog) {
+		if n := countProgSolutions(t, p, syntax.NewGoal(goal)); n != 1 {
+			t.Errorf("expected 1 solution, got %d", n)
+		}
+	})
+	if exp := "hello world\n"; got != exp {
+		t.Errorf("expected %q got %q", exp, got)
+	}
+}
+
+func TestWriteNumbervars(t *testing.T) {
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	term := syntax.NewCompound("f", x, y, x, syntax.NewCompound("$VAR", syntax.Integer(27)))
+	goal := syntax.NewGoal(
+		syntax.NewCompound("numbervars", term, syntax.Integer(0), syntax.NewVariable("_")),
+		syntax.NewCompound("write", term),
+		syntax.Atom("nl"),
+		syntax.NewCompound("write_canonical", x),
+	)
+	got := captureOutput(func(p *syntax.Prog) { countProgSolutions(t, p, goal) })
+	if exp := "f(A,B,A,B1)\n'$VAR'(0)"; got != exp {
+		t.Errorf("expected %q got %q", exp, got)
+	}
+}
+
+func TestWriteVarNames(t *testing.T) {
+	term := syntax.NewCompound("f", syntax.NewCompound("$VAR", syntax.Atom("Foo")), syntax.NewCompound("$VAR", syntax.Atom("_G1")))
+	goal := syntax.NewGoal(
+		syntax.NewCompound("writeq", term),
+		syntax.NewCompound("write_canonical", term),
+	)
+	got := captureOutput(func(p *syntax.Prog) { countProgSolutions(t, p, goal) })
+	if exp := "f(Foo,_G1)f('$VAR'('Foo'),'$VAR'('_G1'))"; got != exp {
+		t.Errorf("expected %q got %q", exp, got)
+	}
+}
+
+func TestWithOutputTo(t *testing.T) {
+	p := DefaultProg()
+	tests := []struct {
+		goal string
+		exp  string
+	}{
+		{`with_output_to(atom(X), write(hello))`, `hello`},
+		{`with_output_to(string(X), (write(a), write(b)))`, `"ab"`},
+		{`with_output_to(atom(X), true)`, `''`},
+		{`with_output_to(atom(X), (write(a), nl, format("~w-~w", [b, c])))`, "'a\\nb-c'"},
+		{`with_output_to(codes(X), write(hi))`, `[104, 105]`},
+		{`with_output_to(chars(X), write(hi))`, `[h, i]`},
+		// like once/1, only the first solution is taken and its bindings kept
+		{`with_output_to(atom(A), (member(Y, [1, 2]), write(Y))), X = A-Y`, `'1'-1`},
+		{`with_output_to(atom(X), with_output_to(atom(Y), write(inner)))`, `''`},
+		{`with_output_to(atom(X), (with_output_to(atom(Y), write(a)), write(Y)))`, `a`},
+	}
+	for _, test := range tests {
+		g := parseTerm(t, "("+test.goal+")")
+		var x *syntax.Variable
+		for _, v := range termVars(g) {
+			if v.String() == "X" {
+				x = v
+			}
+		}
+		bindings, ok, err := p.Query(toGoal(g)).First()
+		if err != nil || !ok {
+			t.Errorf("%s: expected a solution, got %t, %v", test.goal, ok, err)
+		} else if exp := parseTerm(t, test.exp); syntax.Compare(bindings[x], exp) != 0 {
+			t.Errorf("%s: expected X = %s got %s", test.goal, exp, bindings[x])
+		}
+	}
+
+	// output is restored afterwards
+	got := captureOutput(func(p *syntax.Prog) {
+		countProgSolutions(t, p, toGoal(parseTerm(t, `(with_output_to(atom(_), write(a)), write(b))`)))
+		countProgSolutions(t, p, toGoal(parseTerm(t, `(\+ with_output_to(atom(_), (write(c), fail)), write(d))`)))
+	})
+	if exp := "bd"; got != exp {
+		t.Errorf("expected %q got %q", exp, got)
+	}
+
+	for _, g := range []string{
+		`with_output_to(_, true)`,
+		`with_output_to(foo(_), true)`,
+		`with_output_to(atom(_), _)`,
+		`with_output_to(atom(_), throw(oops))`,
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(parseTerm(t, g))).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+	if w := p.Output(); w != os.Stdout {
+		t.Errorf("expected output to be restored, got %v", w)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	// the output of each program is separate
+	var a, b bytes.Buffer
+	p, q := DefaultProg(), DefaultProg()
+	p.SetOutput(&a)
+	q.SetOutput(&b)
+	countProgSolutions(t, p, toGoal(parseTerm(t, `write(a)`)))
+	countProgSolutions(t, q, toGoal(parseTerm(t, `write(b)`)))
+	if a.String() != "a" || b.String() != "b" {
+		t.Errorf("expected outputs a and b, got %q and %q", a.String(), b.String())
+	}
+}
+
+func TestWithOutputToConcurrent(t *testing.T) {
+	p := DefaultProg()
+	var wg sync.WaitGroup
+	for _, c := range []string{"a", "b", "c", "d"} {
+		x := syntax.NewVariable("X")
+		g := syntax.NewGoal(syntax.NewCompound("with_output_to", syntax.NewCompound("atom", x),
+			parseTerm(t, fmt.Sprintf("forall(between(1, 10000, _), write(%s))", c))))
+		wg.Add(1)
+		go func(c string) {
+			defer wg.Done()
+			bindings, ok, err := p.Query(g).First()
+			if !ok || err != nil {
+				t.Errorf("%s: expected a solution, got %t %v", c, ok, err)
+				return
+			}
+			// the output of the other goroutines isn't captured
+			if exp := syntax.Atom(strings.Repeat(c, 10000)); bindings[x] != exp {
+				t.Errorf("%s: expected %d characters of %s, got %d", c, len(exp), c, len(fmt.Sprint(bindings[x])))
+			}
+		}(c)
+	}
+	wg.Wait()
+}
@@ -1,4 +1,17 @@
 package builtin
 
-type functor3 struct {
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Is2 implements is(Result, Expr), unifying Result with the value of the
+// arithmetic expression Expr.
+var Is2 syntax.Clause = &builtin{
+	name:  "is",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		val, err := EvalArith(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(val), nil
+	},
 }
@@ -0,0 +1,678 @@
+package builtin
+
+import (
+	"sort"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// sortList sorts the elements of a list by the standard order of terms. If
+// dedup is set, elements which compare equal are removed.
+func sortList(t syntax.Term, dedup bool) (syntax.Term, error) {
+	terms, err := syntax.ListToSlice(t)
+	if err != nil {
+		return nil, err
+	}
+	// Only identical terms compare equal in the standard order, so the order
+	// of equal elements can't be observed and neither msort nor sort depend
+	// on the sort being stable. It's kept stable to match keysort/2, where
+	// elements are compared by only part of the term.
+	sort.SliceStable(terms, func(i, j int) bool {
+		return syntax.Compare(terms[i], terms[j]) < 0
+	})
+	if dedup && len(terms) > 0 {
+		uniq := terms[:1]
+		for _, t := range terms[1:] {
+			if syntax.Compare(uniq[len(uniq)-1], t) != 0 {
+				uniq = append(uniq, t)
+			}
+		}
+		terms = uniq
+	}
+	return syntax.NewList(terms), nil
+}
+
+func newSort(name string, dedup bool) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 2,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			sorted, err := sortList(args[0], dedup)
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, args[1].Unify(sorted), nil
+		},
+	}
+}
+
+// Msort2 implements msort(List, Sorted), where Sorted holds the elements of
+// List in the standard order of terms. Duplicates are kept. The sort is
+// stable.
+var Msort2 = newSort("msort", false)
+
+// Sort2 implements sort(List, Sorted). Like msort/2, but elements which are
+// equal by ==/2 are only kept once.
+var Sort2 = newSort("sort", true)
+
+// Keysort2 implements keysort(Pairs, Sorted), where Pairs is a list of terms
+// of the form Key-Value. Sorted holds the pairs ordered by the standard order
+// of their keys. The sort is stable, so pairs with equal keys keep their
+// order.
+var Keysort2 syntax.Clause = &builtin{
+	name:  "keysort",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		pairs, err := syntax.ListToSlice(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		keys := make([]syntax.Term, len(pairs))
+		for i, pair := range pairs {
+			c, ok := deref(pair).(*syntax.Compound)
+			if !ok || c.Functor() != "-" || len(c.Args()) != 2 {
+				return nil, false, typeErr("pair", pair)
+			}
+			keys[i] = c.Args()[0]
+		}
+		sorted := make([]int, len(pairs))
+		for i := range sorted {
+			sorted[i] = i
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return syntax.Compare(keys[sorted[i]], keys[sorted[j]]) < 0
+		})
+		terms := make([]syntax.Term, len(pairs))
+		for i, j := range sorted {
+			terms[i] = pairs[j]
+		}
+		return nil, args[1].Unify(syntax.NewList(terms)), nil
+	},
+}
+
+// predSorter sorts terms using a predicate to compare them, see Predsort3.
+type predSorter struct {
+	p    *syntax.Prog
+	pred syntax.Term
+}
+
+// compare calls the predicate to order a and b. ok is false if the
+// predicate fails.
+func (s predSorter) compare(a, b syntax.Term) (order syntax.Atom, ok bool, err error) {
+	goal := syntax.Copy(callGoal(s.pred, syntax.NewVariable("Order"), a, b)).(*syntax.Compound)
+	r := s.p.Query(toGoal(goal))
+	defer r.Close()
+	if !r.Next() {
+		return "", false, r.Err()
+	}
+	o := deref(goal.Args()[1])
+	switch o {
+	case syntax.Atom("<"), syntax.Atom("="), syntax.Atom(">"):
+		return o.(syntax.Atom), true, nil
+	}
+	if _, ok := o.(*syntax.Variable); ok {
+		return "", false, instantiationErr()
+	}
+	return "", false, domainErr("order", o)
+}
+
+// sort merge sorts terms, dropping elements the predicate finds equal to one
+// already kept.
+func (s predSorter) sort(terms []syntax.Term) ([]syntax.Term, bool, error) {
+	if len(terms) < 2 {
+		return terms, true, nil
+	}
+	left, ok, err := s.sort(terms[:len(terms)/2])
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	right, ok, err := s.sort(terms[len(terms)/2:])
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	merged := make([]syntax.Term, 0, len(left)+len(right))
+	for len(left) > 0 && len(right) > 0 {
+		order, ok, err := s.compare(left[0], right[0])
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		switch order {
+		case "<":
+			merged, left = append(merged, left[0]), left[1:]
+		case ">":
+			merged, right = append(merged, right[0]), right[1:]
+		default:
+			merged, left, right = append(merged, left[0]), left[1:], right[1:]
+		}
+	}
+	merged = append(append(merged, left...), right...)
+	return merged, true, nil
+}
+
+// Predsort3 implements predsort(Pred, List, Sorted), sorting List by calling
+// call(Pred, Order, E1, E2) to compare two elements. Order must be '<', '>'
+// or '='. Elements which compare as '=' are only kept once. predsort fails
+// if Pred fails.
+var Predsort3 syntax.Clause = &builtin{
+	name:  "predsort",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		terms, err := syntax.ListToSlice(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		sorted, ok, err := predSorter{p, args[0]}.sort(terms)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		return nil, args[2].Unify(syntax.NewList(sorted)), nil
+	},
+}
+
+// rule is an alternative definition of a predicate, written as a clause. It
+// returns the head arguments, with fresh variables, and the body.
+type rule func() (head []syntax.Term, body *syntax.Goal)
+
+// tryRules returns a generator which tries each rule in turn against args,
+// like the clauses of a user defined predicate.
+func tryRules(args []syntax.Term, rules ...rule) func() (*syntax.Goal, bool, error) {
+	target := syntax.NewCompound("$args", args...)
+	return func() (*syntax.Goal, bool, error) {
+		for len(rules) > 0 {
+			head, body := rules[0]()
+			rules = rules[1:]
+			h := syntax.NewCompound("$args", head...)
+			if unifies(target, h) {
+				return body, target.Unify(h), nil
+			}
+		}
+		return nil, false, nil
+	}
+}
+
+// partialList returns the elements of a list, and the term following them.
+// For proper lists the tail is the empty list, for partial lists it's an
+// unbound variable. For cyclic lists, such as the value of L after
+// 'L = [a|L]', the tail is a list cell whose elements have already been
+// returned.
+func partialList(t syntax.Term) (terms []syntax.Term, tail syntax.Term) {
+	t = deref(t)
+	// cycles are detected using Brent's algorithm, see syntax.ListToSlice
+	var saved syntax.Term
+	power, n := 1, 0
+	for {
+		c, ok := t.(*syntax.Compound)
+		if !ok || c.Functor() != "." || len(c.Args()) != 2 || t == saved {
+			return terms, t
+		}
+		if n++; n == power {
+			saved, power, n = t, power*2, 0
+		}
+		args := c.Args()
+		terms = append(terms, args[0])
+		t = deref(args[1])
+	}
+}
+
+// cons returns the list cell '[h|t]'.
+func cons(h, t syntax.Term) syntax.Term {
+	return syntax.NewCompound(".", h, t)
+}
+
+// Member2 implements member(X, List), which holds if X is an element of List.
+// member backtracks over each element which unifies with X.
+var Member2 syntax.Clause = &generator{
+	name:  "member",
+	nArgs: 2,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		x := args[0]
+		terms, tail := partialList(args[1])
+		var rest func() (*syntax.Goal, bool, error)
+		return func() (*syntax.Goal, bool, error) {
+			for len(terms) > 0 {
+				t := terms[0]
+				terms = terms[1:]
+				if unifies(x, t) {
+					return nil, x.Unify(t), nil
+				}
+			}
+			if _, ok := tail.(*syntax.Variable); !ok {
+				return nil, false, nil
+			}
+			// extend a partial list with the element
+			if rest == nil {
+				rest = tryRules([]syntax.Term{x, tail},
+					func() ([]syntax.Term, *syntax.Goal) {
+						return []syntax.Term{x, cons(x, syntax.NewVariable("_"))}, nil
+					},
+					func() ([]syntax.Term, *syntax.Goal) {
+						t := syntax.NewVariable("T")
+						return []syntax.Term{x, cons(syntax.NewVariable("_"), t)},
+							syntax.NewGoal(syntax.NewCompound("member", x, t))
+					},
+				)
+			}
+			return rest()
+		}
+	},
+}
+
+// Select3 implements select(X, List, Rest), which holds if Rest is List with
+// one element which unifies with X removed. select backtracks over each such
+// element.
+var Select3 syntax.Clause = &generator{
+	name:  "select",
+	nArgs: 3,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		return tryRules(args,
+			func() ([]syntax.Term, *syntax.Goal) {
+				x, t := syntax.NewVariable("X"), syntax.NewVariable("T")
+				return []syntax.Term{x, cons(x, t), t}, nil
+			},
+			func() ([]syntax.Term, *syntax.Goal) {
+				x, h := syntax.NewVariable("X"), syntax.NewVariable("H")
+				t, r := syntax.NewVariable("T"), syntax.NewVariable("R")
+				return []syntax.Term{x, cons(h, t), cons(h, r)},
+					syntax.NewGoal(syntax.NewCompound("select", x, t, r))
+			},
+		)
+	},
+}
+
+// Permutation2 implements permutation(List, Perm), which holds if Perm is a
+// permutation of List. permutation backtracks over each permutation.
+var Permutation2 syntax.Clause = &generator{
+	name:  "permutation",
+	nArgs: 2,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		l, perm := args[0], args[1]
+		if _, tail := partialList(l); tail != syntax.EmptyList {
+			// selecting from a partial list never ends, permute the other
+			// argument instead
+			if _, tail := partialList(perm); tail == syntax.EmptyList {
+				l, perm = perm, l
+			}
+		}
+		return tryRules([]syntax.Term{l, perm},
+			func() ([]syntax.Term, *syntax.Goal) {
+				return []syntax.Term{syntax.EmptyList, syntax.EmptyList}, nil
+			},
+			func() ([]syntax.Term, *syntax.Goal) {
+				l, h := syntax.NewVariable("L"), syntax.NewVariable("H")
+				t, r := syntax.NewVariable("T"), syntax.NewVariable("R")
+				return []syntax.Term{l, cons(h, t)}, syntax.GoalFromSlice([]syntax.Term{
+					syntax.NewCompound("select", h, l, r),
+					syntax.NewCompound("permutation", r, t),
+				})
+			},
+		)
+	},
+}
+
+// Append3 implements append(A, B, C), which holds if the list C is A followed
+// by B. If A isn't a proper list, append backtracks over each way to split C.
+var Append3 syntax.Clause = &generator{
+	name:  "append",
+	nArgs: 3,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		if terms, tail := partialList(args[0]); tail == syntax.EmptyList {
+			done := false
+			return func() (*syntax.Goal, bool, error) {
+				if done {
+					return nil, false, nil
+				}
+				done = true
+				l := args[1]
+				for i := len(terms) - 1; i >= 0; i-- {
+					l = cons(terms[i], l)
+				}
+				return nil, args[2].Unify(l), nil
+			}
+		}
+		return tryRules(args,
+			func() ([]syntax.Term, *syntax.Goal) {
+				l := syntax.NewVariable("L")
+				return []syntax.Term{syntax.EmptyList, l, l}, nil
+			},
+			func() ([]syntax.Term, *syntax.Goal) {
+				h, t, l, r := syntax.NewVariable("H"), syntax.NewVariable("T"), syntax.NewVariable("L"), syntax.NewVariable("R")
+				return []syntax.Term{cons(h, t), l, cons(h, r)},
+					syntax.NewGoal(syntax.NewCompound("append", t, l, r))
+			},
+		)
+	},
+}
+
+// Append2 implements append(ListOfLists, List), which holds if List is the
+// concatenation of the lists in ListOfLists.
+var Append2 syntax.Clause = &builtin{
+	name:  "append",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		lists, err := syntax.ListToSlice(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		if len(lists) == 0 {
+			return nil, args[1].Unify(syntax.EmptyList), nil
+		}
+		// append(L1, R1, List), append(L2, R2, R1), ..., append(Ln, [], Rn-1)
+		terms := make([]syntax.Term, len(lists))
+		rest := args[1]
+		for i, l := range lists {
+			next := syntax.Term(syntax.EmptyList)
+			if i < len(lists)-1 {
+				next = syntax.NewVariable("R")
+			}
+			terms[i] = syntax.NewCompound("append", l, next, rest)
+			rest = next
+		}
+		return syntax.GoalFromSlice(terms), true, nil
+	},
+}
+
+// Length2 implements length(List, Length). If List is a partial list, it's
+// extended with fresh variables to the given length. If both are unbound,
+// length backtracks over lists of increasing length.
+var Length2 syntax.Clause = &generator{
+	name:  "length",
+	nArgs: 2,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		terms, tail := partialList(args[0])
+		err := lengthArg(args[1])
+		if _, ok := tail.(*syntax.Variable); !ok && tail != syntax.EmptyList && err == nil {
+			err = typeErr("list", args[0])
+		}
+		n, bound := deref(args[1]).(syntax.Integer)
+		next := len(terms) // the next length to try
+		done := false
+		return func() (*syntax.Goal, bool, error) {
+			switch {
+			case err != nil:
+				return nil, false, err
+			case done:
+				return nil, false, nil
+			case tail == syntax.EmptyList:
+				done = true
+				return nil, args[1].Unify(syntax.Integer(len(terms))), nil
+			case bound:
+				done = true
+				if int(n) < len(terms) {
+					return nil, false, nil
+				}
+				next = int(n)
+			}
+			vars := make([]syntax.Term, next-len(terms))
+			for i := range vars {
+				vars[i] = syntax.NewVariable("_")
+			}
+			target := syntax.NewCompound("-", tail, args[1])
+			match := syntax.NewCompound("-", syntax.NewList(vars), syntax.Integer(next))
+			next++
+			if !unifies(target, match) {
+				// the tail and length are the same variable
+				return nil, false, nil
+			}
+			return nil, target.Unify(match), nil
+		}
+	},
+}
+
+// Last2 implements last(List, X), which holds if X is the last element of
+// List.
+var Last2 syntax.Clause = &generator{
+	name:  "last",
+	nArgs: 2,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		if terms, tail := partialList(args[0]); tail == syntax.EmptyList {
+			done := false
+			return func() (*syntax.Goal, bool, error) {
+				if done || len(terms) == 0 {
+					return nil, false, nil
+				}
+				done = true
+				return nil, args[1].Unify(terms[len(terms)-1]), nil
+			}
+		}
+		return tryRules(args,
+			func() ([]syntax.Term, *syntax.Goal) {
+				x := syntax.NewVariable("X")
+				return []syntax.Term{cons(x, syntax.EmptyList), x}, nil
+			},
+			func() ([]syntax.Term, *syntax.Goal) {
+				t, x := syntax.NewVariable("T"), syntax.NewVariable("X")
+				return []syntax.Term{cons(syntax.NewVariable("_"), t), x},
+					syntax.NewGoal(syntax.NewCompound("last", t, x))
+			},
+		)
+	},
+}
+
+// Reverse2 implements reverse(List, Reversed), where Reversed holds the
+// elements of the proper list List in reverse order.
+var Reverse2 syntax.Clause = &builtin{
+	name:  "reverse",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		terms, err := syntax.ListToSlice(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		for i, j := 0, len(terms)-1; i < j; i, j = i+1, j-1 {
+			terms[i], terms[j] = terms[j], terms[i]
+		}
+		return nil, args[1].Unify(syntax.NewList(terms)), nil
+	},
+}
+
+// newNth returns a generator implementing nth0/3 or nth1/3, where indexes
+// start at base.
+func newNth(name string, base int) syntax.Clause {
+	return &generator{
+		name:  name,
+		nArgs: 3,
+		generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+			index, bound, err := intArg(args[0])
+			terms, _ := partialList(args[1])
+			i := 0 // the next element to try
+			if bound {
+				// only the element at the index has to be tried
+				if n := int(index) - base; n < 0 || n >= len(terms) {
+					terms = nil
+				} else {
+					i, terms = n, terms[:n+1]
+				}
+			}
+			target := syntax.NewCompound("-", args[0], args[2])
+			return func() (*syntax.Goal, bool, error) {
+				if err != nil {
+					return nil, false, err
+				}
+				for ; i < len(terms); i++ {
+					match := syntax.NewCompound("-", syntax.Integer(i+base), terms[i])
+					if unifies(target, match) {
+						i++
+						return nil, target.Unify(match), nil
+					}
+				}
+				return nil, false, nil
+			}
+		},
+	}
+}
+
+// Nth0_3 implements nth0(Index, List, Element), where Element is the element
+// of List at the 0-based Index. If Index is unbound, nth0 backtracks over
+// each element which unifies with Element.
+var Nth0_3 = newNth("nth0", 0)
+
+// Nth1_3 implements nth1(Index, List, Element). Like nth0/3, but indexes start
+// at 1.
+var Nth1_3 = newNth("nth1", 1)
+
+// Numlist3 implements numlist(Low, High, List), where List holds the integers
+// from Low to High inclusive. If High is less than Low, numlist fails.
+var Numlist3 syntax.Clause = &builtin{
+	name:  "numlist",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		var bounds [2]syntax.Integer
+		for i, arg := range args[:2] {
+			n, ok, err := intArg(arg)
+			if err == nil && !ok {
+				err = instantiationErr()
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			bounds[i] = n
+		}
+		low, high := bounds[0], bounds[1]
+		if low > high {
+			return nil, false, nil
+		}
+		l := syntax.EmptyList
+		for i := high; i >= low; i-- {
+			l = cons(i, l)
+		}
+		return nil, args[2].Unify(l), nil
+	},
+}
+
+// foldArith evaluates each term and combines the results by the arithmetic
+// function fn, such as "+" or "max". It returns nil if terms is empty.
+func foldArith(fn syntax.Atom, terms []syntax.Term) (syntax.Term, error) {
+	var acc syntax.Term
+	for _, t := range terms {
+		x, err := EvalArith(t)
+		if err != nil {
+			return nil, err
+		}
+		if acc == nil {
+			acc = x
+			continue
+		}
+		if acc, err = binaryFuncs[fn](syntax.NewCompound(fn, acc, x), acc, x); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// newAggregate returns a builtin which unifies its second argument with the
+// result of combining the evaluated elements of a list by the arithmetic
+// function fn.
+func newAggregate(name string, fn syntax.Atom) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 2,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			terms, err := syntax.ListToSlice(args[0])
+			if err != nil || len(terms) == 0 {
+				return nil, false, err
+			}
+			acc, err := foldArith(fn, terms)
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, args[1].Unify(acc), nil
+		},
+	}
+}
+
+// SumList2 implements sum_list(List, Sum). The sum is an integer unless any
+// element is a float. Unlike SWI-Prolog, it fails for an empty list.
+var SumList2 = newAggregate("sum_list", "+")
+
+// MaxList2 implements max_list(List, Max), failing for an empty list.
+var MaxList2 = newAggregate("max_list", "max")
+
+// MinList2 implements min_list(List, Min), failing for an empty list.
+var MinList2 = newAggregate("min_list", "min")
+
+// containsTerm reports whether terms holds a term identical to t, see '=='.
+func containsTerm(terms []syntax.Term, t syntax.Term) bool {
+	for _, e := range terms {
+		if syntax.Compare(e, t) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newSetOp returns a builtin for a predicate which combines two proper lists,
+// treated as sets, into a third using op.
+func newSetOp(name string, op func(a, b []syntax.Term) []syntax.Term) syntax.Clause {
+	return &builtin{
+		name:  name,
+		nArgs: 3,
+		call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+			a, err := syntax.ListToSlice(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			b, err := syntax.ListToSlice(args[1])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, args[2].Unify(syntax.NewList(op(a, b))), nil
+		},
+	}
+}
+
+// Subtract3 implements subtract(Set1, Set2, Diff), where Diff holds the
+// elements of Set1 which aren't in Set2.
+var Subtract3 = newSetOp("subtract", func(a, b []syntax.Term) []syntax.Term {
+	var diff []syntax.Term
+	for _, t := range a {
+		if !containsTerm(b, t) {
+			diff = append(diff, t)
+		}
+	}
+	return diff
+})
+
+// Intersection3 implements intersection(Set1, Set2, Both), where Both holds
+// the elements of Set1 which are also in Set2.
+var Intersection3 = newSetOp("intersection", func(a, b []syntax.Term) []syntax.Term {
+	var both []syntax.Term
+	for _, t := range a {
+		if containsTerm(b, t) {
+			both = append(both, t)
+		}
+	}
+	return both
+})
+
+// Union3 implements union(Set1, Set2, All), where All holds the elements of
+// Set1 followed by the elements of Set2 which aren't in Set1.
+var Union3 = newSetOp("union", func(a, b []syntax.Term) []syntax.Term {
+	all := append([]syntax.Term(nil), a...)
+	for _, t := range b {
+		if !containsTerm(a, t) {
+			all = append(all, t)
+		}
+	}
+	return all
+})
+
+// ListToSet2 implements list_to_set(List, Set), where Set holds the elements
+// of List with duplicates, compared using '==', removed. The first occurrence
+// of each element is kept.
+var ListToSet2 syntax.Clause = &builtin{
+	name:  "list_to_set",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		terms, err := syntax.ListToSlice(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		var set []syntax.Term
+		for _, t := range terms {
+			if !containsTerm(set, t) {
+				set = append(set, t)
+			}
+		}
+		return nil, args[1].Unify(syntax.NewList(set)), nil
+	},
+}
@@ -0,0 +1,511 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestSort(t *testing.T) {
+	p := DefaultProg()
+	a, b := syntax.Atom("a"), syntax.Atom("b")
+	f := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("f", args...) }
+
+	tests := []struct {
+		list          syntax.Term
+		msort, sorted syntax.Term
+	}{
+		{ints(3, 1, 2, 1), ints(1, 1, 2, 3), ints(1, 2, 3)},
+		{syntax.EmptyList, syntax.EmptyList, syntax.EmptyList},
+		{
+			// standard order: numbers, atoms, compounds
+			list(f(a), b, syntax.Integer(2), a, syntax.Float64(1.5), syntax.Integer(1)),
+			list(syntax.Integer(1), syntax.Float64(1.5), syntax.Integer(2), a, b, f(a)),
+			list(syntax.Integer(1), syntax.Float64(1.5), syntax.Integer(2), a, b, f(a)),
+		},
+		{
+			// 1 and 1.0 are different terms
+			list(syntax.Float64(1), syntax.Integer(1), syntax.Float64(1)),
+			list(syntax.Integer(1), syntax.Float64(1), syntax.Float64(1)),
+			list(syntax.Integer(1), syntax.Float64(1)),
+		},
+		{
+			list(f(b), f(a, b), f(a), f(a)),
+			list(f(a), f(a), f(b), f(a, b)),
+			list(f(a), f(b), f(a, b)),
+		},
+	}
+	for _, test := range tests {
+		x := syntax.NewVariable("X")
+		testSolutions(t, p, x, goal(syntax.NewCompound("msort", test.list, x)), test.msort)
+		x = syntax.NewVariable("X")
+		testSolutions(t, p, x, goal(syntax.NewCompound("sort", test.list, x)), test.sorted)
+	}
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Sort2, []callTest{
+		{args: args(ints(2, 1), ints(1, 2)), matches: true},
+		{args: args(ints(2, 1), ints(2, 1)), matches: false},
+		{args: args(v(), v()), err: true},
+		{args: args(list(a, v()), v()), matches: true},
+		{args: args(syntax.NewCompound(".", a, v()), v()), err: true},
+		{args: args(a, v()), err: true},
+	})
+}
+
+func TestMsortPairs(t *testing.T) {
+	// f(Key, ID) pairs, which msort/2 orders by key, then by ID. Since it
+	// compares whole terms, equal pairs can't be told apart, see
+	// TestKeysortStable for stability.
+	var pairs []syntax.Term
+	for id := 0; id < 100; id++ {
+		key := syntax.Atom(string(rune('a' + (id*7)%5)))
+		pairs = append(pairs, syntax.NewCompound("f", key, syntax.Integer(id)))
+	}
+	x := syntax.NewVariable("X")
+	got := solutions(t, DefaultProg(), x, syntax.NewCompound("msort", syntax.NewList(pairs), x))
+	if len(got) != 1 {
+		t.Fatalf("expected one solution, got %s", got)
+	}
+	sorted, err := syntax.ListToSlice(got[0])
+	if err != nil || len(sorted) != len(pairs) {
+		t.Fatalf("expected %d pairs, got %s, %v", len(pairs), got[0], err)
+	}
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1].(*syntax.Compound).Args(), sorted[i].(*syntax.Compound).Args()
+		switch c := syntax.Compare(prev[0], cur[0]); {
+		case c > 0:
+			t.Fatalf("keys out of order: %s before %s", sorted[i-1], sorted[i])
+		case c == 0 && syntax.Compare(prev[1], cur[1]) > 0:
+			t.Fatalf("pairs out of order: %s before %s", sorted[i-1], sorted[i])
+		}
+	}
+}
+
+func TestKeysortStable(t *testing.T) {
+	// Key-Pos pairs, where Pos decreases in the original order, so pairs
+	// with equal keys only stay in order if the sort is stable
+	var pairs []syntax.Term
+	for i := 0; i < 100; i++ {
+		key := syntax.Atom(string(rune('a' + (i*7)%5)))
+		pairs = append(pairs, syntax.NewCompound("-", key, syntax.Integer(100-i)))
+	}
+	x := syntax.NewVariable("X")
+	got := solutions(t, DefaultProg(), x, syntax.NewCompound("keysort", syntax.NewList(pairs), x))
+	if len(got) != 1 {
+		t.Fatalf("expected one solution, got %s", got)
+	}
+	sorted, err := syntax.ListToSlice(got[0])
+	if err != nil || len(sorted) != len(pairs) {
+		t.Fatalf("expected %d pairs, got %s, %v", len(pairs), got[0], err)
+	}
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1].(*syntax.Compound).Args(), sorted[i].(*syntax.Compound).Args()
+		switch c := syntax.Compare(prev[0], cur[0]); {
+		case c > 0:
+			t.Fatalf("keys out of order: %s before %s", sorted[i-1], sorted[i])
+		case c == 0 && syntax.Compare(prev[1], cur[1]) < 0:
+			t.Fatalf("pairs with equal keys reordered: %s before %s", sorted[i-1], sorted[i])
+		}
+	}
+}
+
+func TestKeysort(t *testing.T) {
+	p := DefaultProg()
+	pair := func(k, v syntax.Term) syntax.Term { return syntax.NewCompound("-", k, v) }
+	a, b, c := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("c")
+
+	tests := []struct {
+		list, exp syntax.Term
+	}{
+		{
+			list(pair(b, syntax.Integer(2)), pair(a, syntax.Integer(1)), pair(a, syntax.Integer(3))),
+			list(pair(a, syntax.Integer(1)), pair(a, syntax.Integer(3)), pair(b, syntax.Integer(2))),
+		},
+		{
+			// values aren't compared, equal keys keep their order
+			list(pair(a, c), pair(a, b), pair(a, a)),
+			list(pair(a, c), pair(a, b), pair(a, a)),
+		},
+		{
+			list(pair(syntax.Integer(2), a), pair(b, b), pair(syntax.Integer(1), c)),
+			list(pair(syntax.Integer(1), c), pair(syntax.Integer(2), a), pair(b, b)),
+		},
+		{syntax.EmptyList, syntax.EmptyList},
+	}
+	for _, test := range tests {
+		x := syntax.NewVariable("X")
+		testSolutions(t, p, x, goal(syntax.NewCompound("keysort", test.list, x)), test.exp)
+	}
+
+	testCalls(t, Keysort2, []callTest{
+		{args: args(list(pair(a, b)), list(pair(a, c))), matches: false},
+		{args: args(list(a), syntax.NewVariable("X")), err: true},
+		{args: args(list(syntax.NewVariable("P")), syntax.NewVariable("X")), err: true},
+		{args: args(syntax.NewVariable("L"), syntax.NewVariable("X")), err: true},
+	})
+}
+
+func TestPredsort(t *testing.T) {
+	p := DefaultProg()
+	err := parse.LoadString(p, `
+		len_cmp(Order, A, B) :- atom_length(A, LA), atom_length(B, LB), compare(Order, LA, LB).
+		bad_cmp(bad, _, _).
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	predsort := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("predsort", args...) }
+	atoms := func(s ...string) syntax.Term {
+		var terms []syntax.Term
+		for _, a := range s {
+			terms = append(terms, syntax.Atom(a))
+		}
+		return syntax.NewList(terms)
+	}
+
+	tests := []struct {
+		pred, list, exp syntax.Term
+	}{
+		{syntax.Atom("len_cmp"), atoms("ccc", "a", "bb"), atoms("a", "bb", "ccc")},
+		// elements of the same length are dropped
+		{syntax.Atom("len_cmp"), atoms("bb", "a", "cc", "b", "ddd"), atoms("a", "bb", "ddd")},
+		{syntax.Atom("len_cmp"), syntax.EmptyList, syntax.EmptyList},
+		{syntax.Atom("compare"), ints(3, 1, 2, 1), ints(1, 2, 3)},
+	}
+	for _, test := range tests {
+		x := syntax.NewVariable("X")
+		testSolutions(t, p, x, goal(predsort(test.pred, test.list, x)), test.exp)
+	}
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, nil, goal(predsort(syntax.Atom("fail"), ints(1, 2), x)))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(predsort(syntax.Atom("fail"), ints(1), x)), ints(1))
+
+	for _, g := range []syntax.Term{
+		predsort(syntax.Atom("bad_cmp"), ints(1, 2), syntax.NewVariable("X")),
+		predsort(syntax.Atom("len_cmp"), syntax.NewVariable("L"), syntax.NewVariable("X")),
+	} {
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
+
+func TestMember(t *testing.T) {
+	p := DefaultProg()
+	member := func(x, l syntax.Term) syntax.Term { return syntax.NewCompound("member", x, l) }
+	a, b := syntax.Atom("a"), syntax.Atom("b")
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(member(x, ints(1, 2, 3))), syntax.Integer(1), syntax.Integer(2), syntax.Integer(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(member(x, syntax.EmptyList)))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(member(syntax.NewCompound("f", x), list(syntax.NewCompound("f", a), b, syntax.NewCompound("f", b)))), a, b)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(member(b, list(a, b, b)), syntax.NewCompound("=", x, syntax.Atom("ok"))), syntax.Atom("ok"), syntax.Atom("ok"))
+
+	// partial lists are extended
+	l, n := syntax.NewVariable("L"), syntax.NewVariable("N")
+	testSolutions(t, p, n, goal(member(a, cons(b, l)), syntax.NewCompound("length", l, n), syntax.NewCompound(">=", n, syntax.Integer(3)), syntax.Cut),
+		syntax.Integer(3))
+}
+
+func TestAppend(t *testing.T) {
+	p := DefaultProg()
+	app := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("append", args...) }
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(ints(1, 2), ints(3), x)), ints(1, 2, 3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(ints(1, 2), x, ints(1, 2, 3))), ints(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(x, ints(3), ints(1, 2, 3))), ints(1, 2))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(x, ints(4), ints(1, 2, 3))))
+
+	// splitting a list
+	x, y, z := syntax.NewVariable("X"), syntax.NewVariable("Y"), syntax.NewVariable("Z")
+	testSolutions(t, p, z, goal(app(x, y, ints(1, 2)), syntax.NewCompound("=", z, syntax.NewCompound("-", x, y))),
+		syntax.NewCompound("-", syntax.EmptyList, ints(1, 2)),
+		syntax.NewCompound("-", ints(1), ints(2)),
+		syntax.NewCompound("-", ints(1, 2), syntax.EmptyList),
+	)
+
+	// partial lists
+	t1 := syntax.NewVariable("T")
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(cons(syntax.Integer(1), t1), ints(3), ints(1, 2, 3)), syntax.NewCompound("=", x, t1)), ints(2))
+
+	// append/2
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(list(ints(1), syntax.EmptyList, ints(2, 3)), x)), ints(1, 2, 3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(syntax.EmptyList, x)), syntax.EmptyList)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(app(list(x, ints(3)), ints(1, 2, 3))), ints(1, 2))
+	testCalls(t, Append2, []callTest{
+		{args: args(syntax.NewVariable("L"), ints(1)), err: true},
+	})
+}
+
+func TestLength(t *testing.T) {
+	p := DefaultProg()
+	length := func(l, n syntax.Term) syntax.Term { return syntax.NewCompound("length", l, n) }
+	a := syntax.Atom("a")
+
+	n := syntax.NewVariable("N")
+	testSolutions(t, p, n, goal(length(ints(1, 2, 3), n)), syntax.Integer(3))
+	n = syntax.NewVariable("N")
+	testSolutions(t, p, n, goal(length(syntax.EmptyList, n)), syntax.Integer(0))
+
+	l := syntax.NewVariable("L")
+	testSolutions(t, p, l, goal(length(l, syntax.Integer(2)), syntax.NewCompound("=", l, list(a, a))), list(a, a))
+	l = syntax.NewVariable("L")
+	testSolutions(t, p, l, goal(length(cons(a, l), syntax.Integer(2)), syntax.NewCompound("=", l, list(a))), list(a))
+
+	// enumerate lists of increasing length
+	l, n = syntax.NewVariable("L"), syntax.NewVariable("N")
+	testSolutions(t, p, n, goal(length(l, n), syntax.NewCompound(">=", n, syntax.Integer(2)), syntax.Cut), syntax.Integer(2))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Length2, []callTest{
+		{args: args(ints(1, 2), syntax.Integer(2)), matches: true},
+		{args: args(ints(1, 2), syntax.Integer(3)), matches: false},
+		{args: args(cons(a, v()), syntax.Integer(0)), matches: false},
+		{args: args(v(), syntax.Integer(-1)), err: true},
+		{args: args(v(), a), err: true},
+		{args: args(a, v()), err: true},
+	})
+}
+
+func TestLastReverse(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("last", ints(1, 2, 3), x)), syntax.Integer(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("last", syntax.EmptyList, x)))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("last", cons(syntax.Integer(1), x), syntax.Integer(2)), syntax.Cut), ints(2))
+
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("reverse", ints(1, 2, 3), x)), ints(3, 2, 1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("reverse", syntax.EmptyList, x)), syntax.EmptyList)
+	testCalls(t, Reverse2, []callTest{
+		{args: args(ints(1, 2), ints(2, 1)), matches: true},
+		{args: args(syntax.NewVariable("L"), ints(2, 1)), err: true},
+	})
+}
+
+func TestNth(t *testing.T) {
+	p := DefaultProg()
+	a, b, c := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("c")
+	abc := list(a, b, c)
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("nth0", syntax.Integer(0), abc, x)), a)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("nth1", syntax.Integer(1), abc, x)), a)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("nth1", syntax.Integer(3), abc, x)), c)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("nth0", syntax.Integer(3), abc, x)))
+
+	i := syntax.NewVariable("I")
+	testSolutions(t, p, i, goal(syntax.NewCompound("nth0", i, list(a, b, a), a)), syntax.Integer(0), syntax.Integer(2))
+	i = syntax.NewVariable("I")
+	testSolutions(t, p, i, goal(syntax.NewCompound("nth1", i, list(a, b, a), a)), syntax.Integer(1), syntax.Integer(3))
+
+	// enumerate all pairs
+	i, x, pair := syntax.NewVariable("I"), syntax.NewVariable("X"), syntax.NewVariable("P")
+	testSolutions(t, p, pair, goal(syntax.NewCompound("nth0", i, list(a, b), x), syntax.NewCompound("=", pair, syntax.NewCompound("-", i, x))),
+		syntax.NewCompound("-", syntax.Integer(0), a), syntax.NewCompound("-", syntax.Integer(1), b))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Nth0_3, []callTest{
+		{args: args(syntax.Integer(1), abc, b), matches: true},
+		{args: args(syntax.Integer(1), abc, c), matches: false},
+		{args: args(syntax.Integer(-1), abc, v()), matches: false},
+		{args: args(syntax.Atom("a"), abc, v()), err: true},
+		{args: args(syntax.Float64(1), abc, v()), err: true},
+	})
+}
+
+func TestNumlist(t *testing.T) {
+	p := DefaultProg()
+	numlist := func(low, high int, l syntax.Term) syntax.Term {
+		return syntax.NewCompound("numlist", syntax.Integer(low), syntax.Integer(high), l)
+	}
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(numlist(1, 5, x)), ints(1, 2, 3, 4, 5))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(numlist(-1, 1, x)), ints(-1, 0, 1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(numlist(3, 3, x)), ints(3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(numlist(5, 3, x)))
+
+	// a large range
+	x, n := syntax.NewVariable("X"), syntax.NewVariable("N")
+	testSolutions(t, p, n, goal(numlist(1, 100000, x), syntax.NewCompound("length", x, n)), syntax.Integer(100000))
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Numlist3, []callTest{
+		{args: args(syntax.Integer(1), syntax.Integer(2), ints(1, 2)), matches: true},
+		{args: args(syntax.Integer(1), syntax.Integer(2), ints(1)), matches: false},
+		{args: args(v(), syntax.Integer(2), v()), err: true},
+		{args: args(syntax.Integer(1), v(), v()), err: true},
+		{args: args(syntax.Integer(1), syntax.Float64(2), v()), err: true},
+	})
+}
+
+func TestListAggregates(t *testing.T) {
+	p := DefaultProg()
+	mixed := list(syntax.Integer(1), syntax.Float64(2.5), syntax.Integer(3))
+	tests := []struct {
+		name string
+		list syntax.Term
+		exp  syntax.Term // nil if no solutions are expected
+	}{
+		{"sum_list", ints(1, 2, 3), syntax.Integer(6)},
+		{"sum_list", mixed, syntax.Float64(6.5)},
+		{"sum_list", ints(7), syntax.Integer(7)},
+		{"sum_list", syntax.EmptyList, nil},
+		{"max_list", ints(1, 5, 3), syntax.Integer(5)},
+		{"max_list", mixed, syntax.Integer(3)},
+		{"max_list", ints(7), syntax.Integer(7)},
+		{"max_list", syntax.EmptyList, nil},
+		{"min_list", ints(4, 2, 3), syntax.Integer(2)},
+		{"min_list", list(syntax.Float64(0.5), syntax.Integer(1)), syntax.Float64(0.5)},
+		{"min_list", syntax.EmptyList, nil},
+	}
+	for _, test := range tests {
+		x := syntax.NewVariable("X")
+		g := goal(syntax.NewCompound(syntax.Atom(test.name), test.list, x))
+		if test.exp == nil {
+			testSolutions(t, p, x, g)
+		} else {
+			testSolutions(t, p, x, g, test.exp)
+		}
+	}
+
+	for _, clause := range []syntax.Clause{SumList2, MaxList2, MinList2} {
+		testCalls(t, clause, []callTest{
+			{args: args(list(syntax.Integer(1), syntax.Atom("a")), syntax.NewVariable("X")), err: true},
+			{args: args(syntax.NewVariable("L"), syntax.NewVariable("X")), err: true},
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	p := DefaultProg()
+	sel := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("select", args...) }
+	a, b, c := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("c")
+
+	x, r := syntax.NewVariable("X"), syntax.NewVariable("R")
+	testSolutions(t, p, r, goal(sel(x, list(a, b, c), r)), list(b, c), list(a, c), list(a, b))
+	r = syntax.NewVariable("R")
+	testSolutions(t, p, r, goal(sel(b, list(a, b, c, b), r)), list(a, c, b), list(a, b, c))
+	r = syntax.NewVariable("R")
+	testSolutions(t, p, nil, goal(sel(c, list(a, b), r)))
+	// insert an element
+	l := syntax.NewVariable("L")
+	testSolutions(t, p, l, goal(sel(c, l, list(a, b))), list(c, a, b), list(a, c, b), list(a, b, c))
+}
+
+func TestSetOps(t *testing.T) {
+	p := DefaultProg()
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+
+	tests := []struct {
+		name      syntax.Atom
+		a, b, exp syntax.Term
+	}{
+		{"subtract", ints(1, 2, 3, 4), ints(2, 4), ints(1, 3)},
+		{"subtract", ints(1, 2), syntax.EmptyList, ints(1, 2)},
+		{"subtract", ints(1, 2), ints(1, 2), syntax.EmptyList},
+		// membership uses '==', so 1 and 1.0 differ
+		{"subtract", ints(1, 2), list(syntax.Float64(1)), ints(1, 2)},
+		{"subtract", list(x, y), list(x), list(y)},
+		{"intersection", ints(1, 2, 3), ints(2, 3, 4), ints(2, 3)},
+		{"intersection", ints(1, 2), ints(3), syntax.EmptyList},
+		{"union", ints(1, 2), ints(2, 3), ints(1, 2, 3)},
+		{"union", syntax.EmptyList, ints(1), ints(1)},
+	}
+	for _, test := range tests {
+		v := syntax.NewVariable("V")
+		testSolutions(t, p, v, goal(syntax.NewCompound(test.name, test.a, test.b, v)), test.exp)
+	}
+
+	testCalls(t, Union3, []callTest{
+		{args: args(ints(1), ints(2), ints(2, 1)), matches: false},
+		{args: args(syntax.NewVariable("L"), ints(2), syntax.NewVariable("X")), err: true},
+		{args: args(ints(1), syntax.Atom("a"), syntax.NewVariable("X")), err: true},
+	})
+}
+
+func TestPermutation(t *testing.T) {
+	p := DefaultProg()
+	perm := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("permutation", a, b) }
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(perm(ints(1, 2, 3), x)),
+		ints(1, 2, 3), ints(1, 3, 2), ints(2, 1, 3), ints(2, 3, 1), ints(3, 1, 2), ints(3, 2, 1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(perm(syntax.EmptyList, x)), syntax.EmptyList)
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(perm(x, ints(1, 2))), ints(1, 2), ints(2, 1))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, nil, goal(perm(ints(1, 2), ints(1, 3))))
+
+	ps, n := syntax.NewVariable("Ps"), syntax.NewVariable("N")
+	p1 := syntax.NewVariable("P")
+	testSolutions(t, p, n, goal(
+		syntax.NewCompound("findall", p1, perm(ints(1, 2, 3), p1), ps),
+		syntax.NewCompound("length", ps, n),
+	), syntax.Integer(6))
+}
+
+func TestListToSet(t *testing.T) {
+	p := DefaultProg()
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("list_to_set", ints(1, 2, 1, 3, 2), x)), ints(1, 2, 3))
+	x = syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("list_to_set", list(syntax.Integer(1), syntax.Float64(1)), x)),
+		list(syntax.Integer(1), syntax.Float64(1)))
+
+	testCalls(t, ListToSet2, []callTest{
+		{args: args(syntax.EmptyList, syntax.EmptyList), matches: true},
+		{args: args(syntax.NewVariable("L"), syntax.NewVariable("X")), err: true},
+	})
+}
+
+func TestCyclicLists(t *testing.T) {
+	p := DefaultProg()
+	for _, g := range []string{
+		`L = [a|L], msort(L, X)`,
+		`L = [1|L], sum_list(L, X)`,
+		`L = [97|L], atom_codes(X, L)`,
+	} {
+		if _, _, err := p.Query(toGoal(parseTerm(t, "("+g+")"))).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
+
+func TestLengthCyclic(t *testing.T) {
+	g := toGoal(parseTerm(t, `(L = [a, b|L], length(L, N))`))
+	_, _, err := DefaultProg().Query(g).First()
+	e, ok := err.(*syntax.PrologError)
+	if !ok {
+		t.Fatalf("expected a type error, got %v", err)
+	}
+	if formal := e.Term.(*syntax.Compound).Args()[0].(*syntax.Compound); formal.Functor() != "type_error" || formal.Args()[0] != syntax.Atom("list") {
+		t.Errorf("expected a type error, got %s", formal.Functor())
+	}
+}
@@ -0,0 +1,177 @@
+package builtin
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ericchiang/pl/prolog/parse"
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Reading and writing terms as text, see http://www.swi-prolog.org/pldoc/man?section=termrw
+
+// parseAtom parses the text of an atom argument as a term, returning a
+// syntax error if it isn't one.
+func parseAtom(t syntax.Term) (syntax.Term, []parse.VarName, error) {
+	s, err := textArg(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	term, vars, err := parse.ParseTerm(s)
+	if err != nil {
+		return nil, nil, &syntax.PrologError{Term: syntax.SyntaxErrorTerm(err.Error())}
+	}
+	return term, vars, nil
+}
+
+// bindings returns the list 'Name = Var' for the named variables of a term.
+func bindings(vars []parse.VarName) syntax.Term {
+	terms := make([]syntax.Term, len(vars))
+	for i, v := range vars {
+		terms[i] = syntax.NewCompound("=", syntax.Atom(v.Name), v.Var)
+	}
+	return syntax.NewList(terms)
+}
+
+// termText returns the text of a term which can be read back by parseAtom.
+// Variables are written as _G0, _G1 and so on, so distinct variables which
+// share a name aren't read back as the same variable.
+func termText(t syntax.Term) string {
+	t = syntax.Copy(t)
+	for i, v := range termVars(t) {
+		v.Unify(syntax.NewCompound("$VAR", syntax.Atom(fmt.Sprintf("_G%d", i))))
+	}
+	return formatTerm(t, writeOpts{quoted: true, numberVars: true})
+}
+
+// TermToAtom2 implements term_to_atom(Term, Atom). If Atom is bound, it's
+// parsed and the result unified with Term. Otherwise Atom is unified with
+// the quoted text of Term.
+var TermToAtom2 syntax.Clause = &builtin{
+	name:  "term_to_atom",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[1]).(*syntax.Variable); ok {
+			return nil, args[1].Unify(syntax.Atom(termText(args[0]))), nil
+		}
+		t, _, err := parseAtom(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(t), nil
+	},
+}
+
+// AtomToTerm3 implements atom_to_term(Atom, Term, Bindings), parsing Atom and
+// unifying the result with Term. Bindings is unified with a list of
+// 'Name = Var' terms for the named variables of Term.
+var AtomToTerm3 syntax.Clause = &builtin{
+	name:  "atom_to_term",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		t, vars, err := parseAtom(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[1].Unify(t) && args[2].Unify(bindings(vars)), nil
+	},
+}
+
+// readTerm reads the next term from the current input of p. At the end of
+// the input, the term is the atom end_of_file.
+func readTerm(p *syntax.Prog) (t syntax.Term, vars, singletons []parse.VarName, err error) {
+	r := p.InputReader(func(r io.Reader) interface{} { return parse.NewReader(r) }).(*parse.Reader)
+	t, vars, singletons, err = r.Read()
+	if err == io.EOF {
+		return syntax.Atom("end_of_file"), nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, &syntax.PrologError{Term: syntax.SyntaxErrorTerm(err.Error())}
+	}
+	return t, vars, singletons, nil
+}
+
+// Read1 implements read(Term), reading the next term from the current input,
+// see syntax.Prog.SetInput. The term must be terminated by a '.'. At the end
+// of the input, Term is unified with end_of_file.
+var Read1 syntax.Clause = &builtin{
+	name:  "read",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		t, _, _, err := readTerm(p)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(t), nil
+	},
+}
+
+// readOptions returns the options of read_term/2.
+func readOptions(t syntax.Term) ([]*syntax.Compound, error) {
+	terms, err := syntax.ListToSlice(t)
+	if err != nil {
+		return nil, err
+	}
+	opts := make([]*syntax.Compound, len(terms))
+	for i, opt := range terms {
+		switch c := deref(opt).(type) {
+		case *syntax.Variable:
+			return nil, instantiationErr()
+		case *syntax.Compound:
+			switch c.Functor() {
+			case "variables", "variable_names", "singletons":
+				if len(c.Args()) == 1 {
+					opts[i] = c
+					continue
+				}
+			}
+		}
+		return nil, domainErr("read_option", opt)
+	}
+	return opts, nil
+}
+
+// ReadTerm2 implements read_term(Term, Options). Like read/1, but Options
+// may hold:
+//
+//	variables(Vars)           Vars is unified with the variables of Term.
+//	variable_names(Bindings)  Bindings is unified with 'Name = Var' terms for
+//	                          the named variables of Term.
+//	singletons(Bindings)      Like variable_names, but only for the named
+//	                          variables appearing once.
+var ReadTerm2 syntax.Clause = &builtin{
+	name:  "read_term",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		opts, err := readOptions(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		t, vars, singletons, err := readTerm(p)
+		if err != nil {
+			return nil, false, err
+		}
+		if !args[0].Unify(t) {
+			return nil, false, nil
+		}
+		for _, opt := range opts {
+			var value syntax.Term
+			switch opt.Functor() {
+			case "variables":
+				var terms []syntax.Term
+				for _, v := range termVars(t) {
+					terms = append(terms, v)
+				}
+				value = syntax.NewList(terms)
+			case "variable_names":
+				value = bindings(vars)
+			case "singletons":
+				value = bindings(singletons)
+			}
+			if !opt.Args()[0].Unify(value) {
+				return nil, false, nil
+			}
+		}
+		return nil, true, nil
+	},
+}
@@ -0,0 +1,139 @@
+package builtin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestTermToAtom(t *testing.T) {
+	p := DefaultProg()
+	termToAtom := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("term_to_atom", a, b) }
+
+	tests := []struct {
+		term string
+		atom syntax.Atom
+	}{
+		{"f(1,2)", "f(1,2)"},
+		{"'hello world'", "'hello world'"},
+		{"[a,b|c]", "[a,b|c]"},
+		{"1+2*3", "1+2*3"},
+		{"f(X,Y,X)", "f(_G0,_G1,_G0)"},
+	}
+	for _, test := range tests {
+		a := syntax.NewVariable("A")
+		testSolutions(t, p, a, goal(termToAtom(parseTerm(t, test.term), a)), test.atom)
+	}
+
+	// parse an atom
+	for _, test := range []struct{ atom, exp string }{
+		{"f(1,2)", "f(1,2)"},
+		{"f(X, g(Y), X)", "f(X,g(Y),X)"},
+		{"a:-b,c", "(a:-b,c)"},
+		{"[1,2|T]", "[1,2|T]"},
+		{"f(x).", "f(x)"},
+	} {
+		x := syntax.NewVariable("X")
+		got := solutions(t, p, x, termToAtom(x, syntax.Atom(test.atom)))
+		if exp := parseTerm(t, test.exp); len(got) != 1 || !variant(got[0], exp) {
+			t.Errorf("term_to_atom(X, %q): expected %s got %s", test.atom, exp, got)
+		}
+	}
+
+	// round trip
+	x, a := syntax.NewVariable("X"), syntax.NewVariable("A")
+	in := parseTerm(t, "f(X, 'A b', [1.5|T], -(1), - 1, X)")
+	got := solutions(t, p, x, termToAtom(in, a), termToAtom(x, a))
+	if len(got) != 1 || !variant(got[0], in) {
+		t.Errorf("expected %s to be read back, got %s", in, got)
+	}
+
+	testCalls(t, TermToAtom2, []callTest{
+		{args: args(syntax.Atom("a"), syntax.Atom("b")), matches: false},
+		{args: args(syntax.NewVariable("X"), syntax.Atom("f(")), err: true},
+		{args: args(syntax.NewVariable("X"), syntax.Integer(1)), err: true},
+	})
+}
+
+func TestAtomToTerm(t *testing.T) {
+	p := DefaultProg()
+	tests := []struct {
+		atom syntax.Atom
+		exp  string
+	}{
+		{"f(X,1)", "f(X,1)-['X'=X]"},
+		{"g(B, A, B, _)", "g(B,A,B,_)-['B'=B,'A'=A]"},
+		{"foo", "foo-[]"},
+	}
+	for _, test := range tests {
+		term, bs, r := syntax.NewVariable("T"), syntax.NewVariable("Bs"), syntax.NewVariable("R")
+		got := solutions(t, p, r,
+			syntax.NewCompound("atom_to_term", test.atom, term, bs),
+			syntax.NewCompound("=", r, syntax.NewCompound("-", term, bs)))
+		if exp := parseTerm(t, test.exp); len(got) != 1 || !variant(got[0], exp) {
+			t.Errorf("atom_to_term(%s, T, Bs): expected T-Bs = %s got %s", test.atom, exp, got)
+		}
+	}
+
+	testCalls(t, AtomToTerm3, []callTest{
+		{args: args(syntax.Atom("f(a)"), parseTerm(t, "f(b)"), syntax.NewVariable("Bs")), matches: false},
+		{args: args(syntax.NewVariable("A"), syntax.NewVariable("T"), syntax.NewVariable("Bs")), err: true},
+		{args: args(syntax.Atom("f(,)"), syntax.NewVariable("T"), syntax.NewVariable("Bs")), err: true},
+	})
+}
+
+func TestRead(t *testing.T) {
+	p := DefaultProg()
+	p.SetInput(strings.NewReader(`
+		foo(X, Y, X).
+		'hello world'. [1,
+			2].
+	`))
+	for _, exp := range []string{"foo(A, B, A)", "'hello world'", "[1, 2]", "end_of_file", "end_of_file"} {
+		x := syntax.NewVariable("X")
+		got := solutions(t, p, x, syntax.NewCompound("read", x))
+		if len(got) != 1 || !variant(got[0], parseTerm(t, exp)) {
+			t.Errorf("read(X): expected %s got %s", exp, got)
+		}
+	}
+
+	p.SetInput(strings.NewReader("foo(. bar."))
+	if _, _, err := p.Query(syntax.NewGoal(syntax.NewCompound("read", syntax.NewVariable("X")))).First(); err == nil {
+		t.Errorf("expected syntax error")
+	}
+}
+
+func TestReadTerm(t *testing.T) {
+	p := DefaultProg()
+	p.SetInput(strings.NewReader("f(X, _Y, Z, X, _).\nfoo."))
+	opt := func(name syntax.Atom, v syntax.Term) syntax.Term { return syntax.NewCompound(name, v) }
+	term, vars, names, singletons, r := syntax.NewVariable("T"), syntax.NewVariable("Vs"),
+		syntax.NewVariable("Ns"), syntax.NewVariable("Ss"), syntax.NewVariable("R")
+	got := solutions(t, p, r,
+		syntax.NewCompound("read_term", term, list(
+			opt("variables", vars),
+			opt("variable_names", names),
+			opt("singletons", singletons),
+		)),
+		syntax.NewCompound("=", r, list(term, vars, names, singletons)))
+	exp := parseTerm(t, "[f(X, Y, Z, X, A), [X, Y, Z, A], ['X'=X, '_Y'=Y, 'Z'=Z], ['_Y'=Y, 'Z'=Z]]")
+	if len(got) != 1 || !variant(got[0], exp) {
+		t.Errorf("read_term: expected %s got %s", exp, got)
+	}
+
+	x := syntax.NewVariable("X")
+	testSolutions(t, p, x, goal(syntax.NewCompound("read_term", x, syntax.EmptyList)), syntax.Atom("foo"))
+
+	for _, opts := range []syntax.Term{
+		list(syntax.Atom("foo")),
+		list(opt("foo", syntax.NewVariable("X"))),
+		list(syntax.NewVariable("O")),
+		syntax.NewVariable("Opts"),
+	} {
+		g := syntax.NewCompound("read_term", syntax.NewVariable("T"), opts)
+		if _, _, err := p.Query(syntax.NewGoal(g)).First(); err == nil {
+			t.Errorf("%s: expected error", g)
+		}
+	}
+}
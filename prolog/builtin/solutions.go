@@ -0,0 +1,180 @@
+package builtin
+
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Finding all solutions to a goal, see http://www.swi-prolog.org/pldoc/man?section=allsolutions
+
+// findall evaluates goal, returning a copy of template for each solution.
+// The goal is evaluated on a copy of the arguments, so no bindings are made
+// to the caller's variables.
+func findall(p *syntax.Prog, template, goal syntax.Term) ([]syntax.Term, error) {
+	cp := syntax.Copy(syntax.NewCompound("findall", template, goal)).(*syntax.Compound).Args()
+	template, goal = cp[0], cp[1]
+
+	r := p.Query(toGoal(goal))
+	defer r.Close()
+	var results []syntax.Term
+	for r.Next() {
+		results = append(results, syntax.Copy(template))
+	}
+	return results, r.Err()
+}
+
+// Findall3 implements findall(Template, Goal, List), unifying List with a list
+// of the instances of Template for each solution of Goal. If Goal has no
+// solutions, List is unified with the empty list.
+var Findall3 syntax.Clause = &builtin{
+	name:  "findall",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		results, err := findall(p, args[0], args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[2].Unify(syntax.NewList(results)), nil
+	},
+}
+
+// existential strips the existentially quantified variables from a goal of
+// the form 'V^Goal', returning the goal and the terms holding the variables.
+func existential(goal syntax.Term) (syntax.Term, []syntax.Term) {
+	var quantified []syntax.Term
+	for {
+		c, ok := deref(goal).(*syntax.Compound)
+		if !ok || c.Functor() != "^" || len(c.Args()) != 2 {
+			return goal, quantified
+		}
+		args := c.Args()
+		quantified = append(quantified, args[0])
+		goal = args[1]
+	}
+}
+
+// Bagof3 implements bagof(Template, Goal, Bag). Like findall/3 it collects the
+// instances of Template for each solution of Goal, but solutions are grouped
+// by the bindings of the free variables of Goal, those which don't occur in
+// Template. bagof backtracks over each group, and fails if Goal has no
+// solutions.
+//
+// Variables can be excluded from grouping with '^', for example
+// 'bagof(X, Y^foo(X, Y), Bag)'.
+var Bagof3 syntax.Clause = &generator{
+	name:  "bagof",
+	nArgs: 3,
+	generate: func(p *syntax.Prog, args []syntax.Term) func() (*syntax.Goal, bool, error) {
+		template, bag := args[0], args[2]
+		goal, quantified := existential(args[1])
+
+		bound := map[*syntax.Variable]bool{}
+		for _, v := range termVars(syntax.NewCompound("^", append(quantified, template)...)) {
+			bound[v] = true
+		}
+		var free []syntax.Term
+		for _, v := range termVars(goal) {
+			if !bound[v] {
+				free = append(free, v)
+			}
+		}
+		witness := syntax.NewCompound("$witness", free...)
+
+		var pairs []syntax.Term // solutions of the form 'Witness-Template'
+		evaluated := false
+		return func() (*syntax.Goal, bool, error) {
+			if !evaluated {
+				evaluated = true
+				var err error
+				pairs, err = findall(p, syntax.NewCompound("-", witness, template), goal)
+				if err != nil {
+					return nil, false, err
+				}
+			}
+			for len(pairs) > 0 {
+				// collect the solutions whose witness is a variant of the
+				// first remaining witness
+				w := pairs[0].(*syntax.Compound).Args()[0]
+				var targets, witnesses, items, rest []syntax.Term
+				for _, pair := range pairs {
+					pairArgs := pair.(*syntax.Compound).Args()
+					if variant(w, pairArgs[0]) {
+						targets = append(targets, witness)
+						witnesses = append(witnesses, pairArgs[0])
+						items = append(items, pairArgs[1])
+					} else {
+						rest = append(rest, pair)
+					}
+				}
+				pairs = rest
+
+				// unify the free variables with each witness of the group,
+				// so variables they hold are shared
+				target := syntax.NewCompound("$group", append(targets, bag)...)
+				group := syntax.NewCompound("$group", append(witnesses, syntax.NewList(items))...)
+				if unifies(target, group) {
+					target.Unify(group)
+					return nil, true, nil
+				}
+			}
+			return nil, false, nil
+		}
+	},
+}
+
+// AggregateAll3 implements aggregate_all(Spec, Goal, Result), aggregating the
+// solutions of Goal as directed by Spec:
+//
+//	count      the number of solutions
+//	sum(Expr)  the sum of the values of the arithmetic expression Expr
+//	max(Expr)  the largest value of Expr, failing if there are no solutions
+//	min(Expr)  the smallest value of Expr, failing if there are no solutions
+//	bag(T)     a list of the instances of T, like findall/3
+//	set(T)     a sorted list of the instances of T without duplicates
+var AggregateAll3 syntax.Clause = &builtin{
+	name:  "aggregate_all",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		spec, goal := deref(args[0]), args[1]
+		if spec == syntax.Atom("count") {
+			results, err := findall(p, syntax.Atom("x"), goal)
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, args[2].Unify(syntax.Integer(len(results))), nil
+		}
+
+		c, ok := spec.(*syntax.Compound)
+		if !ok || len(c.Args()) != 1 {
+			return nil, false, aggregateSpecErr(spec)
+		}
+		results, err := findall(p, c.Args()[0], goal)
+		if err != nil {
+			return nil, false, err
+		}
+		var result syntax.Term
+		switch c.Functor() {
+		case "sum":
+			if result, err = foldArith("+", results); result == nil && err == nil {
+				result = syntax.Integer(0)
+			}
+		case "max", "min":
+			result, err = foldArith(c.Functor(), results)
+		case "bag":
+			result = syntax.NewList(results)
+		case "set":
+			result, err = sortList(syntax.NewList(results), true)
+		default:
+			return nil, false, aggregateSpecErr(spec)
+		}
+		if err != nil || result == nil {
+			return nil, false, err
+		}
+		return nil, args[2].Unify(result), nil
+	},
+}
+
+// aggregateSpecErr returns the error for an unknown aggregate_all/3 spec.
+func aggregateSpecErr(spec syntax.Term) error {
+	if _, ok := spec.(*syntax.Variable); ok {
+		return instantiationErr()
+	}
+	return domainErr("aggregate_spec", spec)
+}
@@ -0,0 +1,161 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestFindall(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		age(peter, 7).
+		age(ann, 11).
+		age(pat, 8).
+	`)
+	one, two, three := syntax.Integer(1), syntax.Integer(2), syntax.Integer(3)
+	findall := func(template, goal, list syntax.Term) syntax.Term {
+		return syntax.NewCompound("findall", template, goal, list)
+	}
+
+	x, xs := syntax.NewVariable("X"), syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(findall(x, syntax.NewCompound("member", x, list(one, two, three)), xs)),
+		list(one, two, three))
+	if x.Value() != nil {
+		t.Errorf("findall bound X to %s", x.Value())
+	}
+
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs, goal(findall(x, syntax.Atom("fail"), xs)), syntax.EmptyList)
+
+	// templates can be any term
+	name, age := syntax.NewVariable("Name"), syntax.NewVariable("Age")
+	xs = syntax.NewVariable("Xs")
+	testSolutions(t, p, xs,
+		goal(findall(syntax.NewCompound("-", age, name), syntax.NewCompound("age", name, age), xs)),
+		list(
+			syntax.NewCompound("-", syntax.Integer(7), syntax.Atom("peter")),
+			syntax.NewCompound("-", syntax.Integer(11), syntax.Atom("ann")),
+			syntax.NewCompound("-", syntax.Integer(8), syntax.Atom("pat")),
+		))
+
+	// findall is deterministic, and fails if the list doesn't unify
+	if n := countSolutions(t, syntax.NewGoal(findall(x, syntax.Atom("true"), syntax.EmptyList))); n != 0 {
+		t.Errorf("expected findall to fail")
+	}
+
+	r := p.Query(syntax.NewGoal(findall(x, syntax.NewVariable("G"), xs)))
+	if r.Next() || r.Err() == nil {
+		t.Errorf("expected error for unbound goal")
+	}
+}
+
+func TestBagof(t *testing.T) {
+	p := DefaultProg()
+	consult(t, p, `
+		class(a, x).
+		class(b, y).
+		class(c, x).
+		class(d, z).
+		class(e, y).
+	`)
+	bagof := func(template, goal, bag syntax.Term) syntax.Term {
+		return syntax.NewCompound("bagof", template, goal, bag)
+	}
+	a, b, c, d, e := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("c"), syntax.Atom("d"), syntax.Atom("e")
+
+	// group by the free variable C
+	n, cls, l := syntax.NewVariable("N"), syntax.NewVariable("C"), syntax.NewVariable("L")
+	all, err := p.Query(syntax.NewGoal(bagof(n, syntax.NewCompound("class", n, cls), l))).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []struct{ class, bag syntax.Term }{
+		{syntax.Atom("x"), list(a, c)},
+		{syntax.Atom("y"), list(b, e)},
+		{syntax.Atom("z"), list(d)},
+	}
+	if len(all) != len(exp) {
+		t.Fatalf("expected %d groups, got %v", len(exp), all)
+	}
+	for i, bindings := range all {
+		if bindings[cls] != exp[i].class || syntax.Compare(bindings[l], exp[i].bag) != 0 {
+			t.Errorf("group %d: expected C = %s, L = %s, got %v", i, exp[i].class, exp[i].bag, bindings)
+		}
+	}
+
+	// C^ excludes C from grouping
+	l = syntax.NewVariable("L")
+	testSolutions(t, p, l,
+		goal(bagof(n, syntax.NewCompound("^", cls, syntax.NewCompound("class", n, cls)), l)),
+		list(a, b, c, d, e))
+
+	// bound free variables select a single group
+	l = syntax.NewVariable("L")
+	testSolutions(t, p, l,
+		goal(bagof(n, syntax.NewCompound("class", n, syntax.Atom("y")), l)),
+		list(b, e))
+
+	// unlike findall, bagof fails if there are no solutions
+	l = syntax.NewVariable("L")
+	testSolutions(t, p, l, goal(bagof(n, syntax.NewCompound("class", n, syntax.Atom("w")), l)))
+	testSolutions(t, p, l, goal(bagof(n, syntax.Atom("fail"), l)))
+
+	// later goals can backtrack into bagof
+	l = syntax.NewVariable("L")
+	testSolutions(t, p, l, goal(
+		bagof(n, syntax.NewCompound("class", n, cls), l),
+		syntax.NewCompound("==", cls, syntax.Atom("z")),
+	), list(d))
+}
+
+func TestAggregateAll(t *testing.T) {
+	p := DefaultProg()
+	agg := func(spec, g syntax.Term, r *syntax.Variable) []syntax.Term {
+		return goal(syntax.NewCompound("aggregate_all", spec, g, r))
+	}
+	member := func(x, l syntax.Term) syntax.Term { return syntax.NewCompound("member", x, l) }
+	mixed := list(syntax.Integer(3), syntax.Float64(1.5), syntax.Integer(2))
+	atoms := list(syntax.Atom("b"), syntax.Atom("a"), syntax.Atom("b"))
+
+	tests := []struct {
+		spec func(x syntax.Term) syntax.Term
+		list syntax.Term
+		exp  syntax.Term // nil if no solutions are expected
+	}{
+		{func(x syntax.Term) syntax.Term { return syntax.Atom("count") }, atoms, syntax.Integer(3)},
+		{func(x syntax.Term) syntax.Term { return syntax.Atom("count") }, syntax.EmptyList, syntax.Integer(0)},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("sum", x) }, ints(1, 2, 3), syntax.Integer(6)},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("sum", x) }, mixed, syntax.Float64(6.5)},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("sum", x) }, syntax.EmptyList, syntax.Integer(0)},
+		{func(x syntax.Term) syntax.Term {
+			return syntax.NewCompound("sum", syntax.NewCompound("*", x, syntax.Integer(2)))
+		}, ints(1, 2, 3), syntax.Integer(12)},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("max", x) }, mixed, syntax.Integer(3)},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("max", x) }, syntax.EmptyList, nil},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("min", x) }, mixed, syntax.Float64(1.5)},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("bag", x) }, atoms, atoms},
+		{func(x syntax.Term) syntax.Term { return syntax.NewCompound("set", x) }, atoms, list(syntax.Atom("a"), syntax.Atom("b"))},
+	}
+	for _, test := range tests {
+		x, r := syntax.NewVariable("X"), syntax.NewVariable("R")
+		g := agg(test.spec(x), member(x, test.list), r)
+		if test.exp == nil {
+			testSolutions(t, p, r, g)
+		} else {
+			testSolutions(t, p, r, g, test.exp)
+		}
+	}
+
+	for _, spec := range []syntax.Term{
+		syntax.NewVariable("S"),
+		syntax.Atom("total"),
+		syntax.NewCompound("avg", syntax.NewVariable("X")),
+		syntax.NewCompound("sum", syntax.Atom("a")),
+	} {
+		g := agg(spec, member(syntax.Atom("a"), list(syntax.Atom("a"))), syntax.NewVariable("R"))
+		if _, _, err := p.Query(syntax.NewGoal(g[0])).First(); err == nil {
+			t.Errorf("%s: expected error", g[0])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package builtin
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Strings, see http://www.swi-prolog.org/pldoc/man?section=strings
+//
+// Double-quoted text is read as a string. The string predicates also accept
+// atoms and numbers as text, like atomic_list_concat/2.
+
+// stringTerm returns the term representing the string s.
+func stringTerm(s string) syntax.Term {
+	return syntax.String(s)
+}
+
+// StringChars2 implements string_chars(String, Chars), where Chars is the
+// list of characters of String as single character atoms. If String is
+// unbound, it's constructed from Chars.
+var StringChars2 syntax.Clause = &builtin{
+	name:  "string_chars",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := atomicText(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, unifyText(args[1], s, chars), nil
+		}
+		s, err := charsToString(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(stringTerm(s)), nil
+	},
+}
+
+// StringCodes2 implements string_codes(String, Codes), where Codes is the
+// list of character codes of String. If String is unbound, it's constructed
+// from Codes.
+var StringCodes2 syntax.Clause = &builtin{
+	name:  "string_codes",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		if _, ok := deref(args[0]).(*syntax.Variable); !ok {
+			s, err := atomicText(args[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, unifyText(args[1], s, codes), nil
+		}
+		s, err := codesToString(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, args[0].Unify(stringTerm(s)), nil
+	},
+}
+
+// StringLength2 implements string_length(String, Length), unifying Length
+// with the number of characters of String.
+var StringLength2 syntax.Clause = &builtin{
+	name:  "string_length",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		s, err := atomicText(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		if err := lengthArg(args[1]); err != nil {
+			return nil, false, err
+		}
+		return nil, args[1].Unify(syntax.Integer(utf8.RuneCountInString(s))), nil
+	},
+}
+
+// SplitString4 implements split_string(String, SepChars, PadChars, SubStrings).
+// String is split at each occurrence of any of the characters of SepChars,
+// and the characters of PadChars are removed from the start and end of each
+// substring. Padding is first removed from String itself, so
+//
+//	split_string(" a b ", " ", " ", L)
+//
+// gives L = ["a", "b"]. Empty substrings between adjacent separators are
+// kept, unless the separators are also padding, in which case they act as a
+// single separator:
+//
+//	split_string("/home//jan", "/", "/", L)
+//
+// gives L = ["home", "jan"]. If SepChars is empty, String is only stripped
+// of padding.
+var SplitString4 syntax.Clause = &builtin{
+	name:  "split_string",
+	nArgs: 4,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		var text [3]string
+		for i := range text {
+			s, err := atomicText(args[i])
+			if err != nil {
+				return nil, false, err
+			}
+			text[i] = s
+		}
+		s, sep, pad := text[0], text[1], text[2]
+		isSep := func(r rune) bool { return strings.ContainsRune(sep, r) }
+		s = strings.Trim(s, pad)
+
+		var parts []string
+		if sep == "" {
+			parts = []string{s}
+		} else {
+			for {
+				// padding is skipped before looking for the next separator,
+				// so separators which are also padding aren't split on
+				s = strings.TrimLeft(s, pad)
+				i := strings.IndexFunc(s, isSep)
+				if i < 0 {
+					parts = append(parts, s)
+					break
+				}
+				parts = append(parts, s[:i])
+				_, size := utf8.DecodeRuneInString(s[i:])
+				s = s[i+size:]
+			}
+		}
+		terms := make([]syntax.Term, len(parts))
+		for i, part := range parts {
+			terms[i] = stringTerm(strings.Trim(part, pad))
+		}
+		return nil, args[3].Unify(syntax.NewList(terms)), nil
+	},
+}
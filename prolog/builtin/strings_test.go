@@ -0,0 +1,108 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestStringChars(t *testing.T) {
+	v := func() *syntax.Variable { return syntax.NewVariable("X") }
+	chs := func(s ...string) syntax.Term {
+		var terms []syntax.Term
+		for _, c := range s {
+			terms = append(terms, syntax.Atom(c))
+		}
+		return syntax.NewList(terms)
+	}
+	testCalls(t, StringChars2, []callTest{
+		{args: args(syntax.Atom("abc"), chs("a", "b", "c")), matches: true},
+		{args: args(syntax.Atom("héllo"), chs("h", "é", "l", "l", "o")), matches: true},
+		{args: args(syntax.Atom(""), syntax.EmptyList), matches: true},
+		{args: args(syntax.Integer(12), chs("1", "2")), matches: true},
+		{args: args(v(), chs("日", "本")), matches: true},
+		{args: args(syntax.Atom("ab"), chs("a")), matches: false},
+		{args: args(v(), syntax.String("ab")), matches: true},
+		{args: args(v(), v()), err: true},
+		{args: args(v(), chs("ab")), err: true},
+		{args: args(syntax.NewCompound("f", syntax.Atom("a")), v()), err: true},
+	})
+
+	x := v()
+	testSolutions(t, DefaultProg(), x, goal(syntax.NewCompound("string_chars", x, chs("日", "本"))), syntax.String("日本"))
+}
+
+func TestStringCodes(t *testing.T) {
+	v := func() *syntax.Variable { return syntax.NewVariable("X") }
+	testCalls(t, StringCodes2, []callTest{
+		{args: args(syntax.Atom("abc"), ints(97, 98, 99)), matches: true},
+		{args: args(syntax.Atom("é€"), ints(233, 8364)), matches: true},
+		{args: args(syntax.Atom("😀"), ints(128512)), matches: true},
+		{args: args(v(), ints(104, 105)), matches: true},
+		{args: args(syntax.Atom("a"), ints(98)), matches: false},
+		{args: args(syntax.Atom("a"), syntax.String("a")), matches: true},
+		{args: args(v(), syntax.String("hi")), matches: true},
+		{args: args(v(), v()), err: true},
+		{args: args(v(), ints(-1)), err: true},
+		{args: args(v(), syntax.NewList([]syntax.Term{syntax.Atom("a")})), err: true},
+	})
+
+	x := v()
+	testSolutions(t, DefaultProg(), x, goal(syntax.NewCompound("string_codes", x, ints(233, 8364))), syntax.String("é€"))
+	x = v()
+	testSolutions(t, DefaultProg(), x, goal(syntax.NewCompound("string_codes", syntax.Atom("日本"), x)), ints(26085, 26412))
+}
+
+func TestStringLength(t *testing.T) {
+	v := func() *syntax.Variable { return syntax.NewVariable("L") }
+	testCalls(t, StringLength2, []callTest{
+		{args: args(syntax.Atom("hello"), syntax.Integer(5)), matches: true},
+		{args: args(syntax.Atom("日本語"), syntax.Integer(3)), matches: true},
+		{args: args(syntax.Atom(""), syntax.Integer(0)), matches: true},
+		{args: args(syntax.Integer(123), syntax.Integer(3)), matches: true},
+		{args: args(syntax.Atom("hello"), syntax.Integer(4)), matches: false},
+		{args: args(syntax.Atom("hello"), v()), matches: true},
+		{args: args(v(), syntax.Integer(4)), err: true},
+		{args: args(syntax.Atom("a"), syntax.Integer(-1)), err: true},
+	})
+}
+
+func TestSplitString(t *testing.T) {
+	p := DefaultProg()
+	strs := func(s ...string) syntax.Term {
+		var terms []syntax.Term
+		for _, str := range s {
+			terms = append(terms, syntax.String(str))
+		}
+		return syntax.NewList(terms)
+	}
+	tests := []struct {
+		s, sep, pad string
+		exp         syntax.Term
+	}{
+		{"a,b,,c", ",", "", strs("a", "b", "", "c")},
+		{" hello world ", " ", " ", strs("hello", "world")},
+		{"SWI-Prolog, 7.0", ",", " ", strs("SWI-Prolog", "7.0")},
+		{"a.b;c", ".;", "", strs("a", "b", "c")},
+		{"  padded  ", "", " ", strs("padded")},
+		{"", ",", "", strs("")},
+		{",", ",", "", strs("", "")},
+		{"a→b→c", "→", "", strs("a", "b", "c")},
+		{"/home//jan/", "/", "", strs("", "home", "", "jan", "")},
+		{"/home//jan", "/", "/", strs("home", "jan")},
+		{"//a//b//", "/", "/", strs("a", "b")},
+		{"a, ,b", ",", " ", strs("a", "", "b")},
+	}
+	for _, test := range tests {
+		x := syntax.NewVariable("X")
+		g := syntax.NewCompound("split_string", syntax.Atom(test.s), syntax.Atom(test.sep), syntax.Atom(test.pad), x)
+		testSolutions(t, p, x, goal(g), test.exp)
+	}
+
+	testCalls(t, SplitString4, []callTest{
+		{args: args(syntax.Integer(123), syntax.Atom("2"), syntax.Atom(""), strs("1", "3")), matches: true},
+		{args: args(syntax.Atom("a,b"), syntax.Atom(","), syntax.Atom(""), strs("a,b")), matches: false},
+		{args: args(syntax.NewVariable("S"), syntax.Atom(","), syntax.Atom(""), syntax.NewVariable("L")), err: true},
+		{args: args(syntax.Atom("a"), syntax.NewCompound("f", syntax.Atom("a")), syntax.Atom(""), syntax.NewVariable("L")), err: true},
+	})
+}
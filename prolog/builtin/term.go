@@ -0,0 +1,235 @@
+package builtin
+
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Analysing and constructing terms, see http://www.swi-prolog.org/pldoc/man?section=manipterm
+
+// Functor3 implements functor(Term, Name, Arity). If Term is bound, Name and
+// Arity are unified with its name and number of arguments. Atomic terms have
+// themselves as a name and an arity of 0. If Term is unbound, it's unified
+// with a new term with the given name and fresh variables as arguments.
+var Functor3 syntax.Clause = &builtin{
+	name:  "functor",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		switch t := deref(args[0]).(type) {
+		case *syntax.Variable:
+			name, arity := deref(args[1]), deref(args[2])
+			if _, ok := name.(*syntax.Variable); ok {
+				return nil, false, instantiationErr()
+			}
+			if _, ok := arity.(*syntax.Variable); ok {
+				return nil, false, instantiationErr()
+			}
+			n, ok := arity.(syntax.Integer)
+			if !ok {
+				return nil, false, typeErr("integer", arity)
+			}
+			if n < 0 {
+				return nil, false, domainErr("not_less_than_zero", arity)
+			}
+			if _, ok := name.(*syntax.Compound); ok {
+				return nil, false, typeErr("atomic", name)
+			}
+			if n == 0 {
+				return nil, t.Unify(name), nil
+			}
+			functor, ok := name.(syntax.Atom)
+			if !ok {
+				return nil, false, typeErr("atom", name)
+			}
+			vars := make([]syntax.Term, n)
+			for i := range vars {
+				vars[i] = syntax.NewVariable("_")
+			}
+			return nil, t.Unify(syntax.NewCompound(functor, vars...)), nil
+		case *syntax.Compound:
+			return nil, args[1].Unify(t.Functor()) && args[2].Unify(syntax.Integer(len(t.Args()))), nil
+		default:
+			return nil, args[1].Unify(t) && args[2].Unify(syntax.Integer(0)), nil
+		}
+	},
+}
+
+// Arg3 implements arg(N, Term, Arg), unifying Arg with the Nth argument of
+// Term. Arguments are numbered from 1. As in ISO Prolog, an N of 0 or greater
+// than the arity of Term fails, while a negative N is a domain error.
+var Arg3 syntax.Clause = &builtin{
+	name:  "arg",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		n, t := deref(args[0]), deref(args[1])
+		for _, arg := range []syntax.Term{n, t} {
+			if _, ok := arg.(*syntax.Variable); ok {
+				return nil, false, instantiationErr()
+			}
+		}
+		i, ok := n.(syntax.Integer)
+		if !ok {
+			return nil, false, typeErr("integer", n)
+		}
+		c, ok := t.(*syntax.Compound)
+		if !ok {
+			return nil, false, typeErr("compound", t)
+		}
+		if i < 0 {
+			return nil, false, domainErr("not_less_than_zero", n)
+		}
+		cArgs := c.Args()
+		if i == 0 || int(i) > len(cArgs) {
+			return nil, false, nil
+		}
+		return nil, args[2].Unify(cArgs[i-1]), nil
+	},
+}
+
+// Univ2 implements '=..', converting between a term and a list of its name
+// followed by its arguments. For example 'foo(a, b) =.. [foo, a, b]'.
+var Univ2 syntax.Clause = &builtin{
+	name:  "=..",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		switch t := deref(args[0]).(type) {
+		case *syntax.Variable:
+			elems, err := syntax.ListToSlice(args[1])
+			if err != nil {
+				return nil, false, err
+			}
+			if len(elems) == 0 {
+				return nil, false, domainErr("non_empty_list", args[1])
+			}
+			name := deref(elems[0])
+			switch name := name.(type) {
+			case *syntax.Variable:
+				return nil, false, instantiationErr()
+			case *syntax.Compound:
+				return nil, false, typeErr("atomic", name)
+			case syntax.Atom:
+				if len(elems) == 1 {
+					return nil, t.Unify(name), nil
+				}
+				return nil, t.Unify(syntax.NewCompound(name, elems[1:]...)), nil
+			}
+			if len(elems) > 1 {
+				return nil, false, typeErr("atom", name)
+			}
+			return nil, t.Unify(name), nil
+		case *syntax.Compound:
+			elems := append([]syntax.Term{t.Functor()}, t.Args()...)
+			return nil, args[1].Unify(syntax.NewList(elems)), nil
+		default:
+			return nil, args[1].Unify(syntax.NewList([]syntax.Term{t})), nil
+		}
+	},
+}
+
+// CopyTerm2 implements copy_term(Original, Copy), unifying Copy with a copy
+// of Original in which all unbound variables have been replaced by fresh
+// ones. The fresh variables hold copies of the attributes of the originals.
+var CopyTerm2 syntax.Clause = &builtin{
+	name:  "copy_term",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, args[1].Unify(syntax.Copy(args[0])), nil
+	},
+}
+
+// TermVariables2 implements term_variables(Term, Vars), unifying Vars with
+// the list of unbound variables in Term, in the order they first appear.
+var TermVariables2 syntax.Clause = &builtin{
+	name:  "term_variables",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		var vars []syntax.Term
+		for _, v := range termVars(args[0]) {
+			vars = append(vars, v)
+		}
+		return nil, args[1].Unify(syntax.NewList(vars)), nil
+	},
+}
+
+// Numbervars3 implements numbervars(Term, Start, End), binding each unbound
+// variable of Term to '$VAR'(N), numbering from Start. End is unified with
+// the next unused number. The write builtins print these terms as variable
+// names.
+var Numbervars3 syntax.Clause = &builtin{
+	name:  "numbervars",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		n, ok, err := intArg(args[1])
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			return nil, false, instantiationErr()
+		}
+		for _, v := range termVars(args[0]) {
+			v.Unify(syntax.NewCompound("$VAR", n))
+			n++
+		}
+		return nil, args[2].Unify(n), nil
+	},
+}
+
+// termVars returns the unbound variables of a term, in depth-first,
+// left-to-right order of their first occurrence.
+func termVars(t syntax.Term) []*syntax.Variable {
+	var vars []*syntax.Variable
+	seen := map[*syntax.Variable]bool{}
+	walked := map[*syntax.Variable]bool{} // bound variables, t may be cyclic
+	syntax.Walk(t, func(t syntax.Term) bool {
+		v, ok := t.(*syntax.Variable)
+		if !ok {
+			return true
+		}
+		if u, ok := deref(v).(*syntax.Variable); ok {
+			if !seen[u] {
+				seen[u] = true
+				vars = append(vars, u)
+			}
+			return false
+		}
+		if walked[v] {
+			return false
+		}
+		walked[v] = true
+		return true
+	})
+	return vars
+}
+
+// variant reports whether two terms are equal up to the renaming of their
+// variables, for example 'f(X, Y, X)' and 'f(A, B, A)'.
+func variant(a, b syntax.Term) bool {
+	ab := map[*syntax.Variable]*syntax.Variable{}
+	ba := map[*syntax.Variable]*syntax.Variable{}
+	var eq func(a, b syntax.Term) bool
+	eq = func(a, b syntax.Term) bool {
+		a, b = deref(a), deref(b)
+		switch a := a.(type) {
+		case *syntax.Variable:
+			b, ok := b.(*syntax.Variable)
+			if !ok {
+				return false
+			}
+			if ab[a] == nil && ba[b] == nil {
+				ab[a], ba[b] = b, a
+			}
+			return ab[a] == b && ba[b] == a
+		case *syntax.Compound:
+			b, ok := b.(*syntax.Compound)
+			if !ok || a.Functor() != b.Functor() || len(a.Args()) != len(b.Args()) {
+				return false
+			}
+			bArgs := b.Args()
+			for i, arg := range a.Args() {
+				if !eq(arg, bArgs[i]) {
+					return false
+				}
+			}
+			return true
+		}
+		return syntax.Compare(a, b) == 0
+	}
+	return eq(a, b)
+}
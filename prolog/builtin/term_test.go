@@ -0,0 +1,217 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// callTest describes a single call of a deterministic builtin.
+type callTest struct {
+	args    []syntax.Term
+	matches bool
+	err     bool // if set, an error is expected
+}
+
+func testCalls(t *testing.T, clause syntax.Clause, tests []callTest) {
+	for _, test := range tests {
+		_, matches, err := clause.Call(syntax.NewProg(), test.args)
+		switch {
+		case test.err && err == nil:
+			t.Errorf("%s%s: expected error", clause, test.args)
+		case !test.err && err != nil:
+			t.Errorf("%s%s: %v", clause, test.args, err)
+		case matches != test.matches:
+			t.Errorf("%s%s: expected %t got %t", clause, test.args, test.matches, matches)
+		}
+	}
+}
+
+func args(terms ...syntax.Term) []syntax.Term { return terms }
+
+func TestFunctor(t *testing.T) {
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	a, foo := syntax.Atom("a"), syntax.Atom("foo")
+	fab := syntax.NewCompound("foo", a, syntax.Atom("b"))
+
+	testCalls(t, Functor3, []callTest{
+		{args: args(fab, foo, syntax.Integer(2)), matches: true},
+		{args: args(fab, foo, syntax.Integer(1)), matches: false},
+		{args: args(fab, a, syntax.Integer(2)), matches: false},
+		{args: args(fab, v(), v()), matches: true},
+		{args: args(foo, foo, syntax.Integer(0)), matches: true},
+		{args: args(syntax.Integer(3), syntax.Integer(3), syntax.Integer(0)), matches: true},
+		{args: args(foo, foo, syntax.Integer(1)), matches: false},
+		{args: args(v(), foo, syntax.Integer(2)), matches: true},
+		{args: args(v(), syntax.Integer(1), syntax.Integer(0)), matches: true},
+
+		{args: args(v(), v(), syntax.Integer(2)), err: true},
+		{args: args(v(), foo, v()), err: true},
+		{args: args(v(), foo, a), err: true},
+		{args: args(v(), foo, syntax.Integer(-1)), err: true},
+		{args: args(v(), syntax.Integer(1), syntax.Integer(2)), err: true},
+		{args: args(v(), fab, syntax.Integer(1)), err: true},
+	})
+
+	// decompose
+	name, arity := syntax.NewVariable("Name"), syntax.NewVariable("Arity")
+	Functor3.Call(syntax.NewProg(), args(fab, name, arity))
+	if name.Value() != foo || arity.Value() != syntax.Integer(2) {
+		t.Errorf("functor(%s, Name, Arity): got Name = %s, Arity = %s", fab, name.Value(), arity.Value())
+	}
+
+	// construct
+	term := syntax.NewVariable("T")
+	Functor3.Call(syntax.NewProg(), args(term, foo, syntax.Integer(3)))
+	c, ok := term.Value().(*syntax.Compound)
+	if !ok || c.Functor() != foo || len(c.Args()) != 3 {
+		t.Fatalf("functor(T, foo, 3): got T = %s", term.Value())
+	}
+	for _, arg := range c.Args() {
+		if _, ok := arg.(*syntax.Variable); !ok {
+			t.Errorf("functor(T, foo, 3): expected variable arguments, got %s", arg)
+		}
+	}
+}
+
+func TestArg(t *testing.T) {
+	a, b, c := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("c")
+	fabc := syntax.NewCompound("f", a, b, c)
+
+	for i, exp := range []syntax.Term{a, b, c} {
+		x := syntax.NewVariable("X")
+		_, matches, err := Arg3.Call(syntax.NewProg(), args(syntax.Integer(i+1), fabc, x))
+		if err != nil || !matches || x.Value() != exp {
+			t.Errorf("arg(%d, %s, X): expected X = %s, got %s %t %v", i+1, fabc, exp, x.Value(), matches, err)
+		}
+	}
+
+	testCalls(t, Arg3, []callTest{
+		{args: args(syntax.Integer(2), fabc, b), matches: true},
+		{args: args(syntax.Integer(2), fabc, c), matches: false},
+		{args: args(syntax.Integer(0), fabc, syntax.NewVariable("X")), matches: false},
+		{args: args(syntax.Integer(4), fabc, syntax.NewVariable("X")), matches: false},
+
+		{args: args(syntax.Integer(-1), fabc, syntax.NewVariable("X")), err: true},
+		{args: args(a, fabc, syntax.NewVariable("X")), err: true},
+		{args: args(syntax.Float64(1), fabc, syntax.NewVariable("X")), err: true},
+		{args: args(syntax.NewVariable("N"), fabc, syntax.NewVariable("X")), err: true},
+		{args: args(syntax.Integer(1), a, syntax.NewVariable("X")), err: true},
+		{args: args(syntax.Integer(1), syntax.NewVariable("T"), syntax.NewVariable("X")), err: true},
+	})
+}
+
+func TestUniv(t *testing.T) {
+	a, b, foo := syntax.Atom("a"), syntax.Atom("b"), syntax.Atom("foo")
+	fooab := syntax.NewCompound("foo", a, b)
+
+	x := syntax.NewVariable("X")
+	Univ2.Call(syntax.NewProg(), args(fooab, x))
+	if exp := list(foo, a, b); syntax.Compare(x.Value(), exp) != 0 {
+		t.Errorf("foo(a, b) =.. X: expected X = %s got %s", exp, x.Value())
+	}
+
+	x = syntax.NewVariable("X")
+	Univ2.Call(syntax.NewProg(), args(x, list(foo, a, b)))
+	if syntax.Compare(x.Value(), fooab) != 0 {
+		t.Errorf("X =.. [foo, a, b]: expected X = %s got %s", fooab, x.Value())
+	}
+
+	x = syntax.NewVariable("X")
+	Univ2.Call(syntax.NewProg(), args(foo, x))
+	if exp := list(foo); syntax.Compare(x.Value(), exp) != 0 {
+		t.Errorf("foo =.. X: expected X = %s got %s", exp, x.Value())
+	}
+
+	v := func() *syntax.Variable { return syntax.NewVariable("V") }
+	testCalls(t, Univ2, []callTest{
+		{args: args(fooab, list(foo, a, b)), matches: true},
+		{args: args(fooab, list(foo, b, a)), matches: false},
+		{args: args(syntax.Integer(1), list(syntax.Integer(1))), matches: true},
+		{args: args(v(), list(syntax.Integer(1))), matches: true},
+		{args: args(fooab, syntax.NewCompound(".", foo, v())), matches: true},
+
+		{args: args(v(), v()), err: true},
+		{args: args(v(), syntax.NewCompound(".", foo, v())), err: true},
+		{args: args(v(), syntax.EmptyList), err: true},
+		{args: args(v(), list(v(), a)), err: true},
+		{args: args(v(), list(syntax.Integer(1), a)), err: true},
+		{args: args(v(), list(fooab, a)), err: true},
+		{args: args(v(), foo), err: true},
+	})
+}
+
+func TestCopyTerm(t *testing.T) {
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	orig := syntax.NewCompound("f", x, x, bound("B", syntax.Atom("b")))
+	_, matches, err := CopyTerm2.Call(syntax.NewProg(), args(orig, y))
+	if err != nil || !matches {
+		t.Fatalf("copy_term(%s, Y): %t %v", orig, matches, err)
+	}
+	c, ok := y.Value().(*syntax.Compound)
+	if !ok || c.Functor() != "f" || len(c.Args()) != 3 {
+		t.Fatalf("copy_term(%s, Y): got Y = %s", orig, y.Value())
+	}
+	cArgs := c.Args()
+	a, ok := cArgs[0].(*syntax.Variable)
+	if !ok || a == x || cArgs[1] != a {
+		t.Errorf("expected Y = f(A, A, b) with a fresh A, got %s", c)
+	}
+	if cArgs[2] != syntax.Atom("b") {
+		t.Errorf("expected bound variables to be copied as their values, got %s", cArgs[2])
+	}
+
+	// binding the original doesn't alter the copy
+	x.Unify(syntax.Atom("foo"))
+	if a.Value() != nil {
+		t.Errorf("binding X bound the copy to %s", a.Value())
+	}
+}
+
+func TestTermVariables(t *testing.T) {
+	x, y, vs := syntax.NewVariable("X"), syntax.NewVariable("Y"), syntax.NewVariable("Vs")
+	term := syntax.NewCompound("f", x, syntax.NewCompound("g", y, x, bound("B", syntax.Atom("b"))))
+	_, matches, err := TermVariables2.Call(syntax.NewProg(), args(term, vs))
+	if err != nil || !matches {
+		t.Fatalf("term_variables(%s, Vs): %t %v", term, matches, err)
+	}
+	got, err := syntax.ListToSlice(vs)
+	if err != nil {
+		t.Fatalf("term_variables(%s, Vs): %v", term, err)
+	}
+	if len(got) != 2 || got[0] != x || got[1] != y {
+		t.Errorf("term_variables(%s, Vs): expected Vs = [X, Y] got %s", term, vs.Value())
+	}
+
+	testCalls(t, TermVariables2, []callTest{
+		{args: args(syntax.Atom("a"), syntax.EmptyList), matches: true},
+		{args: args(syntax.Integer(1), list(syntax.NewVariable("_"))), matches: false},
+	})
+}
+
+func TestNumbervars(t *testing.T) {
+	x, y, end := syntax.NewVariable("X"), syntax.NewVariable("Y"), syntax.NewVariable("End")
+	term := syntax.NewCompound("f", x, y, x)
+	_, matches, err := Numbervars3.Call(syntax.NewProg(), args(term, syntax.Integer(0), end))
+	if err != nil || !matches {
+		t.Fatalf("numbervars(%s, 0, End): %t %v", term, matches, err)
+	}
+	for _, v := range []struct {
+		v   *syntax.Variable
+		exp syntax.Term
+	}{
+		{x, syntax.NewCompound("$VAR", syntax.Integer(0))},
+		{y, syntax.NewCompound("$VAR", syntax.Integer(1))},
+		{end, syntax.Integer(2)},
+	} {
+		if syntax.Compare(v.v.Value(), v.exp) != 0 {
+			t.Errorf("expected %s = %s got %s", v.v, v.exp, v.v.Value())
+		}
+	}
+
+	testCalls(t, Numbervars3, []callTest{
+		{args: args(syntax.Atom("a"), syntax.Integer(3), syntax.Integer(3)), matches: true},
+		{args: args(syntax.NewVariable("_"), syntax.Atom("a"), syntax.NewVariable("_")), err: true},
+		{args: args(syntax.NewVariable("_"), syntax.NewVariable("_"), syntax.NewVariable("_")), err: true},
+	})
+}
@@ -7,48 +7,150 @@ import "github.com/ericchiang/pl/prolog/syntax"
 var Var1 syntax.Clause = &builtin{
 	name:  "var",
 	nArgs: 1,
-	call: func(args []syntax.Term) (*syntax.Goal, bool) {
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
 		matches := false
 		if len(args) == 1 {
-			_, matches = args[1].(*syntax.Variable)
+			_, matches = deref(args[0]).(*syntax.Variable)
 		}
-		return nil, matches
+		return nil, matches, nil
 	},
 }
 
 var Nonvar1 syntax.Clause = &builtin{
 	name:  "nonvar",
 	nArgs: 1,
-	call: func(args []syntax.Term) (*syntax.Goal, bool) {
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
 		matches := false
 		if len(args) == 1 {
-			_, matches = args[1].(*syntax.Variable)
+			_, matches = deref(args[0]).(*syntax.Variable)
 			matches = !matches
 		}
-		return nil, matches
+		return nil, matches, nil
 	},
 }
 
 var Integer1 syntax.Clause = &builtin{
 	name:  "integer",
 	nArgs: 1,
-	call: func(args []syntax.Term) (*syntax.Goal, bool) {
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
 		matches := false
 		if len(args) == 1 {
-			_, matches = args[1].(syntax.Integer)
+			_, matches = deref(args[0]).(syntax.Integer)
 		}
-		return nil, matches
+		return nil, matches, nil
 	},
 }
 
 var Float1 syntax.Clause = &builtin{
 	name:  "float",
 	nArgs: 1,
-	call: func(args []syntax.Term) (*syntax.Goal, bool) {
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
 		matches := false
 		if len(args) == 1 {
-			_, matches = args[1].(syntax.Float64)
+			_, matches = deref(args[0]).(syntax.Float64)
 		}
-		return nil, matches
+		return nil, matches, nil
+	},
+}
+
+var Atom1 syntax.Clause = &builtin{
+	name:  "atom",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		matches := false
+		if len(args) == 1 {
+			switch t := deref(args[0]).(type) {
+			case syntax.Atom:
+				matches = true
+			case *syntax.Compound:
+				matches = len(t.Args()) == 0
+			}
+		}
+		return nil, matches, nil
+	},
+}
+
+var Number1 syntax.Clause = &builtin{
+	name:  "number",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		matches := false
+		if len(args) == 1 {
+			switch deref(args[0]).(type) {
+			case syntax.Integer, syntax.Float64:
+				matches = true
+			}
+		}
+		return nil, matches, nil
+	},
+}
+
+// String1 implements string(Term), which holds if Term is a string, such as
+// double-quoted text.
+var String1 syntax.Clause = &builtin{
+	name:  "string",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		_, ok := deref(args[0]).(syntax.String)
+		return nil, ok, nil
+	},
+}
+
+// Ground1 implements ground(Term), which holds if Term contains no unbound
+// variables. The anonymous variable is never ground.
+var Ground1 syntax.Clause = &builtin{
+	name:  "ground",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, syntax.IsGround(args[0]), nil
+	},
+}
+
+var Compound1 syntax.Clause = &builtin{
+	name:  "compound",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		c, ok := deref(args[0]).(*syntax.Compound)
+		return nil, ok && len(c.Args()) > 0, nil
+	},
+}
+
+var Atomic1 syntax.Clause = &builtin{
+	name:  "atomic",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		matches := false
+		switch t := deref(args[0]).(type) {
+		case syntax.Atom, syntax.String, syntax.Integer, syntax.Float64:
+			matches = true
+		case *syntax.Compound:
+			matches = len(t.Args()) == 0
+		}
+		return nil, matches, nil
+	},
+}
+
+var Callable1 syntax.Clause = &builtin{
+	name:  "callable",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		matches := false
+		switch deref(args[0]).(type) {
+		case syntax.Atom, *syntax.Compound:
+			matches = true
+		}
+		return nil, matches, nil
+	},
+}
+
+// IsList1 implements is_list(Term), which holds if Term is a proper list.
+// Partial lists such as '[a|T]' aren't lists, nor are cyclic lists such as
+// the value of L after 'L = [a|L]'.
+var IsList1 syntax.Clause = &builtin{
+	name:  "is_list",
+	nArgs: 1,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		_, tail := partialList(args[0])
+		return nil, tail == syntax.EmptyList, nil
 	},
 }
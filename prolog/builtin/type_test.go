@@ -0,0 +1,118 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func bound(name string, t syntax.Term) *syntax.Variable {
+	v := syntax.NewVariable(name)
+	v.Unify(t)
+	return v
+}
+
+func TestTypeChecks(t *testing.T) {
+	tests := []struct {
+		clause  syntax.Clause
+		arg     syntax.Term
+		matches bool
+	}{
+		{Var1, syntax.NewVariable("X"), true},
+		{Var1, bound("X", syntax.Atom("foo")), false},
+		{Var1, syntax.Atom("foo"), false},
+		{Var1, syntax.Integer(1), false},
+
+		{Nonvar1, syntax.NewVariable("X"), false},
+		{Nonvar1, bound("X", syntax.Atom("foo")), true},
+		{Nonvar1, syntax.Atom("foo"), true},
+
+		{Integer1, syntax.Integer(1), true},
+		{Integer1, bound("X", syntax.Integer(1)), true},
+		{Integer1, syntax.Float64(1.5), false},
+		{Integer1, syntax.Atom("foo"), false},
+		{Integer1, syntax.NewVariable("X"), false},
+
+		{Float1, syntax.Float64(1.5), true},
+		{Float1, bound("X", syntax.Float64(1.5)), true},
+		{Float1, syntax.Integer(1), false},
+		{Float1, syntax.NewVariable("X"), false},
+
+		{Atom1, syntax.Atom("foo"), true},
+		{Atom1, syntax.EmptyList, true},
+		{Atom1, bound("X", syntax.Atom("foo")), true},
+		{Atom1, syntax.NewCompound("foo", syntax.Atom("a")), false},
+		{Atom1, syntax.Integer(1), false},
+		{Atom1, syntax.String("foo"), false},
+		{Atom1, syntax.NewVariable("X"), false},
+
+		{Number1, syntax.Integer(1), true},
+		{Number1, syntax.Float64(1.5), true},
+		{Number1, bound("X", syntax.Integer(1)), true},
+		{Number1, syntax.Atom("foo"), false},
+		{Number1, syntax.String("1"), false},
+
+		{String1, syntax.String("foo"), true},
+		{String1, syntax.String(""), true},
+		{String1, bound("X", syntax.String("foo")), true},
+		{String1, syntax.Atom("foo"), false},
+		{String1, syntax.Integer(1), false},
+		{String1, syntax.NewVariable("X"), false},
+		{Number1, syntax.NewVariable("X"), false},
+
+		{Ground1, syntax.Atom("foo"), true},
+		{Ground1, syntax.NewCompound("f", syntax.Integer(1), syntax.NewVariable("X")), false},
+		{Ground1, syntax.NewCompound("f", syntax.Integer(1), syntax.Integer(2)), true},
+		{Ground1, ints(1, 2, 3), true},
+		{Ground1, bound("X", syntax.NewCompound("f", bound("Y", syntax.Atom("a")))), true},
+		{Ground1, syntax.NewVariable("X"), false},
+		{Ground1, syntax.AnonVariable, false},
+
+		{Compound1, syntax.NewCompound("f", syntax.Atom("a")), true},
+		{Compound1, bound("X", ints(1)), true},
+		{Compound1, syntax.NewCompound("f"), false},
+		{Compound1, syntax.Atom("foo"), false},
+		{Compound1, syntax.Integer(1), false},
+		{Compound1, syntax.NewVariable("X"), false},
+
+		{Atomic1, syntax.Atom("foo"), true},
+		{Atomic1, syntax.Integer(1), true},
+		{Atomic1, syntax.Float64(1.5), true},
+		{Atomic1, syntax.String("foo"), true},
+		{Atomic1, bound("X", syntax.Integer(1)), true},
+		{Atomic1, syntax.NewCompound("f", syntax.Atom("a")), false},
+		{Atomic1, syntax.NewVariable("X"), false},
+
+		{Callable1, syntax.Atom("foo"), true},
+		{Callable1, syntax.NewCompound("f", syntax.Atom("a")), true},
+		{Callable1, bound("X", syntax.Atom("foo")), true},
+		{Callable1, syntax.Integer(1), false},
+		{Callable1, syntax.String("foo"), false},
+		{Callable1, syntax.NewVariable("X"), false},
+
+		{IsList1, syntax.EmptyList, true},
+		{IsList1, ints(1, 2, 3), true},
+		{IsList1, bound("X", ints(1)), true},
+		{IsList1, syntax.NewCompound(".", syntax.Integer(1), syntax.NewVariable("T")), false},
+		{IsList1, syntax.NewCompound(".", syntax.Integer(1), syntax.Atom("a")), false},
+		{IsList1, syntax.Atom("foo"), false},
+		{IsList1, syntax.String("foo"), false},
+		{IsList1, syntax.NewVariable("X"), false},
+	}
+	for _, test := range tests {
+		_, matches, err := test.clause.Call(syntax.NewProg(), []syntax.Term{test.arg})
+		if err != nil {
+			t.Errorf("%s(%s): %v", test.clause, test.arg, err)
+		} else if matches != test.matches {
+			t.Errorf("%s(%s): expected %t got %t", test.clause, test.arg, test.matches, matches)
+		}
+	}
+}
+
+func TestIsListCyclic(t *testing.T) {
+	l := syntax.NewVariable("L")
+	l.Unify(syntax.NewCompound(".", syntax.Atom("a"), syntax.NewCompound(".", syntax.Atom("b"), l)))
+	if _, matches, err := IsList1.Call(syntax.NewProg(), args(l)); matches || err != nil {
+		t.Errorf("expected L = [a, b|L] not to be a list, got %t %v", matches, err)
+	}
+}
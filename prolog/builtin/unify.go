@@ -0,0 +1,83 @@
+package builtin
+
+import "github.com/ericchiang/pl/prolog/syntax"
+
+// Comparison and unification of terms, see http://www.swi-prolog.org/pldoc/man?section=compare
+
+// Unify2 implements '=', unifying its arguments.
+var Unify2 syntax.Clause = &builtin{
+	name:  "=",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, args[0].Unify(args[1]), nil
+	},
+}
+
+// UnifyWithOccursCheck2 implements unify_with_occurs_check(A, B), which is
+// like '=' but fails rather than create a cyclic term. For example
+// 'X = f(X)' succeeds, binding X to an infinite term, while
+// 'unify_with_occurs_check(X, f(X))' fails.
+var UnifyWithOccursCheck2 syntax.Clause = &builtin{
+	name:  "unify_with_occurs_check",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, syntax.UnifyOC(args[0], args[1]), nil
+	},
+}
+
+// NotUnify2 implements '\=', which succeeds if its arguments don't unify. The
+// arguments are never bound.
+var NotUnify2 syntax.Clause = &builtin{
+	name:  "\\=",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, !unifies(args[0], args[1]), nil
+	},
+}
+
+// Equal2 implements '==', which succeeds if its arguments are identical.
+// Unlike '=' no variables are bound, so two variables are only identical if
+// they're the same variable. Numbers of different types, such as 1 and 1.0,
+// are not identical.
+var Equal2 syntax.Clause = &builtin{
+	name:  "==",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, syntax.Compare(args[0], args[1]) == 0, nil
+	},
+}
+
+// NotEqual2 implements '\==', the negation of '=='.
+var NotEqual2 syntax.Clause = &builtin{
+	name:  "\\==",
+	nArgs: 2,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		return nil, syntax.Compare(args[0], args[1]) != 0, nil
+	},
+}
+
+// Compare3 implements compare(Order, Term1, Term2), unifying Order with '<',
+// '=' or '>' depending on the standard order of Term1 and Term2.
+var Compare3 syntax.Clause = &builtin{
+	name:  "compare",
+	nArgs: 3,
+	call: func(p *syntax.Prog, args []syntax.Term) (*syntax.Goal, bool, error) {
+		switch o := deref(args[0]).(type) {
+		case *syntax.Variable:
+		case syntax.Atom:
+			if o != "<" && o != "=" && o != ">" {
+				return nil, false, domainErr("order", o)
+			}
+		default:
+			return nil, false, typeErr("atom", o)
+		}
+		order := syntax.Atom("=")
+		switch syntax.Compare(args[1], args[2]) {
+		case -1:
+			order = "<"
+		case 1:
+			order = ">"
+		}
+		return nil, args[0].Unify(order), nil
+	},
+}
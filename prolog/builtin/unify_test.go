@@ -0,0 +1,176 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestUnify(t *testing.T) {
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	foo, bar := syntax.Atom("foo"), syntax.Atom("bar")
+	f := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("f", args...) }
+
+	tests := []struct {
+		clause  syntax.Clause
+		a, b    syntax.Term
+		matches bool
+	}{
+		{Unify2, foo, foo, true},
+		{Unify2, foo, bar, false},
+		{Unify2, f(foo), f(foo), true},
+		{Unify2, f(foo), f(bar), false},
+		{NotUnify2, foo, bar, true},
+		{NotUnify2, foo, foo, false},
+		{NotUnify2, x, foo, false},
+		{NotUnify2, f(x, foo), f(bar, x), true},
+		{NotUnify2, f(x, y), f(y, foo), false},
+	}
+	for _, test := range tests {
+		_, matches, err := test.clause.Call(syntax.NewProg(), []syntax.Term{test.a, test.b})
+		if err != nil {
+			t.Errorf("%s(%s, %s): %v", test.clause, test.a, test.b, err)
+		} else if matches != test.matches {
+			t.Errorf("%s(%s, %s): expected %t got %t", test.clause, test.a, test.b, test.matches, matches)
+		}
+	}
+	if x.Value() != nil || y.Value() != nil {
+		t.Errorf("\\= bound X = %s, Y = %s", x.Value(), y.Value())
+	}
+
+	// bindings made by = are undone on backtracking
+	p := DefaultProg()
+	x, y = syntax.NewVariable("X"), syntax.NewVariable("Y")
+	all, err := p.Query(syntax.NewGoal(
+		syntax.NewCompound("=", x, f(y)),
+		syntax.NewCompound("member", x, list(f(foo), f(bar))),
+	)).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 solutions, got %v", all)
+	}
+	for i, exp := range []syntax.Term{f(foo), f(bar)} {
+		if syntax.Compare(all[i][x], exp) != 0 {
+			t.Errorf("solution %d: expected X = %s got %s", i, exp, all[i][x])
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	a := syntax.Atom("a")
+	f := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("f", args...) }
+
+	tests := []struct {
+		a, b  syntax.Term
+		equal bool
+	}{
+		{x, x, true},
+		{x, y, false},
+		{x, a, false},
+		{a, a, true},
+		{f(a), f(a), true},
+		{f(a), f(syntax.Atom("b")), false},
+		{f(x, a), f(x, a), true},
+		{f(x), f(y), false},
+		{syntax.Integer(1), syntax.Integer(1), true},
+		{syntax.Integer(1), syntax.Float64(1), false},
+		{syntax.Float64(1.5), syntax.Float64(1.5), true},
+		{bound("Z", a), a, true},
+	}
+	for _, test := range tests {
+		args := []syntax.Term{test.a, test.b}
+		if _, eq, _ := Equal2.Call(syntax.NewProg(), args); eq != test.equal {
+			t.Errorf("==(%s, %s): expected %t got %t", test.a, test.b, test.equal, eq)
+		}
+		if _, neq, _ := NotEqual2.Call(syntax.NewProg(), args); neq == test.equal {
+			t.Errorf("\\==(%s, %s): expected %t got %t", test.a, test.b, !test.equal, neq)
+		}
+	}
+	if x.Value() != nil || y.Value() != nil {
+		t.Errorf("== bound X = %s, Y = %s", x.Value(), y.Value())
+	}
+}
+
+func TestEqualUnified(t *testing.T) {
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	if n := countSolutions(t, syntax.NewGoal(syntax.NewCompound("=", x, y), syntax.NewCompound("==", x, y))); n != 1 {
+		t.Errorf("X = Y, X == Y: expected 1 solution, got %d", n)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	x := syntax.NewVariable("X")
+	f := func(a syntax.Term) syntax.Term { return syntax.NewCompound("f", a) }
+	p := DefaultProg()
+	for _, test := range []struct {
+		a, b syntax.Term
+		exp  syntax.Atom
+	}{
+		{syntax.Atom("foo"), syntax.Atom("bar"), ">"},
+		{syntax.Integer(1), syntax.Float64(1.0), "<"},
+		{syntax.Integer(2), syntax.Float64(1.5), ">"},
+		{f(syntax.Atom("a")), syntax.NewCompound("g", syntax.Atom("a")), "<"},
+		{f(syntax.Atom("a")), f(syntax.Atom("a")), "="},
+		{x, x, "="},
+	} {
+		order := syntax.NewVariable("Order")
+		testSolutions(t, p, order, goal(syntax.NewCompound("compare", order, test.a, test.b)), test.exp)
+	}
+
+	testCalls(t, Compare3, []callTest{
+		{args: args(syntax.Atom("="), x, x), matches: true},
+		{args: args(syntax.Atom("<"), f(syntax.Atom("a")), syntax.NewCompound("g", syntax.Atom("a"))), matches: true},
+		{args: args(syntax.Atom(">"), syntax.Integer(1), syntax.Integer(2)), matches: false},
+		{args: args(syntax.Atom("less"), syntax.Integer(1), syntax.Integer(2)), err: true},
+		{args: args(syntax.Integer(1), syntax.Integer(1), syntax.Integer(2)), err: true},
+	})
+}
+
+func TestUnifyWithOccursCheck(t *testing.T) {
+	p := DefaultProg()
+	x, y := syntax.NewVariable("X"), syntax.NewVariable("Y")
+	a := syntax.Atom("a")
+	f := func(args ...syntax.Term) syntax.Term { return syntax.NewCompound("f", args...) }
+	uoc := func(a, b syntax.Term) syntax.Term { return syntax.NewCompound("unify_with_occurs_check", a, b) }
+
+	tests := []struct {
+		goal syntax.Term
+		exp  int
+	}{
+		{uoc(x, f(x)), 0},
+		{uoc(f(x, y), f(y, f(x))), 0},
+		{uoc(f(x, y), f(y, a)), 1},
+		{uoc(x, x), 1},
+		{uoc(x, y), 1},
+		{uoc(f(x), f(syntax.NewVariable("_"))), 1},
+		{syntax.NewCompound("=", x, f(x)), 1},
+	}
+	for _, test := range tests {
+		if n := len(solutions(t, p, x, test.goal)); n != test.exp {
+			t.Errorf("%s: expected %d solutions got %d", test.goal, test.exp, n)
+		}
+	}
+
+	// cyclic terms created without the occurs check can be written
+	x, l := syntax.NewVariable("X"), syntax.NewVariable("L")
+	got := captureOutput(func(p *syntax.Prog) {
+		countProgSolutions(t, p, syntax.NewGoal(
+			syntax.NewCompound("=", x, f(x)),
+			syntax.NewCompound("write", x),
+			syntax.Atom("nl"),
+			syntax.NewCompound("=", l, syntax.NewCompound(".", a, syntax.NewCompound(".", syntax.Atom("b"), l))),
+			syntax.NewCompound("write", l),
+		))
+	})
+	if exp := "f(X)\n[a,b|L]"; got != exp {
+		t.Errorf("expected %q got %q", exp, got)
+	}
+	// and are kept in the bindings of a query
+	x = syntax.NewVariable("X")
+	if got := solutions(t, p, x, syntax.NewCompound("=", x, f(x))); len(got) != 1 || got[0].(*syntax.Compound).Functor() != "f" {
+		t.Errorf("expected X = f(X) got %s", got)
+	}
+}
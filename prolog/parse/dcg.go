@@ -0,0 +1,166 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// Definite clause grammars, see http://www.swi-prolog.org/pldoc/man?section=DCG
+
+// ExpandDCG translates the grammar rule 'Head --> Body' into an ordinary
+// rule. Each non-terminal is given two extra arguments, the list to parse and
+// the list which remains after parsing it. For example:
+//
+//	greeting --> [hello], name.
+//
+// is translated to:
+//
+//	greeting(S0, S) :- S0 = [hello|S1], name(S1, S).
+//
+// The body may contain lists of terminals, strings, which are translated to
+// the list of their character codes, non-terminals, the control
+// constructs ',', ';', '->', '\+' and '!', and goals in curly braces, which
+// are called without translation. Pushback, 'Head, PB --> Body', isn't
+// supported.
+func ExpandDCG(head, body syntax.Term) (*syntax.Rule, error) {
+	if functor, args, ok := decompose(head); ok && functor == "," && len(args) == 2 {
+		return nil, fmt.Errorf("grammar rule pushback is not supported")
+	}
+	s0, s := syntax.NewVariable("S0"), syntax.NewVariable("S")
+	h, err := nonTerminal(head, s0, s)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ExpandDCGBody(body, s0, s)
+	if err != nil {
+		return nil, err
+	}
+	return syntax.NewRule(h.Functor(), h.Args(), b), nil
+}
+
+// ExpandDCGBody translates the body of a grammar rule into the goal which
+// parses the list s0, leaving s. Unlike the rules returned by ExpandDCG, the
+// goal isn't copied, so it shares its variables with body.
+func ExpandDCGBody(body, s0, s syntax.Term) (*syntax.Goal, error) {
+	var d dcg
+	b, err := d.body(body, s0, s)
+	if err != nil {
+		return nil, err
+	}
+	return syntax.GoalFromSlice(conjuncts(b, nil)), nil
+}
+
+// conjuncts appends the terms of a conjunction to terms. Unlike the
+// conjunctions read by the parser, those built by the translation may be
+// nested on the left, such as '((!, S0 = S1), a(S1, S))'.
+func conjuncts(t syntax.Term, terms []syntax.Term) []syntax.Term {
+	if functor, args, ok := decompose(t); ok && functor == "," && len(args) == 2 {
+		return conjuncts(args[1], conjuncts(args[0], terms))
+	}
+	return append(terms, goalTerm(t))
+}
+
+// nonTerminal adds the list arguments s0 and s to a callable term.
+func nonTerminal(t syntax.Term, s0, s syntax.Term) (*syntax.Compound, error) {
+	switch t := t.(type) {
+	case syntax.Atom:
+		return syntax.NewCompound(t, s0, s), nil
+	case *syntax.Compound:
+		return syntax.NewCompound(t.Functor(), append(t.Args(), s0, s)...), nil
+	}
+	return nil, fmt.Errorf("grammar rule non-terminal %s is not callable", t)
+}
+
+// dcg holds the state of the translation of a grammar rule's body.
+type dcg struct {
+	n int // the number of intermediate lists created
+}
+
+// list returns a variable for an intermediate list, named S1, S2 and so on.
+func (d *dcg) list() *syntax.Variable {
+	d.n++
+	return syntax.NewVariable(fmt.Sprintf("S%d", d.n))
+}
+
+// body translates the body of a grammar rule which parses the list s0,
+// leaving s.
+func (d *dcg) body(t syntax.Term, s0, s syntax.Term) (syntax.Term, error) {
+	if _, ok := t.(*syntax.Variable); ok {
+		return compound("phrase", t, s0, s), nil
+	}
+	if t == syntax.EmptyList {
+		return compound("=", s0, s), nil
+	}
+	if t == syntax.Atom("!") {
+		return compound(",", t, compound("=", s0, s)), nil
+	}
+	if str, ok := t.(syntax.String); ok {
+		// a string is a list of terminals holding its character codes
+		var codes []syntax.Term
+		for _, r := range string(str) {
+			codes = append(codes, syntax.Integer(r))
+		}
+		return terminals(syntax.NewList(codes), s0, s)
+	}
+	functor, args, ok := decompose(t)
+	if !ok {
+		return nonTerminal(t, s0, s)
+	}
+	switch {
+	case functor == "." && len(args) == 2:
+		return terminals(t, s0, s)
+	case functor == "," && len(args) == 2:
+		mid := d.list()
+		return d.pair(",", args, s0, mid, mid, s)
+	case (functor == ";" || functor == "|") && len(args) == 2:
+		return d.pair(";", args, s0, s, s0, s)
+	case functor == "->" && len(args) == 2:
+		mid := d.list()
+		return d.pair("->", args, s0, mid, mid, s)
+	case functor == `\+` && len(args) == 1:
+		a, err := d.body(args[0], s0, syntax.NewVariable("_"))
+		if err != nil {
+			return nil, err
+		}
+		return compound(",", compound(`\+`, a), compound("=", s0, s)), nil
+	case functor == "{}" && len(args) == 1:
+		return compound(",", args[0], compound("=", s0, s)), nil
+	case functor == "call" && len(args) > 0:
+		return compound("call", append(args, s0, s)...), nil
+	}
+	return nonTerminal(t, s0, s)
+}
+
+// pair translates both arguments of a control construct, the first parsing
+// a0 leaving a, the second b0 leaving b.
+func (d *dcg) pair(functor string, args []syntax.Term, a0, a, b0, b syntax.Term) (syntax.Term, error) {
+	left, err := d.body(args[0], a0, a)
+	if err != nil {
+		return nil, err
+	}
+	right, err := d.body(args[1], b0, b)
+	if err != nil {
+		return nil, err
+	}
+	return compound(functor, left, right), nil
+}
+
+// terminals translates a list of terminals, such as '[a, b]', to the goal
+// 'S0 = [a, b|S]'.
+func terminals(t syntax.Term, s0, s syntax.Term) (syntax.Term, error) {
+	var elems []syntax.Term
+	for t != syntax.EmptyList {
+		functor, args, ok := decompose(t)
+		if !ok || functor != "." || len(args) != 2 {
+			return nil, fmt.Errorf("grammar rule terminals %s are not a list", t)
+		}
+		elems = append(elems, args[0])
+		t = args[1]
+	}
+	l := s
+	for i := len(elems) - 1; i >= 0; i-- {
+		l = compound(".", elems[i], l)
+	}
+	return compound("=", s0, l), nil
+}
@@ -0,0 +1,92 @@
+package parse
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func TestExpandDCG(t *testing.T) {
+	tests := []struct {
+		dcg, exp string
+	}{
+		{"greeting --> [hello], name.", "greeting(S0, S) :- S0 = [hello|S1], name(S1, S)."},
+		{"a --> [].", "a(S0, S) :- S0 = S."},
+		{"a(X) --> [X, y].", "a(X, S0, S) :- S0 = [X, y|S]."},
+		{"a --> b, c, d.", "a(S0, S) :- b(S0, S1), c(S1, S2), d(S2, S)."},
+		{"a --> !, {write(x), nl}, b.", "a(S0, S) :- !, S0 = S1, write(x), nl, S1 = S2, b(S2, S)."},
+		{"a --> b ; c.", "a(S0, S) :- b(S0, S) ; c(S0, S)."},
+		{"a --> b -> c ; d.", "a(S0, S) :- (b(S0, S1) -> c(S1, S)) ; d(S0, S)."},
+		{"a --> \\+ b.", "a(S0, S) :- \\+ b(S0, _), S0 = S."},
+		{"a(X) --> X.", "a(X, S0, S) :- phrase(X, S0, S)."},
+		{"a --> call(foo, x).", "a(S0, S) :- call(foo, x, S0, S)."},
+		{`greeting --> "hi", name.`, "greeting(S0, S) :- S0 = [104, 105|S1], name(S1, S)."},
+		{`a --> "".`, "a(S0, S) :- S0 = S."},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.dcg)
+		if err != nil {
+			t.Errorf("%s: %v", test.dcg, err)
+			continue
+		}
+		exp, err := Parse(test.exp)
+		if err != nil {
+			t.Fatalf("%s: %v", test.exp, err)
+		}
+		if g, e := fmt.Sprint(got[0]), fmt.Sprint(exp[0]); g != e {
+			t.Errorf("%s: expected %s got %s", test.dcg, e, g)
+		}
+	}
+
+	for _, src := range []string{
+		"X --> a.",
+		"1 --> a.",
+		"a, [b] --> c.",
+		"a --> 1.",
+		"a --> [b|c].",
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+func TestDCG(t *testing.T) {
+	p := syntax.NewProg()
+	err := LoadString(p, `
+		X = X.
+		greeting --> [hello], name.
+		name --> [world].
+		name --> [prolog].
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := func(s ...string) syntax.Term {
+		var l syntax.Term = syntax.EmptyList
+		for i := len(s) - 1; i >= 0; i-- {
+			l = syntax.NewCompound(".", syntax.Atom(s[i]), l)
+		}
+		return l
+	}
+	tests := []struct {
+		words   syntax.Term
+		matches bool
+	}{
+		{words("hello", "world"), true},
+		{words("hello", "prolog"), true},
+		{words("hello", "bob"), false},
+		{words("hello"), false},
+		{words("hello", "world", "again"), false},
+	}
+	for _, test := range tests {
+		goal := syntax.NewGoal(syntax.NewCompound("greeting", test.words, syntax.EmptyList))
+		_, ok, err := p.Query(goal).First()
+		if err != nil {
+			t.Errorf("%s: %v", goal, err)
+		} else if ok != test.matches {
+			t.Errorf("%s: expected %t got %t", goal, test.matches, ok)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package parse
 
 import (
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -16,21 +18,25 @@ const (
 	itemDot                 // '.'
 	itemNumber              // '6', '2.1'
 	itemLeftBrace           // '['
+	itemLeftCurly           // '{'
 	itemLeftParen           // '('
 	itemPipe                // '|'
 	itemQuoted              // a quoted atom
 	itemRightBrace          // ']'
+	itemRightCurly          // '}'
 	itemRightParen          // ')'
-	itemString
+	itemString              // a double-quoted string
 	itemVariable
 	itemEOF
 	itemError
 )
 
 type item struct {
-	typ itemType
-	pos int
-	val string
+	typ  itemType
+	pos  int
+	line int // line number of pos, starting at 1
+	col  int // column of pos in bytes, starting at 1
+	val  string
 }
 
 const eof rune = -1
@@ -39,32 +45,123 @@ type stateFn func(*lexer) stateFn
 
 // lexer holds the state of the scanner.
 type lexer struct {
-	name       string    // the name of the input; used only for error reports
-	input      string    // the string being scanned
-	state      stateFn   // the next lexing function to enter
-	pos        int       // current position in the input
-	start      int       // start position of this item
-	width      int       // width of last rune read from input
-	lastPos    int       // position of most recent item returned by nextItem
-	items      chan item // channel of scanned items
-	parenDepth int       // nesting depth of ( ) exprs
-	braceDepth int       // nesting depth of [ ] exprs
+	name        string    // the name of the input; used only for error reports
+	r           io.Reader // the input being scanned
+	buf         []byte    // the window of the input which has been read
+	offset      int       // position in the input of buf[0]
+	readErr     error     // sticky error returned by r
+	state       stateFn   // the next lexing function to enter
+	pos         int       // current position in the input
+	start       int       // start position of this item
+	width       int       // width of last rune read from input
+	lastPos     int       // position of most recent item returned by nextItem
+	lastLine    int       // line of most recent item returned by nextItem
+	lastCol     int       // column of most recent item returned by nextItem
+	items       chan item // channel of scanned items
+	parenDepth  int       // nesting depth of ( ) exprs
+	braceDepth  int       // nesting depth of [ ] exprs
+	inClause    bool      // items have been emitted since the last '.'
+	dotOptional bool      // the input may end without a '.'
+	prevType    itemType  // type of the most recently emitted item
+	prevEnd     int       // end position of the most recently emitted item
+	line        int       // number of lines before scanned, plus one
+	lineStart   int       // position of the start of the current line
+	scanned     int       // position newlines have been counted up to
+}
+
+// readSize is the number of bytes the lexer attempts to read from its input
+// at a time.
+const readSize = 4096
+
+// lex creates a new scanner for the input string.
+func lex(name, input string) *lexer {
+	return lexReader(name, strings.NewReader(input))
+}
+
+// lexReader creates a new scanner which lazily reads its input from r. Only
+// the input following the start of the pending item is held in memory.
+func lexReader(name string, r io.Reader) *lexer {
+	l := newLexer(name, r)
+	go l.run()
+	return l
+}
+
+// lexTerm creates a new scanner for the text of a single term, which doesn't
+// have to be terminated by a '.'.
+func lexTerm(input string) *lexer {
+	l := newLexer("", strings.NewReader(input))
+	l.dotOptional = true
+	go l.run()
+	return l
+}
+
+func newLexer(name string, r io.Reader) *lexer {
+	return &lexer{
+		name:  name,
+		r:     r,
+		items: make(chan item),
+		line:  1,
+	}
+}
+
+// run runs the state machine for the lexer.
+func (l *lexer) run() {
+	for l.state = lexSpace; l.state != nil; {
+		l.state = l.state(l)
+	}
+	close(l.items)
 }
 
 // nextItem returns the next item from the input.
 func (l *lexer) nextItem() item {
 	item := <-l.items
-	l.lastPos = item.pos
+	l.lastPos, l.lastLine, l.lastCol = item.pos, item.line, item.col
 	return item
 }
 
+// drain drains the output so the lexing goroutine will exit.
+// Called by the parser, not in the lexing goroutine.
+func (l *lexer) drain() {
+	for range l.items {
+	}
+}
+
+// fill reads from the input until the buffer holds a full rune following pos,
+// or the input is exhausted. Input preceding the pending item is discarded.
+func (l *lexer) fill() {
+	for l.readErr == nil && !utf8.FullRune(l.buf[l.pos-l.offset:]) {
+		if l.start > l.offset {
+			// count the newlines of the discarded input before it's lost
+			l.position(l.start)
+			n := copy(l.buf, l.buf[l.start-l.offset:])
+			l.buf = l.buf[:n]
+			l.offset = l.start
+		}
+		if cap(l.buf)-len(l.buf) < readSize {
+			buf := make([]byte, len(l.buf), 2*cap(l.buf)+readSize)
+			copy(buf, l.buf)
+			l.buf = buf
+		}
+		n, err := l.r.Read(l.buf[len(l.buf):cap(l.buf)])
+		l.buf = l.buf[:len(l.buf)+n]
+		l.readErr = err
+	}
+}
+
+// slice returns the input between two positions, which must not precede the
+// start of the pending item.
+func (l *lexer) slice(start, end int) string {
+	return string(l.buf[start-l.offset : end-l.offset])
+}
+
 // next returns the next rune in the input.
 func (l *lexer) next() rune {
-	if int(l.pos) >= len(l.input) {
+	l.fill()
+	if l.pos-l.offset >= len(l.buf) {
 		l.width = 0
 		return eof
 	}
-	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
+	r, w := utf8.DecodeRune(l.buf[l.pos-l.offset:])
 	l.width = w
 	l.pos += l.width
 	return r
@@ -72,8 +169,20 @@ func (l *lexer) next() rune {
 
 // peek returns but does not consume the next rune in the input.
 func (l *lexer) peek() rune {
+	width := l.width
 	r := l.next()
 	l.backup()
+	l.width = width
+	return r
+}
+
+// peek2 returns but does not consume the rune after the next rune in the
+// input.
+func (l *lexer) peek2() rune {
+	pos, width := l.pos, l.width
+	l.next()
+	r := l.next()
+	l.pos, l.width = pos, width
 	return r
 }
 
@@ -84,8 +193,35 @@ func (l *lexer) backup() {
 
 // emit passes an item back to the client.
 func (l *lexer) emit(t itemType) {
-	l.items <- item{t, l.start, l.input[l.start:l.pos]}
+	l.emitValue(t, l.slice(l.start, l.pos))
+}
+
+// emitValue passes an item back to the client with a value other than the
+// input that was consumed.
+func (l *lexer) emitValue(t itemType, val string) {
+	line, col := l.position(l.start)
+	l.items <- item{t, l.start, line, col, val}
 	l.start = l.pos
+	l.inClause = t != itemDot
+	l.prevType, l.prevEnd = t, l.pos
+}
+
+// endsTerm reports whether the most recently emitted item could be the end
+// of a term. If so, a following '-' or '+' is an infix operator rather than
+// the sign of a number. Atoms only end a term when nothing separates them
+// from the pending input, as in "a-1", so that "X is -1" is still lexed with
+// a negative number.
+func (l *lexer) endsTerm() bool {
+	if !l.inClause {
+		return false
+	}
+	switch l.prevType {
+	case itemNumber, itemVariable, itemRightParen, itemRightBrace, itemRightCurly, itemQuoted, itemString:
+		return true
+	case itemAtom:
+		return l.prevEnd == l.start
+	}
+	return false
 }
 
 // ignore skips over the pending input before this point.
@@ -113,13 +249,36 @@ func (l *lexer) acceptRun(valid string) {
 // the previous item returned by nextItem. Doing it this way
 // means we don't have to worry about peek double counting.
 func (l *lexer) lineNumber() int {
-	return 1 + strings.Count(l.input[:l.lastPos], "\n")
+	return l.lastLine
+}
+
+// colNumber reports which column we're on, based on the position of the
+// previous item returned by nextItem. Columns are counted in bytes,
+// starting at 1.
+func (l *lexer) colNumber() int {
+	return l.lastCol
+}
+
+// position returns the line and column of pos. To avoid rescanning the
+// input, pos must not precede any position previously passed to position,
+// or the start of the pending item.
+func (l *lexer) position(pos int) (line, col int) {
+	scanned := l.slice(l.scanned, pos)
+	if n := strings.Count(scanned, "\n"); n > 0 {
+		l.line += n
+		l.lineStart = l.scanned + strings.LastIndex(scanned, "\n") + 1
+	}
+	l.scanned = pos
+	return l.line, pos - l.lineStart + 1
 }
 
 // errorf returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextItem.
+// The error is prefixed with the line and column of the pending item.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{itemError, l.start, fmt.Sprintf(format, args...)}
+	line, col := l.position(l.start)
+	msg := fmt.Sprintf("line %d col %d: %s", line, col, fmt.Sprintf(format, args...))
+	l.items <- item{itemError, l.start, line, col, msg}
 	return nil
 }
 
@@ -138,25 +297,134 @@ func isAlphaNumeric(r rune) bool {
 	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
+// unescape returns the character represented by an escape sequence, such as
+// 'n' for "\n".
+func unescape(r rune) (rune, bool) {
+	switch r {
+	case 'n':
+		return '\n', true
+	case 't':
+		return '\t', true
+	case 'r':
+		return '\r', true
+	case 'a':
+		return '\a', true
+	case 'b':
+		return '\b', true
+	case 'f':
+		return '\f', true
+	case 'v':
+		return '\v', true
+	case '0':
+		return 0, true
+	case '\\', '\'', '"', '`':
+		return r, true
+	}
+	return 0, false
+}
+
+// isSpecial reports whether r is a symbol character, which can be combined
+// to form atoms such as ':-' or '=..'.
 func isSpecial(r rune) bool {
-	return strings.IndexRune(`\+-*=<>:&`, r) > -1
+	return strings.IndexRune(`\+-*/=<>:&.^~?@#$`, r) > -1
+}
+
+// isEnd reports whether r, following a '.', ends a clause.
+func isEnd(r rune) bool {
+	return r == eof || r == '%' || isSpace(r) || isEndOfLine(r)
+}
+
+// lexSpace skips whitespace and comments. It emits itemEOF once the input
+// is exhausted, or an error if the last clause wasn't terminated.
+func lexSpace(l *lexer) stateFn {
+	for {
+		r := l.next()
+		switch {
+		case r == eof:
+			if l.readErr != io.EOF {
+				return l.errorf("reading input: %v", l.readErr)
+			}
+			if l.inClause && !l.dotOptional {
+				return l.errorf("statement unterminated by '.'")
+			}
+			l.emit(itemEOF)
+			return nil
+		case isSpace(r) || isEndOfLine(r):
+			l.ignore()
+		case r == '%':
+			return lexLineComment
+		case r == '/' && l.peek() == '*':
+			l.next()
+			return lexBlockComment
+		default:
+			l.backup()
+			return lexNext
+		}
+	}
+}
+
+// lexLineComment skips a '%' comment through the end of the line.
+// It assumes the '%' has already been seen.
+func lexLineComment(l *lexer) stateFn {
+	for {
+		r := l.next()
+		if r == eof || isEndOfLine(r) {
+			l.ignore()
+			return lexSpace
+		}
+	}
+}
+
+// lexBlockComment skips a '/* */' comment. Block comments may be nested.
+// It assumes the opening '/*' has already been seen.
+func lexBlockComment(l *lexer) stateFn {
+	depth := 1
+	for depth > 0 {
+		switch l.next() {
+		case eof:
+			return l.errorf("unterminated block comment")
+		case '/':
+			if l.peek() == '*' {
+				l.next()
+				depth++
+			}
+		case '*':
+			if l.peek() == '/' {
+				l.next()
+				depth--
+			}
+		}
+	}
+	l.ignore()
+	return lexSpace
 }
 
 // lexNext lexes the item immediately following an identifier
 func lexNext(l *lexer) stateFn {
 	r := l.next()
 	switch {
-	case r == eof:
-		return l.errorf("statement unterminated by '.'")
+	case r == eof || isSpace(r) || isEndOfLine(r):
+		l.backup()
+		return lexSpace
+	case r == '%':
+		return lexLineComment
+	case r == '/' && l.peek() == '*':
+		l.next()
+		return lexBlockComment
 	case r == '.':
-		if l.peek() == '(' {
+		switch {
+		case l.peek() == '(':
 			l.emit(itemAtom)
-		} else {
+		case !isEnd(l.peek()):
+			return lexAtomSpecial
+		default:
 			l.emit(itemDot)
 			return lexSpace
 		}
 	case r == '|':
 		l.emit(itemPipe)
+	case r == ';':
+		l.emit(itemAtom)
 	case r == '!':
 		l.emit(itemCut)
 	case r == ',':
@@ -174,25 +442,30 @@ func lexNext(l *lexer) stateFn {
 		l.emit(itemLeftBrace)
 		l.braceDepth++
 	case r == ']':
-		l.emit(itemRightParen)
-		l.parenDepth--
-		if l.parenDepth < 0 {
-			return l.errorf("unexpected right paren %#U", r)
+		l.emit(itemRightBrace)
+		l.braceDepth--
+		if l.braceDepth < 0 {
+			return l.errorf("unexpected right brace %#U", r)
 		}
+	case r == '{':
+		l.emit(itemLeftCurly)
+	case r == '}':
+		l.emit(itemRightCurly)
 	case unicode.IsDigit(r):
 		return lexNumber
 	case unicode.IsUpper(r) || r == '_':
 		return lexVariable
 	case unicode.IsLower(r):
 		return lexAtom
+	case (r == '-' || r == '+') && unicode.IsDigit(l.peek()) && !l.endsTerm():
+		return lexSignedNumber
+	case isSpecial(r):
+		return lexAtomSpecial
 	case r == '\'' || r == '"':
 		l.backup()
 		return lexQuoted
-	case unicode.IsDigit(r):
-		l.backup()
-		return lexNumber
 	default:
-		l.errorf("unexpected character %#U", r)
+		return l.errorf("unexpected character %#U", r)
 	}
 	return lexNext
 }
@@ -201,8 +474,9 @@ func lexNext(l *lexer) stateFn {
 // It assumes the first character has already been seen
 func lexAtom(l *lexer) stateFn {
 	for {
-		r := l.peek()
+		r := l.next()
 		if !isAlphaNumeric(r) && r != '_' {
+			l.backup()
 			l.emit(itemAtom)
 			return lexNext
 		}
@@ -211,8 +485,9 @@ func lexAtom(l *lexer) stateFn {
 
 func lexVariable(l *lexer) stateFn {
 	for {
-		r := l.peek()
+		r := l.next()
 		if !isAlphaNumeric(r) && r != '_' {
+			l.backup()
 			l.emit(itemVariable)
 			return lexNext
 		}
@@ -220,58 +495,145 @@ func lexVariable(l *lexer) stateFn {
 }
 
 // lexAtomSpecial lexes and atom which consists of special characters.
-// It assumes the first character has already been seen
+// It assumes the first character has already been seen. The atom stops short
+// of the start of a block comment.
 func lexAtomSpecial(l *lexer) stateFn {
 	for {
-		if !isSpecial(l.peek()) {
+		r := l.next()
+		switch {
+		case !isSpecial(r), r == '/' && l.peek() == '*':
+			l.backup()
 			l.emit(itemAtom)
 			return lexNext
 		}
 	}
-	return nil
 }
 
-// lexNumber lexes a number with an optional single dot.
+// lexSignedNumber lexes a number with a leading sign, such as "-3".
+// It assumes the sign has already been seen and is followed by a digit.
+func lexSignedNumber(l *lexer) stateFn {
+	l.next()
+	return lexNumber
+}
+
+// lexNumber lexes a number with an optional fraction and exponent, or an
+// integer with a radix prefix such as "0xff".
 // It assumes the first digit has already been seen.
 func lexNumber(l *lexer) stateFn {
-	seenDot := false
-
-loop:
-	for {
-		r := l.peek()
-		switch {
-		case r == '.':
-			if seenDot {
-				break loop
-			}
-			seenDot = true
-		case unicode.IsDigit(r):
-		default:
-			break loop
+	const digits = "0123456789"
+	switch l.slice(l.start, l.pos) {
+	case "0", "-0", "+0":
+		if base := radix(l.peek()); base != "" {
+			l.next()
+			return lexRadixNumber(l, base)
+		}
+		if l.peek() == '\'' {
+			l.next()
+			return lexCharCode
 		}
+	}
+	l.acceptRun(digits)
+	if l.peek() == '.' && unicode.IsDigit(l.peek2()) {
 		l.next()
+		l.acceptRun(digits)
+		if l.accept("eE") {
+			l.accept("+-")
+			if !unicode.IsDigit(l.peek()) {
+				return l.errorf("malformed exponent in number %q", l.slice(l.start, l.pos))
+			}
+			l.acceptRun(digits)
+		}
 	}
 	l.emit(itemNumber)
-	return nil
+	return lexNext
+}
+
+// lexCharCode lexes a character code literal, such as "0'a", emitting the
+// integer value of the character. It assumes the "0'" has already been seen.
+func lexCharCode(l *lexer) stateFn {
+	r := l.next()
+	switch r {
+	case eof:
+		return l.errorf("unterminated character code literal")
+	case '\\':
+		esc, ok := unescape(l.next())
+		if !ok {
+			return l.errorf("invalid escape sequence in character code literal")
+		}
+		r = esc
+	case '\'':
+		// ISO requires the quote to be doubled, as in "0'''"
+		l.accept("'")
+	}
+	if next := l.peek(); isAlphaNumeric(next) || next == '_' || next == '\'' {
+		return l.errorf("unexpected %q following character code literal", next)
+	}
+	if l.slice(l.start, l.start+1) == "-" {
+		r = -r
+	}
+	l.emitValue(itemNumber, strconv.Itoa(int(r)))
+	return lexNext
+}
+
+// radix returns the name of the base indicated by the character following a
+// leading '0', or the empty string if the character isn't a radix prefix.
+func radix(r rune) string {
+	switch r {
+	case 'x', 'X':
+		return "hexadecimal"
+	case 'o', 'O':
+		return "octal"
+	case 'b', 'B':
+		return "binary"
+	}
+	return ""
+}
+
+// lexRadixNumber lexes the digits of an integer with a radix prefix.
+// It assumes the prefix, such as "0x", has already been seen.
+func lexRadixNumber(l *lexer, base string) stateFn {
+	valid := map[string]string{
+		"hexadecimal": "0123456789abcdefABCDEF",
+		"octal":       "01234567",
+		"binary":      "01",
+	}[base]
+	digitsStart := l.pos
+	l.acceptRun(valid)
+	if r := l.peek(); isAlphaNumeric(r) || r == '_' {
+		return l.errorf("invalid digit %q in %s literal", r, base)
+	}
+	if l.pos == digitsStart {
+		return l.errorf("%s literal %q has no digits", base, l.slice(l.start, l.pos))
+	}
+	l.emit(itemNumber)
+	return lexNext
 }
 
 func lexQuoted(l *lexer) stateFn {
 	quoteChar := l.next()
 	if quoteChar != '\'' && quoteChar != '"' {
-		l.errorf("unexpected quote char %#U", quoteChar)
+		return l.errorf("unexpected quote char %#U", quoteChar)
 	}
 	for {
 		r := l.next()
 		switch r {
 		case eof:
-			l.errorf("unterminated quote %#U", quoteChar)
+			return l.errorf("unterminated quote %#U", quoteChar)
 		case '\\':
 			// handling of the unquote error whill be done elsewhere
 			l.next()
 		case quoteChar:
-			l.emit(itemQuoted)
+			if l.peek() == quoteChar {
+				// a doubled quote char, such as 'don''t'
+				l.next()
+				continue
+			}
+			if quoteChar == '"' {
+				l.emit(itemString)
+			} else {
+				l.emit(itemQuoted)
+			}
 			return lexNext
 		}
 	}
-	return nil
 }
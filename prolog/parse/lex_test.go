@@ -1,14 +1,272 @@
 package parse
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// collect lexes the input and returns all of the emitted items.
+func collect(input string) []item {
+	l := lex("test", input)
+	var items []item
+	for i := range l.items {
+		items = append(items, i)
+	}
+	return items
+}
 
 func TestErrors(t *testing.T) {
 	// these are all strings which should return lex errors
 	tests := []string{
 		"foobar",
 		"foobar())",
+		"foobar(]).",
 		"'foobar",
 	}
 	for _, test := range tests {
+		items := collect(test)
+		if n := len(items); n == 0 || items[n-1].typ != itemError {
+			t.Errorf("%q: expected lex error, got %v", test, items)
+		}
+	}
+}
+
+func testItemTypes(t *testing.T, input string, exp []itemType) {
+	items := collect(input)
+	if len(items) != len(exp) {
+		t.Errorf("%q: expected %d items, got %d: %v", input, len(exp), len(items), items)
+		return
+	}
+	for i, item := range items {
+		if item.typ != exp[i] {
+			t.Errorf("%q: item %d, expected type %d got %d (%q)", input, i, exp[i], item.typ, item.val)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+	testItemTypes(t, "[a, b, c].", []itemType{
+		itemLeftBrace,
+		itemAtom, itemComma,
+		itemAtom, itemComma,
+		itemAtom,
+		itemRightBrace,
+		itemDot,
+		itemEOF,
+	})
+	testItemTypes(t, "[H|T].", []itemType{
+		itemLeftBrace,
+		itemVariable, itemPipe, itemVariable,
+		itemRightBrace,
+		itemDot,
+		itemEOF,
+	})
+	testItemTypes(t, "foo([a], [[b]]).", []itemType{
+		itemAtom, itemLeftParen,
+		itemLeftBrace, itemAtom, itemRightBrace, itemComma,
+		itemLeftBrace, itemLeftBrace, itemAtom, itemRightBrace, itemRightBrace,
+		itemRightParen,
+		itemDot,
+		itemEOF,
+	})
+}
+
+// testSameItems asserts that two inputs lex to the same sequence of item
+// types and values, ignoring positions.
+func testSameItems(t *testing.T, input, exp string) {
+	got, want := collect(input), collect(exp)
+	if len(got) != len(want) {
+		t.Errorf("%q: expected %d items, got %d: %v", input, len(want), len(got), got)
+		return
+	}
+	for i := range got {
+		if got[i].typ != want[i].typ || got[i].val != want[i].val {
+			t.Errorf("%q: item %d, expected %v got %v", input, i, want[i], got[i])
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	exp := "foo :- bar."
+	tests := []string{
+		"foo :- % comment\n bar.",
+		"foo :- /* comment */ bar.",
+		"foo :-/* comment */bar.",
+		"foo :- /* a /* nested */ comment */ bar.",
+		"% leading comment\nfoo :- bar.",
+		"foo :- bar. % trailing comment",
+		"foo :- bar. /* trailing comment */",
+		"/* multi\nline\ncomment */foo :- bar.",
+	}
+	for _, test := range tests {
+		testSameItems(t, test, exp)
+	}
+
+	errs := []string{
+		"foo :- /* unclosed bar.",
+		"foo :- /* nested /* unclosed */ bar.",
+		"foo :- % comment hides the end.",
+	}
+	for _, test := range errs {
+		items := collect(test)
+		if n := len(items); n == 0 || items[n-1].typ != itemError {
+			t.Errorf("%q: expected lex error, got %v", test, items)
+		}
+	}
+}
+
+func testItems(t *testing.T, input string, exp []item) {
+	items := collect(input)
+	if len(items) != len(exp) {
+		t.Errorf("%q: expected %d items, got %d: %v", input, len(exp), len(items), items)
+		return
+	}
+	for i, item := range items {
+		if item.typ != exp[i].typ || item.val != exp[i].val {
+			t.Errorf("%q: item %d, expected %v got %v", input, i, exp[i], item)
+		}
+	}
+}
+
+func TestSignedNumbers(t *testing.T) {
+	dot := item{typ: itemDot, val: "."}
+	eof := item{typ: itemEOF}
+	num := func(s string) item { return item{typ: itemNumber, val: s} }
+	atom := func(s string) item { return item{typ: itemAtom, val: s} }
+	variable := func(s string) item { return item{typ: itemVariable, val: s} }
+
+	testItems(t, "-0.", []item{num("-0"), dot, eof})
+	testItems(t, "-3.14.", []item{num("-3.14"), dot, eof})
+	testItems(t, "+3.", []item{num("+3"), dot, eof})
+	testItems(t, "--5.", []item{atom("--"), num("5"), dot, eof})
+	testItems(t, "X - 3.", []item{variable("X"), atom("-"), num("3"), dot, eof})
+	testItems(t, "X-3.", []item{variable("X"), atom("-"), num("3"), dot, eof})
+	testItems(t, "a-1.", []item{atom("a"), atom("-"), num("1"), dot, eof})
+	testItems(t, "f(1)-1.", []item{
+		atom("f"), {typ: itemLeftParen, val: "("}, num("1"), {typ: itemRightParen, val: ")"},
+		atom("-"), num("1"), dot, eof,
+	})
+	testItems(t, "X is -3.", []item{variable("X"), atom("is"), num("-3"), dot, eof})
+	testItems(t, "X = -3.", []item{variable("X"), atom("="), num("-3"), dot, eof})
+	testItems(t, "f(-1, -2).", []item{
+		atom("f"), {typ: itemLeftParen, val: "("}, num("-1"), {typ: itemComma, val: ","},
+		num("-2"), {typ: itemRightParen, val: ")"}, dot, eof,
+	})
+}
+
+func TestRadixNumbers(t *testing.T) {
+	dot := item{typ: itemDot, val: "."}
+	eof := item{typ: itemEOF}
+	num := func(s string) item { return item{typ: itemNumber, val: s} }
+
+	testItems(t, "0xff.", []item{num("0xff"), dot, eof})
+	testItems(t, "0XFF.", []item{num("0XFF"), dot, eof})
+	testItems(t, "0o77.", []item{num("0o77"), dot, eof})
+	testItems(t, "0b1010.", []item{num("0b1010"), dot, eof})
+	testItems(t, "-0xff.", []item{num("-0xff"), dot, eof})
+	testItems(t, "0.", []item{num("0"), dot, eof})
+	testItems(t, "0.5.", []item{num("0.5"), dot, eof})
+	testItems(t, "10.", []item{num("10"), dot, eof})
+
+	errs := []string{"0b2.", "0b.", "0o8.", "0xfg.", "0x."}
+	for _, test := range errs {
+		items := collect(test)
+		if n := len(items); n == 0 || items[n-1].typ != itemError {
+			t.Errorf("%q: expected lex error, got %v", test, items)
+		}
+	}
+}
+
+func TestCharCodes(t *testing.T) {
+	dot := item{typ: itemDot, val: "."}
+	eof := item{typ: itemEOF}
+	num := func(s string) item { return item{typ: itemNumber, val: s} }
+
+	testItems(t, "0'a.", []item{num("97"), dot, eof})
+	testItems(t, "0'\\n.", []item{num("10"), dot, eof})
+	testItems(t, "0'\\\\.", []item{num("92"), dot, eof})
+	testItems(t, "0'\\t.", []item{num("9"), dot, eof})
+	testItems(t, "0' .", []item{num("32"), dot, eof})
+	testItems(t, "0'''.", []item{num("39"), dot, eof})
+	testItems(t, "0'é.", []item{num("233"), dot, eof})
+	testItems(t, "-0'a.", []item{num("-97"), dot, eof})
+
+	errs := []string{"0'ab.", "0'\\q.", "0'"}
+	for _, test := range errs {
+		items := collect(test)
+		if n := len(items); n == 0 || items[n-1].typ != itemError {
+			t.Errorf("%q: expected lex error, got %v", test, items)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	items := collect("foo(a,\n  bar).\n\nbaz.")
+	exp := []struct {
+		val       string
+		line, col int
+	}{
+		{"foo", 1, 1}, {"(", 1, 4}, {"a", 1, 5}, {",", 1, 6},
+		{"bar", 2, 3}, {")", 2, 6}, {".", 2, 7},
+		{"baz", 4, 1}, {".", 4, 4},
+		{"", 4, 5},
+	}
+	if len(items) != len(exp) {
+		t.Fatalf("expected %d items, got %d: %v", len(exp), len(items), items)
+	}
+	for i, item := range items {
+		if item.val != exp[i].val || item.line != exp[i].line || item.col != exp[i].col {
+			t.Errorf("item %d, expected %q at %d:%d, got %q at %d:%d",
+				i, exp[i].val, exp[i].line, exp[i].col, item.val, item.line, item.col)
+		}
+	}
+}
+
+func TestLexReader(t *testing.T) {
+	// a program much larger than the lexer's read size, read a byte at a time
+	var b strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&b, "f%d('héllo wörld', %d).\n", i, i)
+	}
+	l := lexReader("test", iotest.OneByteReader(strings.NewReader(b.String())))
+	var atoms int
+	var last item
+	for i := range l.items {
+		if i.typ == itemQuoted && i.val == "'héllo wörld'" {
+			atoms++
+		}
+		last = i
+	}
+	if last.typ != itemEOF {
+		t.Fatalf("expected EOF, got %v", last)
+	}
+	if atoms != 10000 {
+		t.Errorf("expected 10000 quoted atoms, got %d", atoms)
+	}
+	if last.line != 10001 || last.col != 1 {
+		t.Errorf("expected EOF at 10001:1, got %d:%d", last.line, last.col)
+	}
+	// only the pending item should have been buffered
+	if n := cap(l.buf); n > 4*readSize {
+		t.Errorf("lexer buffered %d bytes of input", n)
+	}
+}
+
+func TestLexReaderError(t *testing.T) {
+	errRead := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("foo. "), iotest.ErrReader(errRead))
+	items := []item{}
+	for i := range lexReader("test", r).items {
+		items = append(items, i)
+	}
+	if n := len(items); n == 0 || items[n-1].typ != itemError {
+		t.Fatalf("expected lex error, got %v", items)
+	}
+	if msg := items[len(items)-1].val; !strings.Contains(msg, errRead.Error()) {
+		t.Errorf("expected read error, got %q", msg)
 	}
 }
@@ -0,0 +1,39 @@
+package parse
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+// LoadFile parses the Prolog source file at path and adds its clauses to p,
+// in the order they're defined. If the file can't be parsed, no clauses are
+// added and the error holds the path along with the position of the error.
+func LoadFile(p *syntax.Prog, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	clauses, err := ParseReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, c := range clauses {
+		p.Add(c)
+	}
+	return nil
+}
+
+// LoadString is like LoadFile, but parses the source held by src.
+func LoadString(p *syntax.Prog, src string) error {
+	clauses, err := Parse(src)
+	if err != nil {
+		return err
+	}
+	for _, c := range clauses {
+		p.Add(c)
+	}
+	return nil
+}
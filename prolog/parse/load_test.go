@@ -0,0 +1,65 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+const loadSrc = `
+likes(bob, pizza).
+likes(bob, beer).
+happy(X) :- likes(X, beer).
+`
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "likes.pl")
+	if err := os.WriteFile(path, []byte(loadSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := syntax.NewProg()
+	if err := LoadFile(p, path); err != nil {
+		t.Fatal(err)
+	}
+	x := syntax.NewVariable("X")
+	all, err := p.Query(syntax.NewGoal(syntax.NewCompound("likes", syntax.Atom("bob"), x))).All()
+	if err != nil || len(all) != 2 {
+		t.Errorf("expected 2 solutions got %d %v", len(all), err)
+	}
+	if _, ok, err := p.Query(syntax.NewGoal(syntax.NewCompound("happy", syntax.Atom("bob")))).First(); !ok || err != nil {
+		t.Errorf("expected happy(bob) to hold, got %t %v", ok, err)
+	}
+
+	if err := LoadFile(p, filepath.Join(t.TempDir(), "missing.pl")); err == nil {
+		t.Errorf("expected error loading missing file")
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.pl")
+	if err := os.WriteFile(bad, []byte("foo.\nf b."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p = syntax.NewProg()
+	err = LoadFile(p, bad)
+	if err == nil || !strings.HasPrefix(err.Error(), bad+": line 2 col 3:") {
+		t.Errorf("expected error at %s line 2 col 3, got %v", bad, err)
+	}
+	if n := p.ClauseCount("foo", 0); n != 0 {
+		t.Errorf("expected no clauses to be added on error, got %d", n)
+	}
+}
+
+func TestLoadString(t *testing.T) {
+	p := syntax.NewProg()
+	if err := LoadString(p, loadSrc); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.ClauseCount("likes", 2); n != 2 {
+		t.Errorf("expected 2 clauses got %d", n)
+	}
+	if err := LoadString(p, "f("); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
@@ -1,7 +1,19 @@
 package parse
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
 type Op struct {
-	Prec int // Operator precidence
+	Prec    int // Operator precidence
+	Pattern OpPattern
 }
 
 type OpPattern string
@@ -13,4 +25,613 @@ const (
 	OpPreAsso      OpPattern = "fy"  // - (i.e., - - 5 allowed)
 	OpPreNonAssoc  OpPattern = "fx"  // :- (i.e., :- :- goal not allowed)
 	OpPostAssoc    OpPattern = "yf"
+	OpPostNonAssoc OpPattern = "xf"
 )
+
+// The operator tables, indexed by the operator name. An atom may be both a
+// prefix and an infix operator, such as '-'.
+var (
+	prefixOps  = map[string]Op{}
+	infixOps   = map[string]Op{}
+	postfixOps = map[string]Op{}
+)
+
+func init() {
+	// Standard operators, see http://www.swi-prolog.org/pldoc/man?section=operators
+	defs := []struct {
+		prec    int
+		pattern OpPattern
+		names   []string
+	}{
+		{1200, OpInNonAssoc, []string{":-", "-->"}},
+		{1200, OpPreNonAssoc, []string{":-", "?-"}},
+		{1100, OpInRightAssoc, []string{";", "|"}},
+		{1050, OpInRightAssoc, []string{"->", "*->"}},
+		{1000, OpInRightAssoc, []string{","}},
+		{900, OpPreAsso, []string{`\+`}},
+		{700, OpInNonAssoc, []string{
+			"=", `\=`, "==", `\==`, "@<", "@>", "@=<", "@>=",
+			"=..", "is", "=:=", `=\=`, "<", ">", "=<", ">=",
+		}},
+		{600, OpInRightAssoc, []string{":"}},
+		{500, OpInLeftAssoc, []string{"+", "-", `/\`, `\/`, "xor"}},
+		{400, OpInLeftAssoc, []string{"*", "/", "//", "rem", "mod", "div", "<<", ">>"}},
+		{200, OpInNonAssoc, []string{"**"}},
+		{200, OpInRightAssoc, []string{"^"}},
+		{200, OpPreAsso, []string{"-", "+", `\`}},
+	}
+	for _, def := range defs {
+		for _, name := range def.names {
+			op := Op{def.prec, def.pattern}
+			switch def.pattern {
+			case OpPreAsso, OpPreNonAssoc:
+				prefixOps[name] = op
+			case OpPostAssoc, OpPostNonAssoc:
+				postfixOps[name] = op
+			default:
+				infixOps[name] = op
+			}
+		}
+	}
+}
+
+// PrefixOp returns the definition of the prefix operator name, if any.
+func PrefixOp(name string) (Op, bool) {
+	op, ok := prefixOps[name]
+	return op, ok
+}
+
+// InfixOp returns the definition of the infix operator name, if any.
+func InfixOp(name string) (Op, bool) {
+	op, ok := infixOps[name]
+	return op, ok
+}
+
+// PostfixOp returns the definition of the postfix operator name, if any.
+func PostfixOp(name string) (Op, bool) {
+	op, ok := postfixOps[name]
+	return op, ok
+}
+
+// ArgPrecs returns the maximum precedence of the left and right arguments of
+// the operator.
+func (op Op) ArgPrecs() (left, right int) {
+	left, right = op.Prec-1, op.Prec-1
+	switch op.Pattern {
+	case OpInLeftAssoc, OpPostAssoc:
+		left = op.Prec
+	case OpInRightAssoc, OpPreAsso:
+		right = op.Prec
+	}
+	return
+}
+
+// Parse parses the input as a Prolog program, returning the clauses in the
+// order they were defined.
+func Parse(input string) ([]syntax.Clause, error) {
+	return ParseReader(strings.NewReader(input))
+}
+
+// ParseReader parses a Prolog program read from r. The input is read
+// incrementally, so the program doesn't have to fit into memory at once.
+func ParseReader(r io.Reader) ([]syntax.Clause, error) {
+	p := newParser(r)
+	defer p.lex.drain()
+
+	var clauses []syntax.Clause
+	for p.peek().typ != itemEOF {
+		clause, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// VarName associates a named variable of a parsed term with its name.
+type VarName struct {
+	Name string
+	Var  *syntax.Variable
+}
+
+// ParseTerm parses the input as a single term, which may be followed by a
+// '.'. The named variables of the term are returned in the order they first
+// appear.
+func ParseTerm(input string) (syntax.Term, []VarName, error) {
+	p := &parser{lex: lexTerm(input)}
+	defer p.lex.drain()
+
+	p.resetVars()
+	t, err := p.parse(1200)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.peek().typ == itemDot {
+		p.next()
+	}
+	if _, err := p.expect(itemEOF); err != nil {
+		return nil, nil, err
+	}
+	return t, p.varNames, nil
+}
+
+// Reader reads a sequence of terms, each terminated by a '.'. Like
+// ParseReader, the input is read incrementally.
+type Reader struct {
+	p *parser
+}
+
+// NewReader returns a Reader reading terms from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{newParser(r)}
+}
+
+// Read reads the next term. The named variables of the term are returned in
+// the order they first appear, and singletons holds those which only appear
+// once. At the end of the input, Read returns io.EOF.
+func (r *Reader) Read() (t syntax.Term, vars, singletons []VarName, err error) {
+	p := r.p
+	if p.peek().typ == itemEOF {
+		return nil, nil, nil, io.EOF
+	}
+	p.resetVars()
+	t, err = p.parse(1200)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if _, err := p.expect(itemDot); err != nil {
+		return nil, nil, nil, err
+	}
+	return t, p.varNames, p.singletons(), nil
+}
+
+type parser struct {
+	lex       *lexer
+	token     item // lookahead token
+	peekCount int
+	vars      map[string]*syntax.Variable // variables of the current clause
+	varNames  []VarName                   // vars in the order they first appear
+	varUses   map[string]int              // the number of uses of each of vars
+}
+
+// resetVars forgets the variables of the previous clause.
+func (p *parser) resetVars() {
+	p.vars = make(map[string]*syntax.Variable)
+	p.varNames = nil
+	p.varUses = make(map[string]int)
+}
+
+// singletons returns the variables of the current clause which were only
+// used once.
+func (p *parser) singletons() []VarName {
+	var vars []VarName
+	for _, v := range p.varNames {
+		if p.varUses[v.Name] == 1 {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+func newParser(r io.Reader) *parser {
+	return &parser{lex: lexReader("", r)}
+}
+
+// compound creates a compound term.
+func compound(functor string, args ...syntax.Term) *syntax.Compound {
+	return syntax.NewCompound(syntax.Atom(functor), args...)
+}
+
+// decompose returns the functor and arguments of a compound term.
+func decompose(t syntax.Term) (functor syntax.Atom, args []syntax.Term, ok bool) {
+	c, ok := t.(*syntax.Compound)
+	if !ok {
+		return "", nil, false
+	}
+	return c.Functor(), c.Args(), true
+}
+
+// next returns the next token.
+func (p *parser) next() item {
+	if p.peekCount > 0 {
+		p.peekCount--
+	} else {
+		p.token = p.lex.nextItem()
+	}
+	return p.token
+}
+
+// peek returns but does not consume the next token.
+func (p *parser) peek() item {
+	if p.peekCount > 0 {
+		return p.token
+	}
+	p.peekCount = 1
+	p.token = p.lex.nextItem()
+	return p.token
+}
+
+// errorf returns an error annotated with the line and column of the given
+// item.
+func (p *parser) errorf(i item, format string, args ...interface{}) error {
+	return fmt.Errorf("line %d col %d: %s", i.line, i.col, fmt.Sprintf(format, args...))
+}
+
+// unexpected returns an error for an item the parser didn't expect.
+func (p *parser) unexpected(i item) error {
+	switch i.typ {
+	case itemError:
+		// the lexer has already annotated the error with its position
+		return errors.New(i.val)
+	case itemEOF:
+		return p.errorf(i, "unexpected end of input")
+	}
+	return p.errorf(i, "unexpected %q", i.val)
+}
+
+// expect consumes the next token, returning an error if it isn't of the given
+// type.
+func (p *parser) expect(typ itemType) (item, error) {
+	i := p.next()
+	if i.typ != typ {
+		return i, p.unexpected(i)
+	}
+	return i, nil
+}
+
+// parseClause parses a single clause terminated by a '.'.
+func (p *parser) parseClause() (syntax.Clause, error) {
+	p.resetVars()
+	start := p.peek()
+	t, err := p.parse(1200)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(itemDot); err != nil {
+		return nil, err
+	}
+
+	if functor, args, ok := decompose(t); ok && functor == "-->" && len(args) == 2 {
+		rule, err := ExpandDCG(args[0], args[1])
+		if err != nil {
+			return nil, p.errorf(start, "%v", err)
+		}
+		return rule, nil
+	}
+
+	var head, body syntax.Term = t, nil
+	if functor, args, ok := decompose(t); ok && functor == ":-" {
+		switch len(args) {
+		case 2:
+			head, body = args[0], args[1]
+		case 1:
+			return nil, p.errorf(start, "directives are not supported")
+		}
+	}
+
+	functor, args, ok := decompose(head)
+	if !ok {
+		a, isAtom := head.(syntax.Atom)
+		if !isAtom {
+			return nil, p.errorf(start, "clause head %s is not callable", head)
+		}
+		functor = a
+	}
+	if body != nil {
+		return syntax.NewRule(functor, args, p.toGoal(body)), nil
+	}
+	if len(p.vars) > 0 {
+		// Facts with variables must be copied each time they are called.
+		return syntax.NewRule(functor, args, nil), nil
+	}
+	return syntax.NewCompound(functor, args...), nil
+}
+
+// toGoal converts a conjunction of terms to a goal.
+func (p *parser) toGoal(t syntax.Term) *syntax.Goal {
+	var terms []syntax.Term
+	for {
+		functor, args, ok := decompose(t)
+		if !ok || functor != "," || len(args) != 2 {
+			break
+		}
+		terms = append(terms, goalTerm(args[0]))
+		t = args[1]
+	}
+	terms = append(terms, goalTerm(t))
+	return syntax.GoalFromSlice(terms)
+}
+
+func goalTerm(t syntax.Term) syntax.Term {
+	if t == syntax.Atom("!") {
+		return syntax.Cut
+	}
+	return t
+}
+
+// parse parses a term whose precedence doesn't exceed maxPrec.
+func (p *parser) parse(maxPrec int) (syntax.Term, error) {
+	left, leftPrec, err := p.parsePrimary(maxPrec)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		i := p.peek()
+		var name string
+		switch i.typ {
+		case itemAtom:
+			name = i.val
+		case itemComma:
+			name = ","
+		case itemPipe:
+			name = "|"
+		default:
+			return left, nil
+		}
+
+		if op, ok := infixOps[name]; ok {
+			leftMax, rightMax := op.ArgPrecs()
+			if op.Prec <= maxPrec && leftPrec <= leftMax {
+				p.next()
+				right, err := p.parse(rightMax)
+				if err != nil {
+					return nil, err
+				}
+				if name == "|" {
+					name = ";"
+				}
+				left, leftPrec = compound(name, left, right), op.Prec
+				continue
+			}
+		}
+		if op, ok := postfixOps[name]; ok {
+			leftMax, _ := op.ArgPrecs()
+			if op.Prec <= maxPrec && leftPrec <= leftMax {
+				p.next()
+				left, leftPrec = compound(name, left), op.Prec
+				continue
+			}
+		}
+		return left, nil
+	}
+}
+
+// parsePrimary parses a term which isn't the left argument of an infix or
+// postfix operator. It returns the term and its precedence.
+func (p *parser) parsePrimary(maxPrec int) (syntax.Term, int, error) {
+	i := p.next()
+	switch i.typ {
+	case itemNumber:
+		t, err := parseNumber(i.val)
+		if err != nil {
+			return nil, 0, p.errorf(i, "%v", err)
+		}
+		return t, 0, nil
+	case itemVariable:
+		return p.variable(i.val), 0, nil
+	case itemLeftParen:
+		t, err := p.parse(1200)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := p.expect(itemRightParen); err != nil {
+			return nil, 0, err
+		}
+		return t, 0, nil
+	case itemLeftBrace:
+		if p.peek().typ == itemRightBrace {
+			p.next()
+			return syntax.EmptyList, 0, nil
+		}
+		t, err := p.parseList()
+		return t, 0, err
+	case itemLeftCurly:
+		if p.peek().typ == itemRightCurly {
+			p.next()
+			return syntax.Atom("{}"), 0, nil
+		}
+		t, err := p.parse(1200)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := p.expect(itemRightCurly); err != nil {
+			return nil, 0, err
+		}
+		return compound("{}", t), 0, nil
+	case itemCut:
+		return syntax.Atom("!"), 0, nil
+	case itemString:
+		s, err := unquote(i.val)
+		if err != nil {
+			return nil, 0, p.errorf(i, "%v", err)
+		}
+		return syntax.String(s), 0, nil
+	case itemAtom, itemQuoted:
+		name := i.val
+		if i.typ == itemQuoted {
+			var err error
+			if name, err = unquote(i.val); err != nil {
+				return nil, 0, p.errorf(i, "%v", err)
+			}
+		}
+		if next := p.peek(); next.typ == itemLeftParen && next.pos == i.pos+len(i.val) {
+			p.next()
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, 0, err
+			}
+			return compound(name, args...), 0, nil
+		}
+		if op, ok := prefixOps[name]; ok && i.typ == itemAtom && op.Prec <= maxPrec && p.startsTerm() {
+			_, argMax := op.ArgPrecs()
+			arg, err := p.parse(argMax)
+			if err != nil {
+				return nil, 0, err
+			}
+			return compound(name, arg), op.Prec, nil
+		}
+		return syntax.Atom(name), 0, nil
+	}
+	return nil, 0, p.unexpected(i)
+}
+
+// startsTerm reports whether the next token can begin the argument of a
+// prefix operator.
+func (p *parser) startsTerm() bool {
+	i := p.peek()
+	switch i.typ {
+	case itemNumber, itemVariable, itemLeftParen, itemLeftBrace, itemLeftCurly, itemCut, itemQuoted, itemString:
+		return true
+	case itemAtom:
+		// An infix operator following a prefix operator means the prefix
+		// operator is being used as an atom. For example "- = X".
+		_, infix := infixOps[i.val]
+		_, prefix := prefixOps[i.val]
+		return !infix || prefix
+	}
+	return false
+}
+
+// parseArgs parses the comma separated arguments of a compound term. It
+// assumes the left paren has already been consumed.
+func (p *parser) parseArgs() ([]syntax.Term, error) {
+	var args []syntax.Term
+	for {
+		arg, err := p.parse(999)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		i := p.next()
+		switch i.typ {
+		case itemComma:
+		case itemRightParen:
+			return args, nil
+		default:
+			return nil, p.unexpected(i)
+		}
+	}
+}
+
+// parseList parses the elements of a non-empty list. It assumes the left
+// brace has already been consumed.
+func (p *parser) parseList() (syntax.Term, error) {
+	var elems []syntax.Term
+	var tail syntax.Term = syntax.EmptyList
+loop:
+	for {
+		elem, err := p.parse(999)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		i := p.next()
+		switch i.typ {
+		case itemComma:
+		case itemPipe:
+			if tail, err = p.parse(999); err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(itemRightBrace); err != nil {
+				return nil, err
+			}
+			break loop
+		case itemRightBrace:
+			break loop
+		default:
+			return nil, p.unexpected(i)
+		}
+	}
+	for i := len(elems) - 1; i >= 0; i-- {
+		tail = compound(".", elems[i], tail)
+	}
+	return tail, nil
+}
+
+// variable returns the variable with the given name in the current clause,
+// creating it if it doesn't exist. Each use of the anonymous variable '_'
+// creates a new variable.
+func (p *parser) variable(name string) *syntax.Variable {
+	if name == "_" {
+		return syntax.NewVariable(name)
+	}
+	v, ok := p.vars[name]
+	if !ok {
+		v = syntax.NewVariable(name)
+		p.vars[name] = v
+		p.varNames = append(p.varNames, VarName{name, v})
+	}
+	p.varUses[name]++
+	return v
+}
+
+// Number parses s as a number using Prolog syntax, such as "42", "-1.5e3",
+// "0xff" or "0'a". Leading layout is allowed, but s must hold nothing other
+// than the number.
+func Number(s string) (syntax.Term, error) {
+	if strings.TrimRightFunc(s, unicode.IsSpace) != s {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	l := lex("number", s+".")
+	defer l.drain()
+	num, dot, end := <-l.items, <-l.items, <-l.items
+	if num.typ != itemNumber || dot.typ != itemDot || end.typ != itemEOF {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return parseNumber(num.val)
+}
+
+// parseNumber parses an integer or floating point number. Integers may have
+// a hexadecimal, octal or binary prefix.
+func parseNumber(s string) (syntax.Term, error) {
+	if strings.ContainsAny(s, ".eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return syntax.Float64(f), nil
+	}
+	// Only honor Go's base prefixes for radix literals, otherwise "010"
+	// would be parsed as an octal number.
+	base := 10
+	if digits := strings.TrimLeft(s, "+-"); len(digits) > 1 && digits[0] == '0' && radix(rune(digits[1])) != "" {
+		base = 0
+	}
+	n, err := strconv.ParseInt(s, base, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return syntax.Integer(n), nil
+}
+
+// unquote removes the quotes surrounding a quoted atom and interprets any
+// escape sequences.
+func unquote(s string) (string, error) {
+	quote := s[0]
+	s = s[1 : len(s)-1]
+	if !strings.ContainsAny(s, `\`+string(quote)) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			// a doubled quote, such as 'don''t'
+			i++
+		case c == '\\':
+			i++
+			if i >= len(s) {
+				return "", fmt.Errorf("invalid escape sequence in %q", s)
+			}
+			esc, ok := unescape(rune(s[i]))
+			if !ok {
+				return "", fmt.Errorf("invalid escape sequence \\%c", s[i])
+			}
+			c = byte(esc)
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
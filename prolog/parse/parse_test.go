@@ -0,0 +1,349 @@
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ericchiang/pl/prolog/syntax"
+)
+
+func testParse(t *testing.T, input string, exp ...string) {
+	clauses, err := Parse(input)
+	if err != nil {
+		t.Errorf("%q: %v", input, err)
+		return
+	}
+	if len(clauses) != len(exp) {
+		t.Errorf("%q: expected %d clauses, got %d: %s", input, len(exp), len(clauses), clauses)
+		return
+	}
+	for i, clause := range clauses {
+		if got := clause.(interface {
+			String() string
+		}).String(); got != exp[i] {
+			t.Errorf("%q: clause %d, expected %s got %s", input, i, exp[i], got)
+		}
+	}
+}
+
+func TestParseFacts(t *testing.T) {
+	testParse(t, "foo.", "foo")
+	testParse(t, "likes(eric, pizza).", "likes(eric, pizza)")
+	testParse(t, "likes(eric, pizza). likes(bob, beer).",
+		"likes(eric, pizza)", "likes(bob, beer)")
+	testParse(t, "f(1, 2.5, 'Quoted atom', 'it''s', 'a\\nb').",
+		"f(1, 2.5, Quoted atom, it's, a\nb)")
+	testParse(t, "f(g(h(X)), _, Y).", "f(g(h(X)), _, Y)")
+	testParse(t, "'hello world'(a).", "hello world(a)")
+}
+
+func TestParseRules(t *testing.T) {
+	testParse(t, "friends(X, Y) :- likes(X, Z), likes(Y, Z).",
+		"friends(X, Y) :- likes(X, Z), likes(Y, Z).")
+	testParse(t, "foo :- bar.", "foo :- bar.")
+	testParse(t, "foo(X) :- bar(X), !, baz.", "foo(X) :- bar(X), !, baz.")
+	testParse(t, "foo :- (a ; b), c.", "foo :- ;(a, b), c.")
+	testParse(t, "foo :- a | b.", "foo :- ;(a, b).")
+	testParse(t, "foo :- a -> b ; c.", "foo :- ;(->(a, b), c).")
+}
+
+func TestParseOperators(t *testing.T) {
+	testParse(t, "f(X) :- X is 1 + 2 * 3.", "f(X) :- is(X, +(1, *(2, 3))).")
+	testParse(t, "f(X) :- X is (1 + 2) * 3.", "f(X) :- is(X, *(+(1, 2), 3)).")
+	testParse(t, "f(X) :- X is 1 - 2 - 3.", "f(X) :- is(X, -(-(1, 2), 3)).")
+	testParse(t, "f(X) :- X = a:b:c.", "f(X) :- =(X, :(a, :(b, c))).")
+	testParse(t, "f(X) :- X is 2 ** 3.", "f(X) :- is(X, **(2, 3)).")
+	testParse(t, "f(X) :- X is - 1.", "f(X) :- is(X, -(1)).")
+	testParse(t, "f(X) :- X is - - 1.", "f(X) :- is(X, -(-(1))).")
+	testParse(t, "f(X) :- X is -(1).", "f(X) :- is(X, -(1)).")
+	testParse(t, "f(X) :- X is -(1, 2).", "f(X) :- is(X, -(1, 2)).")
+	testParse(t, "f(X) :- \\+ X.", "f(X) :- \\+(X).")
+	testParse(t, "f(X) :- \\+ (a, b).", "f(X) :- \\+(,(a, b)).")
+	testParse(t, "f(X) :- X =.. [a].", "f(X) :- =..(X, .(a, [])).")
+	testParse(t, "f(X) :- X = (-).", "f(X) :- =(X, -).")
+	testParse(t, "f(X) :- X = - .", "f(X) :- =(X, -).")
+}
+
+func TestParseLists(t *testing.T) {
+	testParse(t, "f([]).", "f([])")
+	testParse(t, "f([a]).", "f(.(a, []))")
+	testParse(t, "f([a, b, c]).", "f(.(a, .(b, .(c, []))))")
+	testParse(t, "f([H|T]).", "f(.(H, T))")
+	testParse(t, "f([a, b|T]).", "f(.(a, .(b, T)))")
+	testParse(t, "f([[a], [b]]).", "f(.(.(a, []), .(.(b, []), [])))")
+	testParse(t, "f([(a:-b), (c, d)]).", "f(.(:-(a, b), .(,(c, d), [])))")
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+	}{
+		{"foo", 1},
+		{"foo(.", 1},
+		{"foo.\nbar(a b).", 2},
+		{"foo.\n\nbar([a|b|c]).", 3},
+		{"foo(a, ).", 1},
+		{"1.", 1},
+		{"foo :- 1 + .", 1},
+		{"foo.\n'unterminated.", 2},
+		{"foo.\nbar :- a :- b.", 2},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.input)
+		if err == nil {
+			t.Errorf("%q: expected parse error", test.input)
+			continue
+		}
+		if exp := fmt.Sprintf("line %d col", test.line); !strings.HasPrefix(err.Error(), exp) {
+			t.Errorf("%q: expected error on line %d, got %v", test.input, test.line, err)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	clauses, err := Parse(`
+		likes(eric, pizza).
+		likes(bob, pizza).
+		likes(bob, beer).
+		friends(X, Y) :- likes(X, Z), likes(Y, Z).
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := syntax.NewProg(clauses...)
+	x := syntax.NewVariable("X")
+	r := p.Query(syntax.NewGoal(syntax.NewCompound("friends", syntax.Atom("eric"), x)))
+	var got []string
+	for r.Next() {
+		got = append(got, x.Value().(syntax.Atom).String())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "eric bob"; strings.Join(got, " ") != exp {
+		t.Errorf("expected friends %s, got %s", exp, got)
+	}
+}
+
+func TestParseSignedNumbers(t *testing.T) {
+	testParse(t, "f(-1, -2.5, +3).", "f(-1, -2.5, 3)")
+	testParse(t, "f(X) :- X is 3 - -1.", "f(X) :- is(X, -(3, -1)).")
+	testParse(t, "f(X) :- X is 3-1.", "f(X) :- is(X, -(3, 1)).")
+	testParse(t, "f(X) :- X is -3.", "f(X) :- is(X, -3).")
+	testParse(t, "f(X) :- X = a-1.", "f(X) :- =(X, -(a, 1)).")
+}
+
+func TestParseRadixNumbers(t *testing.T) {
+	testParse(t, "f(0xff, 0o77, 0b1010, -0x10).", "f(255, 63, 10, -16)")
+	testParse(t, "f(0, 010, 0.5).", "f(0, 10, 0.5)")
+}
+
+func TestParseCharCodes(t *testing.T) {
+	testParse(t, "f(0'a, 0' , 0'\\n).", "f(97, 32, 10)")
+	testParse(t, "f(X) :- X is 0'a + 1.", "f(X) :- is(X, +(97, 1)).")
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		input string
+		exp   string
+	}{
+		{"foo.\nf b.", "line 2 col 3"},     // parse error
+		{"foo.\nba\x01r.", "line 2 col 3"}, // lex error
+		{"foo.\n  bar(.", "line 2 col 7"},
+		{"foo(a,\n\n  [a|b|c]).", "line 3 col 7"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.input)
+		if err == nil {
+			t.Errorf("%q: expected parse error", test.input)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), test.exp+":") {
+			t.Errorf("%q: expected error at %s, got %v", test.input, test.exp, err)
+		}
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	// generate a few megabytes of source and stream it through the parser
+	const n = 20000
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(pw)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(w, "edge(n%d, n%d, [%d, 'wörld', \"label\"]).\n", i, i+1, i)
+			fmt.Fprintf(w, "path(X, Y) :- edge(X, Z, _), path(Z, Y). %% %d\n", i)
+		}
+		pw.CloseWithError(w.Flush())
+	}()
+	clauses, err := ParseReader(iotest.HalfReader(pr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clauses) != 2*n {
+		t.Fatalf("expected %d clauses, got %d", 2*n, len(clauses))
+	}
+	exp := fmt.Sprintf("edge(n%d, n%d, .(%d, .(wörld, .(\"label\", []))))", n-1, n, n-1)
+	if got := fmt.Sprint(clauses[2*n-2]); got != exp {
+		t.Errorf("expected %s got %s", exp, got)
+	}
+}
+
+func TestParseStrings(t *testing.T) {
+	tests := []struct {
+		input string
+		exp   syntax.Term
+	}{
+		{`"hello"`, syntax.String("hello")},
+		{`"don""t"`, syntax.String(`don"t`)},
+		{`"a\nb"`, syntax.String("a\nb")},
+		{`'hello'`, syntax.Atom("hello")},
+		{`""`, syntax.String("")},
+	}
+	for _, test := range tests {
+		term, _, err := ParseTerm(test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if term != test.exp {
+			t.Errorf("%s: expected %#v got %#v", test.input, test.exp, term)
+		}
+	}
+}
+
+func TestParseReaderErrors(t *testing.T) {
+	_, err := ParseReader(iotest.OneByteReader(strings.NewReader("foo.\nf b.")))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2 col 3:") {
+		t.Errorf("expected error at line 2 col 3, got %v", err)
+	}
+	_, err = ParseReader(iotest.TimeoutReader(strings.NewReader("foo. bar.")))
+	if err == nil {
+		t.Errorf("expected read error")
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		s   string
+		exp syntax.Term
+	}{
+		{"42", syntax.Integer(42)},
+		{"-42", syntax.Integer(-42)},
+		{" 42", syntax.Integer(42)},
+		{"3.14", syntax.Float64(3.14)},
+		{"-1.5e3", syntax.Float64(-1500)},
+		{"0xff", syntax.Integer(255)},
+		{"0'a", syntax.Integer(97)},
+	}
+	for _, test := range tests {
+		n, err := Number(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if syntax.Compare(n, test.exp) != 0 {
+			t.Errorf("%q: expected %s got %s", test.s, test.exp, n)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "42 ", "4 2", "1.", "- 1", "1+1", "0x", "'1'", "1. foo"} {
+		if n, err := Number(s); err == nil {
+			t.Errorf("%q: expected error, got %s", s, n)
+		}
+	}
+}
+
+func TestParseTerm(t *testing.T) {
+	tests := []struct {
+		input string
+		exp   string
+		vars  []string
+	}{
+		{"foo", "foo", nil},
+		{"f(1,2)", "f(1, 2)", nil},
+		{"f(X, 1).", "f(X, 1)", []string{"X"}},
+		{"g(Y, X, Y, _)", "g(Y, X, Y, _)", []string{"Y", "X"}},
+		{"a :- b, c", ":-(a, ,(b, c))", nil},
+		{"[H|T]", ".(H, T)", []string{"H", "T"}},
+	}
+	for _, test := range tests {
+		term, vars, err := ParseTerm(test.input)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got := fmt.Sprint(term); got != test.exp {
+			t.Errorf("%q: expected %s got %s", test.input, test.exp, got)
+		}
+		var names []string
+		for _, v := range vars {
+			names = append(names, v.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(test.vars) {
+			t.Errorf("%q: expected variables %s got %s", test.input, test.vars, names)
+		}
+	}
+
+	term, vars, err := ParseTerm("f(X, X)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := term.(*syntax.Compound).Args(); len(vars) != 1 || args[0] != vars[0].Var || args[1] != vars[0].Var {
+		t.Errorf("expected both arguments of %s to be the variable %v", term, vars)
+	}
+
+	for _, s := range []string{"", "f(", "a. b", "a b", "f(X) :- "} {
+		if term, _, err := ParseTerm(s); err == nil {
+			t.Errorf("%q: expected error, got %s", s, term)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader("f(X, _Y, Z, X). % comment\n g(A) :- h(A, B).\n"))
+	tests := []struct {
+		exp        string
+		vars       string
+		singletons string
+	}{
+		{"f(X, _Y, Z, X)", "[X _Y Z]", "[_Y Z]"},
+		{":-(g(A), h(A, B))", "[A B]", "[B]"},
+	}
+	names := func(vars []VarName) string {
+		var s []string
+		for _, v := range vars {
+			s = append(s, v.Name)
+		}
+		return fmt.Sprint(s)
+	}
+	for _, test := range tests {
+		term, vars, singletons, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(term); got != test.exp {
+			t.Errorf("expected %s got %s", test.exp, got)
+		}
+		if got := names(vars); got != test.vars {
+			t.Errorf("%s: expected variables %s got %s", term, test.vars, got)
+		}
+		if got := names(singletons); got != test.singletons {
+			t.Errorf("%s: expected singletons %s got %s", term, test.singletons, got)
+		}
+	}
+	if term, _, _, err := r.Read(); err != io.EOF {
+		t.Errorf("expected EOF, got %s, %v", term, err)
+	}
+
+	r = NewReader(strings.NewReader("f(x) g(y)."))
+	if term, _, _, err := r.Read(); err == nil {
+		t.Errorf("expected error, got %s", term)
+	}
+}
@@ -0,0 +1,141 @@
+package syntax
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// Compare compares two terms using the standard order of terms, returning -1
+// if a precedes b, 0 if they're identical and 1 if b precedes a.
+//
+// Terms are ordered as follows:
+//
+//	Variables < Numbers < Atoms < Strings < Compounds
+//
+// Unbound variables are ordered by address. Numbers are compared by value,
+// with an Integer preceding a Float64 of the same value. Atoms and strings
+// are compared alphabetically. Compounds are ordered by arity, then by name,
+// then by their arguments from left to right. Bound variables are compared using the terms
+// they're bound to.
+func Compare(a, b Term) int {
+	a, b = deref(a), deref(b)
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return cmpInt(ra, rb)
+	}
+	switch a := a.(type) {
+	case *Variable, *anonVariable:
+		return cmpUintptr(address(a), address(b))
+	case Integer:
+		switch b := b.(type) {
+		case Integer:
+			return cmpInt(int(a), int(b))
+		case Float64:
+			if c := cmpFloat(float64(a), float64(b)); c != 0 {
+				return c
+			}
+			return -1
+		}
+	case Float64:
+		switch b := b.(type) {
+		case Integer:
+			if c := cmpFloat(float64(a), float64(b)); c != 0 {
+				return c
+			}
+			return 1
+		case Float64:
+			return cmpFloat(float64(a), float64(b))
+		}
+	case Atom:
+		return strings.Compare(string(a), string(atomOf(b)))
+	case String:
+		return strings.Compare(string(a), string(b.(String)))
+	case *Compound:
+		c := b.(*Compound)
+		if n := cmpInt(len(a.args), len(c.args)); n != 0 {
+			return n
+		}
+		if n := strings.Compare(string(a.functor), string(c.functor)); n != 0 {
+			return n
+		}
+		for i, arg := range a.args {
+			if n := Compare(arg, c.args[i]); n != 0 {
+				return n
+			}
+		}
+		return 0
+	}
+	// Cut is ordered as the atom '!'.
+	if a == Cut {
+		return strings.Compare("!", string(atomOf(b)))
+	}
+	return 0
+}
+
+// deref returns the term a variable is bound to, see Deref.
+func deref(t Term) Term {
+	return Deref(t)
+}
+
+// rank returns the position of a term's type in the standard order of terms.
+func rank(t Term) int {
+	switch t.(type) {
+	case *Variable, *anonVariable:
+		return 0
+	case Integer, Float64:
+		return 1
+	case Atom, *cut:
+		return 2
+	case String:
+		return 3
+	}
+	return 4
+}
+
+// atomOf returns the name of an atom ranked term.
+func atomOf(t Term) Atom {
+	if t == Cut {
+		return "!"
+	}
+	a, _ := t.(Atom)
+	return a
+}
+
+func address(t Term) uintptr {
+	switch t := t.(type) {
+	case *Variable:
+		return uintptr(unsafe.Pointer(t))
+	case *anonVariable:
+		return uintptr(unsafe.Pointer(t))
+	}
+	return 0
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpUintptr(a, b uintptr) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
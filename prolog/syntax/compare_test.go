@@ -0,0 +1,77 @@
+package syntax
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	x, y := NewVariable("X"), NewVariable("Y")
+	bound := NewVariable("B")
+	bound.Unify(Atom("foo"))
+
+	tests := []struct {
+		a, b Term
+		exp  int
+	}{
+		{x, x, 0},
+		{x, Integer(1), -1},
+		{Integer(1), Atom("a"), -1},
+		{Float64(100), Atom("a"), -1},
+		{Atom("z"), NewCompound("a", Atom("a")), -1},
+		{Integer(1), Integer(2), -1},
+		{Integer(2), Float64(1.5), 1},
+		{Float64(1.5), Integer(2), -1},
+		{Integer(1), Float64(1), -1},
+		{Float64(1), Integer(1), 1},
+		{Float64(1), Float64(1), 0},
+		{Atom("bar"), Atom("foo"), -1},
+		{Atom("foo"), Atom("foo"), 0},
+		{bound, Atom("foo"), 0},
+		{Cut, Atom("!"), 0},
+		{Atom("z"), String("a"), -1},
+		{Integer(1), String("a"), -1},
+		{String("z"), NewCompound("a", Atom("a")), -1},
+		{String("bar"), String("foo"), -1},
+		{String("foo"), String("foo"), 0},
+		{NewCompound("z", Atom("a")), NewCompound("a", Atom("a"), Atom("a")), -1},
+		{NewCompound("f", Atom("a")), NewCompound("g", Atom("a")), -1},
+		{NewCompound("f", Atom("a"), Integer(2)), NewCompound("f", Atom("a"), Integer(1)), 1},
+		{NewCompound("f", x, y), NewCompound("f", x, y), 0},
+	}
+	for _, test := range tests {
+		if got := Compare(test.a, test.b); got != test.exp {
+			t.Errorf("Compare(%s, %s): expected %d got %d", test.a, test.b, test.exp, got)
+		}
+		if got := Compare(test.b, test.a); got != -test.exp {
+			t.Errorf("Compare(%s, %s): expected %d got %d", test.b, test.a, -test.exp, got)
+		}
+	}
+}
+
+func TestCompareTotalOrder(t *testing.T) {
+	x, y := NewVariable("X"), NewVariable("Y")
+	terms := []Term{
+		x, y, AnonVariable,
+		Integer(-1), Integer(1), Integer(2),
+		Float64(-1), Float64(1), Float64(1.5),
+		Atom("a"), Atom("b"), Atom("[]"), Cut,
+		String("a"), String("b"), String(""),
+		NewCompound("f", Atom("a")), NewCompound("f", Atom("b")),
+		NewCompound("g", Atom("a")), NewCompound("f", Atom("a"), x),
+		NewCompound("f", Atom("a"), y), NewCompound("f", Integer(1), Atom("a")),
+	}
+	for _, a := range terms {
+		if Compare(a, a) != 0 {
+			t.Errorf("expected %s to equal itself", a)
+		}
+		for _, b := range terms {
+			ab, ba := Compare(a, b), Compare(b, a)
+			if ab != -ba {
+				t.Errorf("antisymmetry: Compare(%s, %s) = %d, Compare(%s, %s) = %d", a, b, ab, b, a, ba)
+			}
+			for _, c := range terms {
+				if ab <= 0 && Compare(b, c) <= 0 && Compare(a, c) > 0 {
+					t.Errorf("transitivity: %s <= %s <= %s but %s > %s", a, b, c, a, c)
+				}
+			}
+		}
+	}
+}
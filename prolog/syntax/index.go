@@ -0,0 +1,86 @@
+package syntax
+
+// argIndex groups the clauses of a predicate by their first argument, so a
+// goal whose first argument is a constant only tries the clauses which could
+// match it.
+type argIndex struct {
+	// byKey holds the clauses for each constant first argument. Each list
+	// also holds the unindexed clauses, so the clauses are in program order.
+	byKey map[Term][]Clause
+	// unindexed holds the clauses whose first argument isn't a constant,
+	// such as variables, compounds and builtins.
+	unindexed []Clause
+}
+
+func newArgIndex(clauses []Clause) *argIndex {
+	idx := &argIndex{byKey: make(map[Term][]Clause)}
+	for _, c := range clauses {
+		idx.add(c)
+	}
+	return idx
+}
+
+// indexKey returns the key used to index a first argument, false if t isn't
+// a constant. Numbers which unify, such as 1 and 1.0, share a key.
+func indexKey(t Term) (Term, bool) {
+	switch t := deref(t).(type) {
+	case Atom, String:
+		return t, true
+	case Integer:
+		return Float64(t), true
+	case Float64:
+		return t, true
+	}
+	return nil, false
+}
+
+// clauseKey returns the key of a clause's first argument.
+func clauseKey(c Clause) (Term, bool) {
+	var args []Term
+	switch c := c.(type) {
+	case *Compound:
+		args = c.args
+	case *Rule:
+		args = c.args
+	}
+	if len(args) == 0 {
+		return nil, false
+	}
+	// a variable may be unbound by the time the clause is called
+	if _, ok := args[0].(*Variable); ok {
+		return nil, false
+	}
+	return indexKey(args[0])
+}
+
+// add adds a clause after all clauses already held by the index.
+func (idx *argIndex) add(c Clause) {
+	key, ok := clauseKey(c)
+	if !ok {
+		// an unindexed clause may match any goal
+		idx.unindexed = append(idx.unindexed, c)
+		for k, clauses := range idx.byKey {
+			idx.byKey[k] = append(clauses, c)
+		}
+		return
+	}
+	clauses, ok := idx.byKey[key]
+	if !ok {
+		// copy rather than share the backing array of unindexed
+		clauses = append([]Clause(nil), idx.unindexed...)
+	}
+	idx.byKey[key] = append(clauses, c)
+}
+
+// lookup returns the clauses which may match a goal with the first argument
+// t. If t isn't a constant, ok is false and all clauses must be tried.
+func (idx *argIndex) lookup(t Term) (clauses []Clause, ok bool) {
+	key, ok := indexKey(t)
+	if !ok {
+		return nil, false
+	}
+	if clauses, ok := idx.byKey[key]; ok {
+		return clauses, true
+	}
+	return idx.unindexed, true
+}
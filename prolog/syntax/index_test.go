@@ -0,0 +1,115 @@
+package syntax
+
+import "testing"
+
+func TestIndex(t *testing.T) {
+	x := NewVariable("X")
+	f := func(arg Term, n int) Clause { return NewCompound("f", arg, Integer(n)) }
+	p := NewProg(
+		f(Atom("a"), 1),
+		f(Atom("b"), 2),
+		NewRule("f", []Term{x, Integer(3)}, nil),
+		f(Atom("a"), 4),
+		f(Integer(1), 5),
+		f(NewCompound("g", Atom("a")), 6),
+		f(Float64(2), 7),
+	)
+
+	solutions := func(arg Term) []Term {
+		n := NewVariable("N")
+		all, err := p.Query(NewGoal(NewCompound("f", arg, n))).All()
+		if err != nil {
+			t.Fatalf("f(%s, N): %v", arg, err)
+		}
+		var got []Term
+		for _, b := range all {
+			got = append(got, b[n])
+		}
+		return got
+	}
+	test := func(arg Term, exp ...int) {
+		t.Helper()
+		got := solutions(arg)
+		if len(got) != len(exp) {
+			t.Errorf("f(%s, N): expected %d solutions got %s", arg, exp, got)
+			return
+		}
+		for i, n := range exp {
+			if got[i] != Integer(n) {
+				t.Errorf("f(%s, N): expected %d got %s", arg, exp, got)
+				return
+			}
+		}
+	}
+
+	test(Atom("a"), 1, 3, 4)
+	test(Atom("b"), 2, 3)
+	test(Atom("c"), 3)
+	test(Integer(1), 3, 5)
+	test(Float64(1), 3, 5)
+	test(Integer(2), 3, 7)
+	test(NewCompound("g", Atom("a")), 3, 6)
+	test(NewVariable("Y"), 1, 2, 3, 4, 5, 6, 7)
+
+	p.Add(f(Atom("c"), 8))
+	p.Add(NewRule("f", []Term{NewVariable("Y"), Integer(9)}, nil))
+	p.AddFirst(f(Atom("a"), 0))
+	test(Atom("a"), 0, 1, 3, 4, 9)
+	test(Atom("c"), 3, 8, 9)
+	test(Atom("d"), 3, 9)
+
+	clauses := p.Clauses("f", 2)
+	p.RemoveClause(clauses[0])
+	p.RemoveClause(clauses[3])
+	test(Atom("a"), 1, 4, 9)
+	test(Atom("d"), 9)
+
+	p.Remove("f", 2)
+	test(Atom("a"))
+}
+
+func TestIndexAddDuringQuery(t *testing.T) {
+	p := NewProg(NewCompound("f", Atom("a")))
+	r := p.Query(NewGoal(NewCompound("f", Atom("a"))))
+	defer r.Close()
+	p.Add(NewCompound("f", Atom("a")))
+	n := 0
+	for r.Next() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected clauses added after the query to be ignored, got %d solutions", n)
+	}
+}
+
+func TestIndexLookup(t *testing.T) {
+	p := NewProg()
+	for i := 0; i < 10000; i++ {
+		p.Add(NewCompound("f", Integer(i), Atom("x")))
+	}
+	s := sig{"f", 2}
+	if p.index[s] != nil {
+		t.Fatalf("expected index to be built lazily")
+	}
+	if n := len(p.match(NewCompound("f", Integer(5000), NewVariable("X")))); n != 1 {
+		t.Errorf("expected 1 clause to match, got %d", n)
+	}
+	if p.index[s] == nil {
+		t.Fatalf("expected index to be built by match")
+	}
+	if n := len(p.match(NewCompound("f", NewVariable("X"), Atom("x")))); n != 10000 {
+		t.Errorf("expected all clauses to match an unbound argument, got %d", n)
+	}
+
+	// clauses added to the end update the index
+	p.Add(NewCompound("f", Integer(5000), Atom("y")))
+	if n := len(p.match(NewCompound("f", Integer(5000), NewVariable("X")))); n != 2 {
+		t.Errorf("expected 2 clauses to match, got %d", n)
+	}
+
+	// other changes drop it
+	p.AddFirst(NewCompound("f", Integer(-1), Atom("x")))
+	if p.index[s] != nil {
+		t.Errorf("expected AddFirst to drop the index")
+	}
+}
@@ -0,0 +1,38 @@
+package syntax
+
+// NewList creates a Prolog list of terms, '.'(T1, '.'(T2, ... [])).
+func NewList(terms []Term) Term {
+	list := EmptyList
+	for i := len(terms) - 1; i >= 0; i-- {
+		list = NewCompound(".", terms[i], list)
+	}
+	return list
+}
+
+// ListToSlice returns the elements of a proper list, following any bound
+// variables. The error is a PrologError holding an instantiation error for
+// partial lists, such as '[a|T]', and a type error for terms which aren't
+// lists, including cyclic lists such as the value of L after 'L = [a|L]'.
+func ListToSlice(t Term) ([]Term, error) {
+	var terms []Term
+	// cycles are detected using Brent's algorithm, the cell saved is
+	// compared with the following ones, and replaced after each power of
+	// two cells
+	var saved Term
+	power, n := 1, 0
+	for l := deref(t); l != EmptyList; {
+		if _, ok := l.(*Variable); ok {
+			return nil, &PrologError{Term: InstantiationErrorTerm()}
+		}
+		c, ok := l.(*Compound)
+		if !ok || c.functor != "." || len(c.args) != 2 || l == saved {
+			return nil, &PrologError{Term: TypeErrorTerm("list", t)}
+		}
+		if n++; n == power {
+			saved, power, n = l, power*2, 0
+		}
+		terms = append(terms, c.args[0])
+		l = deref(c.args[1])
+	}
+	return terms, nil
+}
@@ -0,0 +1,85 @@
+package syntax
+
+import "testing"
+
+func TestListToSlice(t *testing.T) {
+	a, b, c := Atom("a"), Atom("b"), Atom("c")
+	list := NewList([]Term{a, b, c})
+	exp := NewCompound(".", a, NewCompound(".", b, NewCompound(".", c, EmptyList)))
+	if Compare(list, exp) != 0 {
+		t.Errorf("expected %s got %s", exp, list)
+	}
+	if NewList(nil) != EmptyList {
+		t.Errorf("expected an empty list, got %s", NewList(nil))
+	}
+
+	x := NewVariable("X")
+	x.Unify(NewList([]Term{b, c}))
+	tests := []struct {
+		list Term
+		exp  []Term
+	}{
+		{list, []Term{a, b, c}},
+		{EmptyList, nil},
+		{NewCompound(".", a, x), []Term{a, b, c}},
+		{x, []Term{b, c}},
+	}
+	for _, test := range tests {
+		terms, err := ListToSlice(test.list)
+		if err != nil {
+			t.Errorf("%s: %v", test.list, err)
+			continue
+		}
+		if len(terms) != len(test.exp) {
+			t.Errorf("%s: expected %s got %s", test.list, test.exp, terms)
+			continue
+		}
+		for i := range terms {
+			if Compare(terms[i], test.exp[i]) != 0 {
+				t.Errorf("%s: expected %s got %s", test.list, test.exp, terms)
+				break
+			}
+		}
+	}
+
+	errTests := []struct {
+		list Term
+		exp  Term
+	}{
+		{NewCompound(".", a, NewVariable("T")), InstantiationErrorTerm()},
+		{NewVariable("L"), InstantiationErrorTerm()},
+		{a, TypeErrorTerm("list", a)},
+		{NewCompound(".", a, b), TypeErrorTerm("list", NewCompound(".", a, b))},
+		{NewCompound("f", a, EmptyList), TypeErrorTerm("list", NewCompound("f", a, EmptyList))},
+	}
+	for _, test := range errTests {
+		_, err := ListToSlice(test.list)
+		e, ok := err.(*PrologError)
+		if !ok {
+			t.Errorf("%s: expected %s, got %v", test.list, test.exp, err)
+			continue
+		}
+		if Compare(e.Term.(*Compound).args[0], test.exp.(*Compound).args[0]) != 0 {
+			t.Errorf("%s: expected %s, got %s", test.list, test.exp, e.Term)
+		}
+	}
+}
+
+func TestListToSliceCyclic(t *testing.T) {
+	// L = [a|L], and [x, y|T] where T = [a, b, c|T]
+	l := NewVariable("L")
+	l.Unify(NewCompound(".", Atom("a"), l))
+	tail := NewVariable("T")
+	tail.Unify(NewCompound(".", Atom("a"), NewCompound(".", Atom("b"), NewCompound(".", Atom("c"), tail))))
+	for _, list := range []Term{l, NewCompound(".", Atom("x"), NewCompound(".", Atom("y"), tail))} {
+		_, err := ListToSlice(list)
+		e, ok := err.(*PrologError)
+		if !ok {
+			t.Errorf("expected a type error, got %v", err)
+			continue
+		}
+		if formal := e.Term.(*Compound).args[0].(*Compound); formal.functor != "type_error" || formal.args[0] != Atom("list") {
+			t.Errorf("expected a type error, got %s", formal.functor)
+		}
+	}
+}
@@ -1,72 +1,637 @@
 package syntax
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
-type TypeErr struct {
-	Exp  string
+// PrologError is an error holding a Prolog term, raised by throw/1. If the
+// term isn't caught by catch/3, the error is reported by Results.Err.
+//
+// Errors raised by builtins hold ISO error terms of the form
+// 'error(Formal, Context)', see TypeErrorTerm and the other constructors.
+type PrologError struct {
 	Term Term
 }
 
-func (err *TypeErr) Error() string {
-	return fmt.Sprintf("Type error: `%s` expected got `%s`", err.Exp, err.Term)
+func (err *PrologError) Error() string {
+	return fmt.Sprintf("Unhandled exception: %s", err.Term)
 }
 
+// isoError returns the term 'error(formal, _)'.
+func isoError(formal Term) *Compound {
+	return NewCompound("error", formal, NewVariable("_"))
+}
+
+// TypeErrorTerm returns the error raised when an argument isn't of the
+// expected type, such as "integer" or "callable".
+func TypeErrorTerm(expected string, culprit Term) *Compound {
+	return isoError(NewCompound("type_error", Atom(expected), culprit))
+}
+
+// InstantiationErrorTerm returns the error raised when an argument must be
+// bound, but is an unbound variable.
+func InstantiationErrorTerm() *Compound {
+	return isoError(Atom("instantiation_error"))
+}
+
+// UninstantiationErrorTerm returns the error raised when an argument must be
+// an unbound variable, but is bound.
+func UninstantiationErrorTerm(culprit Term) *Compound {
+	return isoError(NewCompound("uninstantiation_error", culprit))
+}
+
+// ExistenceErrorTerm returns the error raised when an object doesn't exist,
+// for example calling an unknown procedure.
+func ExistenceErrorTerm(objectType, culprit Term) *Compound {
+	return isoError(NewCompound("existence_error", objectType, culprit))
+}
+
+// PermissionErrorTerm returns the error raised when an operation isn't
+// permitted, for example modifying a builtin.
+func PermissionErrorTerm(op, type_, culprit Term) *Compound {
+	return isoError(NewCompound("permission_error", op, type_, culprit))
+}
+
+// DomainErrorTerm returns the error raised when an argument is of the correct
+// type, but its value is outside of the domain the predicate accepts.
+func DomainErrorTerm(domain string, culprit Term) *Compound {
+	return isoError(NewCompound("domain_error", Atom(domain), culprit))
+}
+
+// EvaluationErrorTerm returns the error raised when an arithmetic expression
+// can't be evaluated, such as "zero_divisor" or "undefined".
+func EvaluationErrorTerm(cause string) *Compound {
+	return isoError(NewCompound("evaluation_error", Atom(cause)))
+}
+
+// SyntaxErrorTerm returns the error raised when text can't be parsed as the
+// term it's expected to hold.
+func SyntaxErrorTerm(msg string) *Compound {
+	return isoError(NewCompound("syntax_error", Atom(msg)))
+}
+
+// ErrStepLimitExceeded is reported by Results.Err when a query created by
+// QueryWithLimit exceeds its limit.
+var ErrStepLimitExceeded = errors.New("syntax: step limit exceeded")
+
+// ErrDepthLimitExceeded is reported by Results.Err when a query created by
+// QueryWithDepth exceeds its limit.
+var ErrDepthLimitExceeded = errors.New("syntax: depth limit exceeded")
+
 type sig struct {
 	functor Atom
 	nArgs   int
 }
 
-// Prog represents a Prolog program, a list of clauses
+// Prog represents a Prolog program, a list of clauses. It's safe to evaluate
+// queries of the same program in multiple goroutines, and to add or remove
+// clauses while they're being evaluated.
+//
+// The Prog passed to builtins is a view of the program which also holds the
+// state of the query calling them. Queries evaluated by the builtin with it,
+// such as the goal of findall/3, share that state, so they stop when the
+// query calling them does.
 type Prog struct {
-	running bool
+	*program
+
+	// query is the state of the query evaluating the builtin p is passed
+	// to, nil for a Prog returned by NewProg.
+	query *queryState
+}
+
+// program holds the clauses and other state shared by every query of a Prog.
+type program struct {
+	// stats is first so its counters are 64-bit aligned, as required by
+	// sync/atomic on 32-bit platforms.
+	stats counters
+
+	// clausesMu guards clauses, index, spies and abolished. Queries hold a
+	// read lock while selecting the clauses a goal may match, but not while
+	// evaluating them.
+	clausesMu sync.RWMutex
+
+	// txMu is held by a Transaction while it runs, and by changes to the
+	// clauses made outside of it, so a transaction which is rolled back
+	// never undoes the changes of other goroutines. It's acquired before
+	// clausesMu.
+	txMu sync.Mutex
 
 	clauses map[sig][]Clause
+	// index holds the clauses of each predicate grouped by their first
+	// argument. An index is built the first time a predicate is queried,
+	// and dropped when a clause is removed or added to the beginning of the
+	// predicate.
+	index map[sig]*argIndex
+
+	// spies holds the hooks registered by Spy.
+	spies map[sig]SpyHook
+
+	// abolished holds the predicates removed by Abolish which haven't been
+	// defined again. Calling them is an existence error.
+	abolished map[sig]bool
+
+	mu      sync.Mutex    // guards globals, flags, input and outputs
+	globals map[Atom]Term // values stored by SetGlobal
+	flags   map[Atom]Term // values stored by UpdateFlag
+
+	input       io.Reader   // the current input, see SetInput
+	inputReader interface{} // the reader created by InputReader for input
+	output      io.Writer   // the default output, see SetOutput
+	outputs     []io.Writer // the stack of outputs of every query, see PushOutput
 }
 
 func NewProg(caluses ...Clause) *Prog {
-	prog := Prog{
-		clauses: make(map[sig][]Clause),
-	}
+	prog := &Prog{program: &program{
+		clauses:   make(map[sig][]Clause),
+		index:     make(map[sig]*argIndex),
+		spies:     make(map[sig]SpyHook),
+		abolished: make(map[sig]bool),
+		globals:   make(map[Atom]Term),
+		flags:     make(map[Atom]Term),
+	}}
 	for _, caluse := range caluses {
 		prog.Add(caluse)
 	}
-	return &prog
+	return prog
 }
 
-// Add adds a clause to the list of clauses held by the program.
-// It should not be called during the evaluation of a query.
+// Add adds a clause to the end of the list of clauses held by the program.
+//
+// Builtins such as assertz may call Add during the evaluation of a query, and
+// it may be called concurrently with queries evaluated by other goroutines.
+// Goals which are already being evaluated don't see the new clause.
 func (p *Prog) Add(clause Clause) {
 	if clause == nil {
 		panic("syntax: clause cannot be nil")
 	}
 	functor, nArgs := clause.Signature()
 	s := sig{functor, nArgs}
+	defer p.lockTx()()
+	p.clausesMu.Lock()
+	defer p.clausesMu.Unlock()
 	p.clauses[s] = append(p.clauses[s], clause)
+	delete(p.abolished, s)
+	if idx := p.index[s]; idx != nil {
+		idx.add(clause)
+	}
 }
 
-// match returns an ordered list of all clauses with signatures that match c.
-// Clause is read only. The caller should not alter the values of the slice.
-func (p *Prog) match(c Clause) []Clause {
+// AddFirst adds a clause to the beginning of the list of clauses held by the
+// program. Like Add, it may be called during the evaluation of a query.
+func (p *Prog) AddFirst(clause Clause) {
+	if clause == nil {
+		panic("syntax: clause cannot be nil")
+	}
+	functor, nArgs := clause.Signature()
+	s := sig{functor, nArgs}
+	defer p.lockTx()()
+	p.clausesMu.Lock()
+	defer p.clausesMu.Unlock()
+	// create a new slice rather than altering the one seen by existing
+	// choicepoints
+	clauses := make([]Clause, 0, len(p.clauses[s])+1)
+	p.clauses[s] = append(append(clauses, clause), p.clauses[s]...)
+	delete(p.index, s)
+	delete(p.abolished, s)
+}
+
+// Transaction calls fn, which may add and remove clauses of p. If fn returns
+// an error or panics, the clauses of p are restored to the state they had
+// before fn was called and the error is returned, or the panic continues.
+//
+// fn must make its changes through the Prog it's passed, including by
+// evaluating queries of it. Other changes, such as those made by other
+// goroutines, wait until the transaction ends, so they're never undone by
+// it. Queries evaluated meanwhile see the changes made by fn.
+func (p *Prog) Transaction(fn func(p *Prog) error) (err error) {
+	defer p.lockTx()()
+
+	p.clausesMu.RLock()
+	clauses := make(map[sig][]Clause, len(p.clauses))
+	for s, c := range p.clauses {
+		// the slices are never altered, only replaced or appended to
+		clauses[s] = c[:len(c):len(c)]
+	}
+	abolished := make(map[sig]bool, len(p.abolished))
+	for s := range p.abolished {
+		abolished[s] = true
+	}
+	p.clausesMu.RUnlock()
+
+	rollback := func() {
+		p.clausesMu.Lock()
+		defer p.clausesMu.Unlock()
+		p.clauses, p.abolished = clauses, abolished
+		p.index = make(map[sig]*argIndex)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			rollback()
+			panic(r)
+		}
+	}()
+
+	q := p.newQuery()
+	q.tx = true
+	if err = fn(&Prog{program: p.program, query: q}); err != nil {
+		rollback()
+	}
+	return err
+}
+
+// lockTx acquires txMu unless p is being changed by a Transaction, returning
+// a function which releases it.
+func (p *Prog) lockTx() (unlock func()) {
+	for q := p.query; q != nil; q = q.parent {
+		if q.tx {
+			return func() {}
+		}
+	}
+	p.txMu.Lock()
+	return p.txMu.Unlock
+}
+
+// SpyHook is called as goals of a spied predicate pass through the ports of
+// the Prolog box model: "call" when the goal is first evaluated, "exit" when
+// it succeeds, "redo" when it's backtracked into and "fail" when it has no
+// more solutions.
+type SpyHook func(event string, goal *Compound)
+
+// Spy registers a hook which observes the evaluation of the predicate with
+// the given signature, replacing any hook already registered for it. The
+// hook is passed the goal being evaluated, with the bindings it holds at that
+// port. It must not alter the goal.
+//
+// Like other goals, a spied goal's choicepoint is discarded once it has no
+// alternatives left, so after its last solution backtracking doesn't report
+// its "redo" or "fail" ports.
+func (p *Prog) Spy(functor Atom, nArgs int, hook SpyHook) {
+	p.clausesMu.Lock()
+	defer p.clausesMu.Unlock()
+	p.spies[sig{functor, nArgs}] = hook
+}
+
+// Nospy removes the hook registered by Spy for the predicate with the given
+// signature. Goals which are already being evaluated still call the hook.
+func (p *Prog) Nospy(functor Atom, nArgs int) {
+	p.clausesMu.Lock()
+	defer p.clausesMu.Unlock()
+	delete(p.spies, sig{functor, nArgs})
+}
+
+// SetGlobal stores a copy of value under name, replacing any value already
+// stored. Unlike variable bindings, global values aren't undone when a query
+// backtracks. It's safe to call SetGlobal concurrently with queries.
+func (p *Prog) SetGlobal(name Atom, value Term) {
+	value = Copy(value)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.globals[name] = value
+}
+
+// Global returns a copy of the value stored under name by SetGlobal, false
+// if no value has been stored.
+func (p *Prog) Global(name Atom) (Term, bool) {
+	p.mu.Lock()
+	value, ok := p.globals[name]
+	p.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return Copy(value), true
+}
+
+// UpdateFlag atomically replaces the value of the flag name with the value
+// returned by update, which is called with the flag's current value. Flags
+// start as Integer(0). If update returns nil or an error, the flag keeps its
+// value.
+//
+// Flags are global like the values stored by SetGlobal, but are held
+// separately and intended for numeric counters.
+func (p *Prog) UpdateFlag(name Atom, update func(old Term) (Term, error)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old, ok := p.flags[name]
+	if !ok {
+		old = Integer(0)
+	}
+	value, err := update(old)
+	if err != nil || value == nil {
+		return err
+	}
+	p.flags[name] = Copy(value)
+	return nil
+}
+
+// SetInput sets the current input, which is read by predicates such as
+// read/1. The default input is os.Stdin.
+func (p *Prog) SetInput(r io.Reader) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.input, p.inputReader = r, nil
+}
+
+// InputReader returns a reader of the current input, such as a parser. The
+// reader is created by calling newReader the first time InputReader is
+// called after SetInput, and then returned by later calls. This lets a reader
+// which buffers its input be shared by every predicate reading the input.
+func (p *Prog) InputReader(newReader func(r io.Reader) interface{}) interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inputReader == nil {
+		r := p.input
+		if r == nil {
+			r = os.Stdin
+		}
+		p.inputReader = newReader(r)
+	}
+	return p.inputReader
+}
+
+// SetOutput sets the default output, which is written to by predicates such
+// as write/1 unless redirected by PushOutput. The default output is
+// os.Stdout.
+func (p *Prog) SetOutput(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.output = w
+}
+
+// PushOutput makes w the current output until it's removed by PopOutput, so
+// output can be temporarily redirected, such as by with_output_to/2.
+//
+// If p was passed to a builtin, only the output of the query calling the
+// builtin and the queries it evaluates is redirected, so other queries
+// evaluated concurrently aren't affected. Otherwise the output of every
+// query of p is redirected.
+func (p *Prog) PushOutput(w io.Writer) {
+	if p.query != nil {
+		p.query.outputs = append(p.query.outputs, w)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.outputs = append(p.outputs, w)
+}
+
+// PopOutput removes the current output added by PushOutput, restoring the
+// output it replaced.
+func (p *Prog) PopOutput() {
+	if q := p.query; q != nil {
+		if len(q.outputs) > 0 {
+			q.outputs = q.outputs[:len(q.outputs)-1]
+		}
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.outputs) > 0 {
+		p.outputs = p.outputs[:len(p.outputs)-1]
+	}
+}
+
+// Output returns the current output: the last output added by PushOutput,
+// or the default output set by SetOutput if it hasn't been redirected.
+func (p *Prog) Output() io.Writer {
+	for q := p.query; q != nil; q = q.parent {
+		if len(q.outputs) > 0 {
+			return q.outputs[len(q.outputs)-1]
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.outputs) > 0 {
+		return p.outputs[len(p.outputs)-1]
+	}
+	if p.output == nil {
+		return os.Stdout
+	}
+	return p.output
+}
+
+// ListSignatures returns the signatures of all predicates defined by the
+// program, formatted as 'functor/arity' and sorted lexicographically.
+func (p *Prog) ListSignatures() []string {
+	p.clausesMu.RLock()
+	defer p.clausesMu.RUnlock()
+	sigs := make([]string, 0, len(p.clauses))
+	for s := range p.clauses {
+		sigs = append(sigs, fmt.Sprintf("%s/%d", s.functor, s.nArgs))
+	}
+	sort.Strings(sigs)
+	return sigs
+}
+
+// ClauseCount returns the number of clauses of the predicate with the given
+// signature.
+func (p *Prog) ClauseCount(functor Atom, nArgs int) int {
+	p.clausesMu.RLock()
+	defer p.clausesMu.RUnlock()
+	return len(p.clauses[sig{functor, nArgs}])
+}
+
+// Clauses returns the clauses of the predicate with the given signature, in
+// the order they're evaluated.
+func (p *Prog) Clauses(functor Atom, nArgs int) []Clause {
+	p.clausesMu.RLock()
+	defer p.clausesMu.RUnlock()
+	clauses := p.clauses[sig{functor, nArgs}]
+	cp := make([]Clause, len(clauses))
+	copy(cp, clauses)
+	return cp
+}
+
+// Remove removes all clauses of the predicate with the given signature, so the
+// predicate is no longer defined by the program.
+//
+// Like Add, it may be called during the evaluation of a query. Goals which
+// are already being evaluated still see the removed clauses.
+func (p *Prog) Remove(functor Atom, nArgs int) {
+	defer p.lockTx()()
+	p.clausesMu.Lock()
+	defer p.clausesMu.Unlock()
+	delete(p.clauses, sig{functor, nArgs})
+	delete(p.index, sig{functor, nArgs})
+}
+
+// Abolish is like Remove, but also makes calling the predicate an existence
+// error until a clause is added for it again. Goals calling predicates which
+// have never been defined simply fail.
+func (p *Prog) Abolish(functor Atom, nArgs int) {
+	s := sig{functor, nArgs}
+	defer p.lockTx()()
+	p.clausesMu.Lock()
+	defer p.clausesMu.Unlock()
+	delete(p.clauses, s)
+	delete(p.index, s)
+	p.abolished[s] = true
+}
+
+// RemoveClause removes a clause from the program, returning false if the
+// clause isn't held by the program. Clauses are compared by identity, so c
+// should be a value returned by Clauses.
+//
+// Like Add, it may be called during the evaluation of a query. Goals which
+// are already being evaluated still see the removed clause.
+func (p *Prog) RemoveClause(c Clause) bool {
 	functor, nArgs := c.Signature()
 	s := sig{functor, nArgs}
-	if clauses := p.clauses[s]; clauses != nil {
+	defer p.lockTx()()
+	p.clausesMu.Lock()
+	defer p.clausesMu.Unlock()
+	for i, clause := range p.clauses[s] {
+		if clause != c {
+			continue
+		}
+		// create a new slice rather than altering the one seen by existing
+		// choicepoints
+		clauses := make([]Clause, 0, len(p.clauses[s])-1)
+		clauses = append(clauses, p.clauses[s][:i]...)
+		p.clauses[s] = append(clauses, p.clauses[s][i+1:]...)
+		delete(p.index, s)
+		return true
+	}
+	return false
+}
+
+// match returns an ordered list of the clauses which may match c. If the
+// first argument of c is a constant, clauses with a different constant as
+// their first argument are omitted. The caller should not alter the values
+// of the slice.
+func (p *Prog) match(c *Compound) []Clause {
+	s := sig{c.functor, len(c.args)}
+	p.clausesMu.RLock()
+	defer p.clausesMu.RUnlock()
+	clauses := p.clauses[s]
+	if len(c.args) > 0 && len(clauses) > 1 {
+		idx := p.index[s]
+		if idx == nil {
+			// upgrade to a write lock to build the index, the clauses may
+			// change while no lock is held
+			p.clausesMu.RUnlock()
+			p.clausesMu.Lock()
+			if idx = p.index[s]; idx == nil && len(p.clauses[s]) > 1 {
+				idx = newArgIndex(p.clauses[s])
+				p.index[s] = idx
+			}
+			p.clausesMu.Unlock()
+			p.clausesMu.RLock()
+			clauses, idx = p.clauses[s], p.index[s]
+		}
+		if idx != nil {
+			if clauses, ok := idx.lookup(c.args[0]); ok {
+				return clauses
+			}
+		}
+	}
+	if clauses != nil {
 		return clauses[:]
 	}
 	return []Clause{}
 }
 
+// queryState is the state of a query which is shared with the queries its
+// builtins evaluate.
+type queryState struct {
+	// parent is the state of the query evaluating this one, if it was
+	// created by a builtin with its own context or limits.
+	parent *queryState
+
+	ctx context.Context // if non-nil, evaluation stops when ctx is done
+
+	// maxSteps is the number of steps evaluation may take, unlimited if not
+	// positive. steps counts the steps taken so far.
+	maxSteps int
+	steps    int
+
+	// maxDepth is the number of choicepoints evaluation may hold at once,
+	// unlimited if not positive. depth is the number held by the queries
+	// enclosing the one whose builtin is being called.
+	maxDepth int
+	depth    int
+
+	outputs []io.Writer // the stack of outputs, see PushOutput
+
+	tx bool // set for the queries of a Transaction, see lockTx
+}
+
+// newQuery returns the state of a query of p which has its own context or
+// limits. If p is passed to a builtin, the query is still bound by those of
+// the query calling the builtin.
+func (p *Prog) newQuery() *queryState {
+	q := &queryState{parent: p.query}
+	if p.query != nil {
+		q.depth = p.query.depth
+	}
+	return q
+}
+
+// step counts a step of evaluation, returning an error if the evaluation of
+// q or of any query enclosing it must stop.
+func (q *queryState) step() error {
+	for s := q; s != nil; s = s.parent {
+		if s.ctx != nil {
+			select {
+			case <-s.ctx.Done():
+				return s.ctx.Err()
+			default:
+			}
+		}
+		if s.maxSteps > 0 && s.steps >= s.maxSteps {
+			return ErrStepLimitExceeded
+		}
+	}
+	for s := q; s != nil; s = s.parent {
+		s.steps++
+	}
+	return nil
+}
+
+// checkDepth returns an error if depth exceeds the limit of q or of any
+// query enclosing it.
+func (q *queryState) checkDepth(depth int) error {
+	for s := q; s != nil; s = s.parent {
+		if s.maxDepth > 0 && depth > s.maxDepth {
+			return ErrDepthLimitExceeded
+		}
+	}
+	return nil
+}
+
 type Results struct {
-	p   *Prog
-	cp  *choicepoint
-	err error // sticky error
+	p    *Prog // a view of the program holding the query's state
+	cp   *choicepoint
+	vars []*Variable // variables of the query
+	err  error       // sticky error
+
+	// depth is the number of choicepoints held by the queries enclosing
+	// this one when it was created.
+	depth int
+
+	// state records the values of the query's variables before evaluation,
+	// so they can be restored when the results are closed.
+	state map[*Variable]varState
+
+	// solved is set if the query was solved before any choicepoints were
+	// created, for example a query consisting only of a cut.
+	solved bool
 }
 
 // Close attempts to help the garbage collector by relinquish pointers to
-// choicepoints.
+// choicepoints. It also restores the query's variables to the state they had
+// before the query was evaluated.
 func (r *Results) Close() {
+	for v, s := range r.state {
+		v.restore(s)
+	}
+	r.state = nil
 	r.p = nil
 	r.cp = nil
 	if r.err == nil {
@@ -80,30 +645,55 @@ func (r *Results) Next() bool {
 	if r.err != nil {
 		return false
 	}
+	if r.solved {
+		r.solved = false
+		return true
+	}
 
 	for r.cp != nil {
+		if err := r.p.query.step(); err != nil {
+			r.err = err
+			return false
+		}
+
+		if r.cp.spy != nil && r.cp.entered {
+			r.cp.resetVars()
+			r.cp.spy("redo", r.cp.fact)
+		}
+		r.cp.entered = true
 
-		// advance the choicepoint
-		compound, match := r.cp.next()
+		// advance the choicepoint, queries evaluated by its builtins are
+		// nested within it
+		r.p.query.depth = r.depth + r.cp.depth
+		compound, match, err := r.cp.next(r.p)
+		if err != nil {
+			r.err = err
+			return false
+		}
 		if !match {
+			if r.cp.spy != nil {
+				r.cp.resetVars()
+				r.cp.spy("fail", r.cp.fact)
+			}
 			// if a match is not found, backtrack
 			r.cp = r.cp.backtrack
+			atomic.AddInt64(&r.p.stats.backtracks, 1)
+			atomic.AddInt64(&r.p.stats.popped, 1)
 			continue
 		}
 
-		// evaluate cuts and nil the backtracks
-		for compound != nil && compound.head == Cut {
-			r.cp.backtrack = nil
-			compound = compound.tail
+		// a choicepoint with no alternatives left is replaced by the one
+		// for its continuation rather than kept on the stack, so
+		// deterministic recursion runs in constant space
+		if r.cp.exhausted() {
+			r.cp = r.cp.backtrack
+			atomic.AddInt64(&r.p.stats.popped, 1)
 		}
 
-		if compound == nil {
+		if r.push(compound) {
 			// there are no more terms to evaluate, a match has been found
 			return true
 		}
-
-		// construct a new choicepoint with the remaining compound to evaluate
-		r.cp, r.err = r.p.choicepoint(compound, r.cp)
 		if r.err != nil {
 			return false
 		}
@@ -111,18 +701,194 @@ func (r *Results) Next() bool {
 	return false
 }
 
+// push evaluates any cuts and exit ports at the start of a goal, then
+// constructs a new choicepoint for the remaining goal. It returns true if no
+// terms remain to be evaluated.
+func (r *Results) push(c *Goal) bool {
+loop:
+	for c != nil {
+		switch t := c.head.(type) {
+		case *cutBarrier:
+			r.cut(t.cp)
+		case *exitPort:
+			t.spy("exit", t.fact)
+		default:
+			break loop
+		}
+		c = c.tail
+	}
+	if c == nil {
+		return true
+	}
+	r.cp, r.err = r.p.choicepoint(c, r.cp)
+	if r.err == nil {
+		atomic.AddInt64(&r.p.stats.pushed, 1)
+	}
+	if r.err == nil && r.cp.spy != nil {
+		r.cp.spy("call", r.cp.fact)
+	}
+	if r.err == nil {
+		r.err = r.p.query.checkDepth(r.depth + r.cp.depth)
+	}
+	return false
+}
+
+// cut discards all choicepoints created since cp, as well as the remaining
+// clauses of cp. Since cp has no alternatives left it's discarded too. If cp
+// is nil, all choicepoints are discarded.
+func (r *Results) cut(cp *choicepoint) {
+	var stop *choicepoint
+	if cp != nil {
+		stop = cp.backtrack
+	}
+	var n int64
+	for c := r.cp; c != nil && c != stop; c = c.backtrack {
+		n++
+	}
+	atomic.AddInt64(&r.p.stats.popped, n)
+	if cp == nil {
+		r.cp = nil
+		return
+	}
+	cp.clauses = nil
+	cp.generate = nil
+	r.cp = cp.backtrack
+}
+
 // Err returns the results stick error.
 func (r *Results) Err() error { return r.err }
 
+// bindings returns the current values of the query's bound variables.
+func (r *Results) bindings() map[*Variable]Term {
+	b := make(map[*Variable]Term, len(r.vars))
+	for _, v := range r.vars {
+		if val := v.Value(); val != nil {
+			b[v] = resolve(val)
+		}
+	}
+	return b
+}
+
+// All evaluates the query until no more matches are possible, returning the
+// bindings of the query's variables for each solution. Unbound variables are
+// omitted from the bindings. The results are closed before All returns.
+func (r *Results) All() ([]map[*Variable]Term, error) {
+	var all []map[*Variable]Term
+	for r.Next() {
+		all = append(all, r.bindings())
+	}
+	err := r.Err()
+	r.Close()
+	return all, err
+}
+
+// First evaluates the query until its first solution, returning the bindings
+// of the query's variables. If the query has no solutions, matches is false.
+// The results are closed before First returns.
+func (r *Results) First() (bindings map[*Variable]Term, matches bool, err error) {
+	if r.Next() {
+		bindings, matches = r.bindings(), true
+	}
+	err = r.Err()
+	r.Close()
+	return bindings, matches, err
+}
+
+// resolve returns a copy of t with all bound variables replaced by their
+// values, so the term is unaffected by variables later being reset, see
+// Substitute.
+func resolve(t Term) Term {
+	return Substitute(t, nil)
+}
+
+// Query evaluates a goal against the program. If p was passed to a builtin,
+// the query shares the state of the query calling the builtin, see Prog.
 func (p *Prog) Query(c *Goal) *Results {
-	choicepoint, err := p.choicepoint(c, nil)
-	if err != nil {
-		return &Results{err: err}
+	q := p.query
+	if q == nil {
+		q = p.newQuery()
+	}
+	return p.evaluate(c, q)
+}
+
+// evaluate returns the results of a query with the state q.
+func (p *Prog) evaluate(c *Goal, q *queryState) *Results {
+	if p.query != q {
+		p = &Prog{program: p.program, query: q}
 	}
-	return &Results{
-		p:  p,
-		cp: choicepoint,
+	var vars []*Variable
+	seen := map[*Variable]bool{}
+	state := map[*Variable]varState{}
+	for g := c; g != nil; g = g.tail {
+		Walk(g.head, func(t Term) bool {
+			v, ok := t.(*Variable)
+			if !ok {
+				return true
+			}
+			if !seen[v] {
+				seen[v] = true
+				vars = append(vars, v)
+			}
+			snapshot(state, v)
+			return false
+		})
 	}
+	r := &Results{p: p, vars: vars, state: state, depth: q.depth}
+	// cuts in the query itself discard all choicepoints
+	r.solved = r.push(withBarriers(c, nil, nil))
+	return r
+}
+
+// First evaluates a query until its first solution, returning the bindings of
+// the query's variables. If the query has no solutions, matches is false.
+// Panics caused by malformed goals, such as one holding a nil term, are
+// returned as errors.
+func (p *Prog) First(c *Goal) (bindings map[*Variable]Term, matches bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			bindings, matches, err = nil, false, fmt.Errorf("syntax: evaluating query: %v", r)
+		}
+	}()
+	return p.Query(c).First()
+}
+
+// QueryContext is like Query but stops evaluation once ctx is done. When that
+// happens Next returns false and Err reports the context's error. Queries
+// evaluated by builtins, such as findall/3 and catch/3, stop too.
+func (p *Prog) QueryContext(ctx context.Context, c *Goal) *Results {
+	q := p.newQuery()
+	q.ctx = ctx
+	return p.evaluate(c, q)
+}
+
+// QueryWithLimit is like Query but stops evaluation after maxSteps steps,
+// where each attempt to match a goal against the program is one step. When
+// that happens Next returns false and Err reports ErrStepLimitExceeded. A
+// limit which isn't positive means evaluation is unlimited.
+//
+// The limit applies across all calls to Next. The steps of queries evaluated
+// by builtins, such as findall/3, are counted too.
+func (p *Prog) QueryWithLimit(c *Goal, maxSteps int) *Results {
+	q := p.newQuery()
+	q.maxSteps = maxSteps
+	return p.evaluate(c, q)
+}
+
+// QueryWithDepth is like Query but stops evaluation when the stack of
+// choicepoints grows beyond maxDepth, for example when a predicate recurses
+// too deeply. When that happens Next returns false and Err reports
+// ErrDepthLimitExceeded. A limit which isn't positive means the depth is
+// unlimited.
+//
+// Every goal being evaluated holds a choicepoint until the query is
+// backtracked over or cut, so the depth reached is at least the number of
+// goals evaluated to find a solution. The choicepoints of queries evaluated
+// by builtins, such as findall/3, are counted along with those of the goal
+// calling the builtin.
+func (p *Prog) QueryWithDepth(c *Goal, maxDepth int) *Results {
+	q := p.newQuery()
+	q.maxDepth = maxDepth
+	return p.evaluate(c, q)
 }
 
 // choicepoint returns a new choicepoint pointing to the list of rules.
@@ -135,28 +901,63 @@ func (p *Prog) choicepoint(c *Goal, backtrack *choicepoint) (*choicepoint, error
 	// evaluate the head of the compound for a callable term
 	fact := c.head.Callable()
 	if fact == nil {
-		return nil, &TypeErr{"callable", c.head}
+		if v, ok := c.head.(*Variable); ok && v.Value() == nil {
+			return nil, &PrologError{InstantiationErrorTerm()}
+		}
+		return nil, &PrologError{TypeErrorTerm("callable", c.head)}
+	}
+
+	s := sig{fact.functor, len(fact.args)}
+	p.clausesMu.RLock()
+	abolished, spy := p.abolished[s], p.spies[s]
+	p.clausesMu.RUnlock()
+	if abolished {
+		pi := NewCompound("/", s.functor, Integer(s.nArgs))
+		return nil, &PrologError{ExistenceErrorTerm(Atom("procedure"), pi)}
 	}
 
-	state := map[*Variable]Term{}
-	visitVars(c, func(v *Variable) { state[v] = v.value })
+	state := map[*Variable]varState{}
+	for g := c; g != nil; g = g.tail {
+		snapshot(state, g.head)
+	}
+
+	depth := 1
+	if backtrack != nil {
+		depth = backtrack.depth + 1
+	}
 
 	return &choicepoint{
 		backtrack: backtrack,
+		depth:     depth,
 		fact:      fact,
 		remaining: c.tail,
 		clauses:   p.match(fact),
 		state:     state,
+		spy:       spy,
 	}, nil
 }
 
 // choicepoint
 type choicepoint struct {
-	backtrack *choicepoint       // the choicepoint to backtrack to
-	fact      *Compound          // fact to match
-	remaining *Goal              // the remaining
-	clauses   []Clause           // the set of matching clauses
-	state     map[*Variable]Term // the beginning state of all variables
+	backtrack *choicepoint           // the choicepoint to backtrack to
+	depth     int                    // the number of choicepoints up to and including this one
+	fact      *Compound              // fact to match
+	remaining *Goal                  // the remaining
+	clauses   []Clause               // the set of matching clauses
+	state     map[*Variable]varState // the beginning state of all variables
+
+	// generate returns the next match of a Generator, nil if no generator
+	// is active.
+	generate func() (*Goal, bool, error)
+
+	spy     SpyHook // the hook observing the goal, if any
+	entered bool    // set once the goal has been evaluated
+}
+
+// exhausted reports whether the choicepoint has no clauses or generator
+// left to try.
+func (cp *choicepoint) exhausted() bool {
+	return len(cp.clauses) == 0 && cp.generate == nil
 }
 
 func (cp *choicepoint) pop() Clause {
@@ -172,52 +973,165 @@ func (cp *choicepoint) pop() Clause {
 // remaining to evaluate.
 // In the event of a rule match, the body is prepended to the choicepoints
 // existing remaining compound.
-func (cp *choicepoint) next() (c *Goal, match bool) {
-
-	for clause := cp.pop(); clause != nil; clause = cp.pop() {
-		cp.resetVars()
+func (cp *choicepoint) next(p *Prog) (c *Goal, match bool, err error) {
 
-		result, matches := clause.Call(cp.fact.args)
-		if !matches {
-			continue
+	for {
+		var result *Goal
+		var matches bool
+		var err error
+		if cp.generate != nil {
+			// retry the active generator before moving on to the next clause
+			cp.resetVars()
+			result, matches, err = cp.generate()
+			if !matches {
+				cp.generate = nil
+			}
+		} else {
+			clause := cp.pop()
+			if clause == nil {
+				return nil, false, nil
+			}
+			if g, ok := clause.(Generator); ok {
+				cp.resetVars()
+				cp.generate = g.Generate(p, cp.fact.args)
+				continue
+			}
+			cp.resetVars()
+			result, matches, err = clause.Call(p, cp.fact.args)
 		}
-		if result == nil {
-			return cp.remaining, true
+		atomic.AddInt64(&p.stats.inferences, 1)
+		if err != nil {
+			return nil, false, err
 		}
-
-		// append remaining to result
-		tail := result
-		for tail.tail != nil {
-			tail = tail.tail
+		if matches {
+			// prepend the body to remaining, cuts in the body cut back to cp
+			remaining := cp.remaining
+			if cp.spy != nil {
+				remaining = &Goal{&exitPort{cp.spy, cp.fact}, remaining}
+			}
+			return cp.wakeup(withBarriers(result, cp, remaining)), true, nil
 		}
-		tail.tail = cp.remaining
-
-		return result, true
 	}
-	return nil, false
 }
 
-func (cp *choicepoint) resetVars() {
-	reset := func(v *Variable) { v.value = cp.state[v] }
-	visitVarsTerm(cp.fact, reset)
-	visitVars(cp.remaining, reset)
+// cutBarrier is a cut which has been bound to the choicepoint it cuts back to.
+// It's substituted for Cut when the body of a clause is evaluated, so a cut
+// only discards the alternatives created since its clause was selected.
+type cutBarrier struct {
+	cp *choicepoint
+}
+
+func (*cutBarrier) Unify(t2 Term) bool  { return false }
+func (*cutBarrier) Callable() *Compound { return nil }
+func (*cutBarrier) String() string      { return "!" }
+
+// exitPort marks the end of the body of a spied goal. The goal's exit port is
+// reported when the marker is reached. It doesn't refer to the goal's
+// choicepoint, so the choicepoint can be discarded before the marker is
+// reached.
+type exitPort struct {
+	spy  SpyHook
+	fact *Compound
 }
 
-func visitVars(c *Goal, fn func(v *Variable)) {
+func (*exitPort) Unify(t2 Term) bool  { return false }
+func (*exitPort) Callable() *Compound { return nil }
+func (*exitPort) String() string      { return "true" }
+
+// withBarriers returns a copy of c followed by tail, replacing each Cut with
+// a barrier which cuts back to cp. c itself is not altered, since it may be
+// owned by a clause.
+func withBarriers(c *Goal, cp *choicepoint, tail *Goal) *Goal {
 	if c == nil {
-		return
+		return tail
+	}
+	head := c.head
+	if head == Cut {
+		head = &cutBarrier{cp}
+	}
+	return &Goal{head, withBarriers(c.tail, cp, tail)}
+}
+
+// AttrUnifyHook is the predicate called when a variable with attributes is
+// bound. For each attribute, 'attr_unify_hook(Key, Attr, Value)' is evaluated
+// before the goal which bound the variable continues, where Value is the term
+// the variable was bound to. If a hook fails, so does the binding.
+//
+// Key is the module the attribute belongs to. It stands in for the module
+// qualification of SWI-Prolog's 'Module:attr_unify_hook(Attr, Value)', since
+// programs have no modules.
+//
+// Binding an attributed variable to a variable without attributes binds the
+// other variable instead, so no hook is called.
+const AttrUnifyHook Atom = "attr_unify_hook"
+
+// wakeup returns c preceded by the hooks of the attributed variables bound
+// by the last match of cp.
+func (cp *choicepoint) wakeup(c *Goal) *Goal {
+	var hooks []Term
+	seen := map[*Variable]bool{}
+	Walk(cp.fact, func(t Term) bool {
+		v, ok := t.(*Variable)
+		if !ok {
+			return true
+		}
+		if seen[v] {
+			return false
+		}
+		seen[v] = true
+		if s, ok := cp.state[v]; ok && s.value == nil && len(s.attrs) > 0 && v.value != nil {
+			keys := make([]string, 0, len(s.attrs))
+			for key := range s.attrs {
+				keys = append(keys, string(key))
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				hooks = append(hooks, NewCompound(AttrUnifyHook, Atom(key), s.attrs[Atom(key)], Deref(v)))
+			}
+		}
+		return true
+	})
+	for i := len(hooks) - 1; i >= 0; i-- {
+		c = &Goal{hooks[i], c}
 	}
-	visitVarsTerm(c.head, fn)
-	visitVars(c.tail, fn)
+	return c
+}
+
+func (cp *choicepoint) resetVars() {
+	for v, s := range cp.state {
+		v.restore(s)
+	}
+}
+
+// varState is the value and attributes of a variable at some point of the
+// evaluation of a query.
+type varState struct {
+	value Term
+	attrs map[Atom]Term
+}
+
+// restore resets a variable to a state recorded by snapshot.
+func (v *Variable) restore(s varState) {
+	v.value, v.attrs = s.value, s.attrs
 }
 
-func visitVarsTerm(t Term, fn func(v *Variable)) {
-	switch t := t.(type) {
-	case *Variable:
-		fn(t)
-	case *Compound:
-		for _, arg := range t.args {
-			visitVarsTerm(arg, fn)
+// snapshot records the states of the variables of t in state, along with
+// the states of all variables reachable through their values and attributes.
+func snapshot(state map[*Variable]varState, t Term) {
+	var visit func(t Term) bool
+	visit = func(t Term) bool {
+		v, ok := t.(*Variable)
+		if !ok {
+			return true
+		}
+		if _, ok := state[v]; ok {
+			return false
+		}
+		state[v] = varState{v.value, v.attrs}
+		for _, attr := range v.attrs {
+			Walk(attr, visit)
 		}
+		return true
 	}
+	Walk(t, visit)
 }
@@ -1,6 +1,12 @@
 package syntax
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestNewProgram(t *testing.T) {
 	_ = NewProg()
@@ -150,19 +156,22 @@ func TestChoicepoint(t *testing.T) {
 	}
 	x := NewVariable("X")
 	y := NewVariable("Y")
-	body, matches := f.Call([]Term{x, y})
-	if !matches {
+	p := NewProg(clauses...)
+	body, matches, err := f.Call(p, []Term{x, y})
+	if err != nil || !matches {
 		t.Fatalf("expected to match")
 		return
 	}
-	p := NewProg(clauses...)
 	cp, err := p.choicepoint(body, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	nMatches := 0
 	for {
-		comp, match := cp.next()
+		comp, match, err := cp.next(p)
+		if err != nil {
+			t.Fatal(err)
+		}
 		if !match {
 			break
 		}
@@ -175,7 +184,7 @@ func TestChoicepoint(t *testing.T) {
 		}
 		subMatches := 0
 		for {
-			if _, match := cp.next(); !match {
+			if _, match, err := cp.next(p); err != nil || !match {
 				break
 			}
 			subMatches++
@@ -190,3 +199,578 @@ func TestChoicepoint(t *testing.T) {
 		t.Fatalf("expected 2 matches got %d", nMatches)
 	}
 }
+
+func TestQueryContext(t *testing.T) {
+	p := NewProg(NewRule("loop", nil, NewGoal(Atom("loop"))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
+	defer cancel()
+
+	done := make(chan bool)
+	r := p.QueryContext(ctx, NewGoal(Atom("loop")))
+	go func() { done <- r.Next() }()
+
+	select {
+	case match := <-done:
+		if match {
+			t.Errorf("expected infinite loop not to match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("query was not cancelled")
+	}
+	if err := r.Err(); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestQueryWithLimit(t *testing.T) {
+	p := NewProg(
+		NewRule("loop", nil, NewGoal(Atom("loop"))),
+		NewCompound("likes", Atom("bob"), Atom("pizza")),
+		NewCompound("likes", Atom("bob"), Atom("beer")),
+	)
+
+	r := p.QueryWithLimit(NewGoal(Atom("loop")), 100)
+	if r.Next() {
+		t.Errorf("expected infinite loop not to match")
+	}
+	if err := r.Err(); err != ErrStepLimitExceeded {
+		t.Errorf("expected %v, got %v", ErrStepLimitExceeded, err)
+	}
+	if r.p.query.steps != 100 {
+		t.Errorf("expected 100 steps, got %d", r.p.query.steps)
+	}
+
+	for _, limit := range []int{0, -1, 3} {
+		x := NewVariable("X")
+		all, err := p.QueryWithLimit(NewGoal(NewCompound("likes", Atom("bob"), x)), limit).All()
+		if err != nil {
+			t.Errorf("limit %d: %v", limit, err)
+		}
+		if len(all) != 2 {
+			t.Errorf("limit %d: expected 2 solutions got %d", limit, len(all))
+		}
+	}
+
+	// the limit applies across calls to Next
+	x := NewVariable("X")
+	all, err := p.QueryWithLimit(NewGoal(NewCompound("likes", Atom("bob"), x)), 1).All()
+	if len(all) != 1 || err != ErrStepLimitExceeded {
+		t.Errorf("expected 1 solution then %v, got %d %v", ErrStepLimitExceeded, len(all), err)
+	}
+}
+
+func TestQueryWithDepth(t *testing.T) {
+	// the second rule leaves a choicepoint at each level of recursion
+	x := NewVariable("X")
+	p := NewProg(
+		NewCompound("nat", Integer(0)),
+		NewRule("nat", []Term{NewCompound("s", x)}, NewGoal(NewCompound("nat", x))),
+		NewRule("nat", []Term{NewCompound("s", x)}, NewGoal(NewCompound("nat", x))),
+	)
+	var n Term = Integer(0)
+	for i := 0; i < 20; i++ {
+		n = NewCompound("s", n)
+	}
+
+	r := p.QueryWithDepth(NewGoal(NewCompound("nat", n)), 10)
+	if r.Next() {
+		t.Errorf("expected depth limit to stop evaluation")
+	}
+	if err := r.Err(); err != ErrDepthLimitExceeded {
+		t.Errorf("expected %v, got %v", ErrDepthLimitExceeded, err)
+	}
+
+	for _, limit := range []int{0, 30} {
+		if _, ok, err := p.QueryWithDepth(NewGoal(NewCompound("nat", n)), limit).First(); !ok || err != nil {
+			t.Errorf("limit %d: expected a solution, got %t %v", limit, ok, err)
+		}
+	}
+}
+
+func TestLastCall(t *testing.T) {
+	x := NewVariable("X")
+	p := NewProg(
+		NewCompound("nat", Integer(0)),
+		NewRule("nat", []Term{NewCompound("s", x)}, NewGoal(NewCompound("nat", x))),
+		NewRule("count", []Term{NewCompound("s", x)}, NewGoal(Cut, NewCompound("count", x))),
+		NewRule("count", []Term{x}, NewGoal(NewCompound("=", x, Integer(0)))),
+		NewRule("=", []Term{x, x}, nil),
+	)
+	var n Term = Integer(0)
+	for i := 0; i < 1000; i++ {
+		n = NewCompound("s", n)
+	}
+
+	// deterministic recursion doesn't grow the stack of choicepoints
+	for _, g := range []Term{NewCompound("nat", n), NewCompound("count", n)} {
+		all, err := p.QueryWithDepth(NewGoal(g), 5).All()
+		if err != nil || len(all) != 1 {
+			t.Errorf("%s: expected 1 solution, got %d %v", g.(*Compound).functor, len(all), err)
+		}
+	}
+
+	// even if it's spied
+	exits := 0
+	p.Spy("nat", 1, func(event string, goal *Compound) {
+		if event == "exit" {
+			exits++
+		}
+	})
+	all, err := p.QueryWithDepth(NewGoal(NewCompound("nat", n)), 5).All()
+	if err != nil || len(all) != 1 {
+		t.Errorf("spied nat: expected 1 solution, got %d %v", len(all), err)
+	}
+	if exits != 1001 {
+		t.Errorf("spied nat: expected 1001 exits, got %d", exits)
+	}
+}
+
+func TestResultsAll(t *testing.T) {
+	p := NewProg(
+		NewCompound("likes", Atom("eric"), Atom("shoes")),
+		NewCompound("likes", Atom("bob"), Atom("pizza")),
+		NewCompound("likes", Atom("eric"), Atom("bubblegum")),
+		NewCompound("likes", Atom("bob"), Atom("beer")),
+	)
+	x := NewVariable("X")
+	all, err := p.Query(NewGoal(NewCompound("likes", Atom("bob"), x))).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []Term{Atom("pizza"), Atom("beer")}
+	if len(all) != len(exp) {
+		t.Fatalf("expected %d solutions, got %d: %v", len(exp), len(all), all)
+	}
+	for i, bindings := range all {
+		if len(bindings) != 1 || bindings[x] != exp[i] {
+			t.Errorf("solution %d, expected X = %s got %v", i, exp[i], bindings)
+		}
+	}
+
+	// a query with no solutions
+	all, err = p.Query(NewGoal(NewCompound("likes", Atom("alice"), x))).All()
+	if err != nil || len(all) != 0 {
+		t.Errorf("expected no solutions, got %v %v", all, err)
+	}
+}
+
+func TestResultsFirst(t *testing.T) {
+	p := NewProg(
+		NewCompound("likes", Atom("bob"), Atom("pizza")),
+		NewCompound("likes", Atom("bob"), Atom("beer")),
+	)
+	x := NewVariable("X")
+	r := p.Query(NewGoal(NewCompound("likes", Atom("bob"), x)))
+	bindings, matches, err := r.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches || bindings[x] != Atom("pizza") {
+		t.Errorf("expected X = pizza, got %v", bindings)
+	}
+	if r.Next() {
+		t.Errorf("expected results to be closed")
+	}
+
+	_, matches, err = p.Query(NewGoal(NewCompound("likes", Atom("alice"), x))).First()
+	if matches || err != nil {
+		t.Errorf("expected no match, got %t %v", matches, err)
+	}
+}
+
+func TestResultsCloseRestoresVars(t *testing.T) {
+	p := NewProg(NewCompound("likes", Atom("bob"), Atom("pizza")))
+	x := NewVariable("X")
+	r := p.Query(NewGoal(NewCompound("likes", Atom("bob"), x)))
+	if !r.Next() || x.Value() != Atom("pizza") {
+		t.Fatalf("expected X to be bound to pizza, got %s", x.Value())
+	}
+	r.Close()
+	if x.Value() != nil {
+		t.Errorf("expected X to be unbound after Close, got %s", x.Value())
+	}
+}
+
+func TestRemoveClause(t *testing.T) {
+	f1 := NewCompound("likes", Atom("bob"), Atom("pizza"))
+	f2 := NewCompound("likes", Atom("bob"), Atom("beer"))
+	p := NewProg(f1, f2)
+
+	// choicepoints created before a clause is removed still see it
+	x := NewVariable("X")
+	r := p.Query(NewGoal(NewCompound("likes", Atom("bob"), x)))
+	if !p.RemoveClause(f2) {
+		t.Fatalf("expected clause to be removed")
+	}
+	if p.RemoveClause(f2) {
+		t.Errorf("expected clause to already be removed")
+	}
+	all, err := r.All()
+	if err != nil || len(all) != 2 {
+		t.Errorf("expected 2 solutions, got %v %v", all, err)
+	}
+
+	clauses := p.Clauses("likes", 2)
+	if len(clauses) != 1 || clauses[0] != f1 {
+		t.Errorf("expected only %s to remain, got %v", f1, clauses)
+	}
+}
+
+// countTo is a Generator which unifies its argument with 1 through n.
+type countTo struct{ n int }
+
+func (c *countTo) Signature() (Atom, int) { return "count", 1 }
+
+func (c *countTo) Call(p *Prog, args []Term) (*Goal, bool, error) {
+	return c.Generate(p, args)()
+}
+
+func (c *countTo) Generate(p *Prog, args []Term) func() (*Goal, bool, error) {
+	i := 0
+	return func() (*Goal, bool, error) {
+		for i < c.n {
+			i++
+			if args[0].Unify(Integer(i)) {
+				return nil, true, nil
+			}
+		}
+		return nil, false, nil
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	x := NewVariable("X")
+	clauses := []Clause{
+		&countTo{3},
+		NewCompound("count", Integer(10)),
+		NewRule("first", []Term{x}, NewGoal(NewCompound("count", x), Cut)),
+	}
+	y := NewVariable("Y")
+	testQuery(t, clauses, NewGoal(NewCompound("count", y)), []varExp{
+		{y: Integer(1)}, {y: Integer(2)}, {y: Integer(3)}, {y: Integer(10)},
+	})
+	y = NewVariable("Y")
+	testQuery(t, clauses, NewGoal(NewCompound("count", Integer(2))), []varExp{{}})
+	testQuery(t, clauses, NewGoal(NewCompound("first", y)), []varExp{{y: Integer(1)}})
+}
+
+func TestProgFirst(t *testing.T) {
+	p := NewProg(NewCompound("likes", Atom("bob"), Atom("pizza")))
+	x := NewVariable("X")
+	bindings, ok, err := p.First(NewGoal(NewCompound("likes", Atom("bob"), x)))
+	if err != nil || !ok || bindings[x] != Atom("pizza") {
+		t.Errorf("expected X = pizza, got %v %t %v", bindings, ok, err)
+	}
+
+	if _, ok, err := p.First(NewGoal(NewCompound("likes", Atom("alice"), x))); ok || err != nil {
+		t.Errorf("expected no solutions, got %t %v", ok, err)
+	}
+	if _, _, err := p.First(NewGoal(nil)); err == nil {
+		t.Errorf("expected error for goal with a nil term")
+	}
+}
+
+func TestListSignatures(t *testing.T) {
+	x := NewVariable("X")
+	p := NewProg(
+		NewCompound("likes", Atom("bob"), Atom("pizza")),
+		NewCompound("likes", Atom("bob"), Atom("beer")),
+		NewCompound("person", Atom("bob")),
+		NewRule("happy", []Term{x}, NewGoal(NewCompound("likes", x, Atom("beer")))),
+		NewCompound("halt"),
+	)
+	exp := []string{"halt/0", "happy/1", "likes/2", "person/1"}
+	got := p.ListSignatures()
+	if len(got) != len(exp) {
+		t.Fatalf("expected %v got %v", exp, got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("expected %v got %v", exp, got)
+			break
+		}
+	}
+
+	counts := []struct {
+		functor Atom
+		nArgs   int
+		exp     int
+	}{
+		{"likes", 2, 2},
+		{"person", 1, 1},
+		{"likes", 1, 0},
+		{"unknown", 0, 0},
+	}
+	for _, c := range counts {
+		if n := p.ClauseCount(c.functor, c.nArgs); n != c.exp {
+			t.Errorf("%s/%d: expected %d clauses, got %d", c.functor, c.nArgs, c.exp, n)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	f1 := NewCompound("likes", Atom("bob"), Atom("pizza"))
+	f2 := NewCompound("likes", Atom("bob"), Atom("beer"))
+	f3 := NewCompound("likes", Atom("bob"), Atom("water"))
+	p := NewProg(f1, f2, f3, NewCompound("person", Atom("bob")))
+
+	p.RemoveClause(f2)
+	x := NewVariable("X")
+	all, err := p.Query(NewGoal(NewCompound("likes", Atom("bob"), x))).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0][x] != Atom("pizza") || all[1][x] != Atom("water") {
+		t.Errorf("expected X = pizza and X = water, got %v", all)
+	}
+
+	p.Remove("likes", 2)
+	if n := p.ClauseCount("likes", 2); n != 0 {
+		t.Errorf("expected no clauses, got %d", n)
+	}
+	if sigs := p.ListSignatures(); len(sigs) != 1 || sigs[0] != "person/1" {
+		t.Errorf("expected only person/1 to be defined, got %v", sigs)
+	}
+	if _, ok, err := p.First(NewGoal(NewCompound("likes", Atom("bob"), x))); ok || err != nil {
+		t.Errorf("expected no solutions, got %t %v", ok, err)
+	}
+}
+
+func TestAbolish(t *testing.T) {
+	p := NewProg(NewCompound("likes", Atom("bob"), Atom("pizza")))
+	x := NewVariable("X")
+	goal := NewGoal(NewCompound("likes", Atom("bob"), x))
+
+	p.Abolish("likes", 2)
+	if sigs := p.ListSignatures(); len(sigs) != 0 {
+		t.Errorf("expected no predicates, got %v", sigs)
+	}
+	_, _, err := p.First(goal)
+	perr, ok := err.(*PrologError)
+	if !ok || Compare(perr.Term.(*Compound).Args()[0], NewCompound("existence_error", Atom("procedure"), NewCompound("/", Atom("likes"), Integer(2)))) != 0 {
+		t.Errorf("expected existence error, got %v", err)
+	}
+
+	// defining the predicate again makes it callable
+	p.Add(NewCompound("likes", Atom("bob"), Atom("beer")))
+	if _, ok, err := p.First(goal); !ok || err != nil {
+		t.Errorf("expected a solution, got %t %v", ok, err)
+	}
+}
+
+func TestErrorTerms(t *testing.T) {
+	tests := []struct {
+		term *Compound
+		exp  string
+	}{
+		{TypeErrorTerm("integer", Atom("foo")), "error(type_error(integer, foo), _)"},
+		{InstantiationErrorTerm(), "error(instantiation_error, _)"},
+		{UninstantiationErrorTerm(Atom("a")), "error(uninstantiation_error(a), _)"},
+		{ExistenceErrorTerm(Atom("procedure"), NewCompound("/", Atom("foo"), Integer(1))), "error(existence_error(procedure, /(foo, 1)), _)"},
+		{PermissionErrorTerm(Atom("modify"), Atom("static_procedure"), Atom("foo")), "error(permission_error(modify, static_procedure, foo), _)"},
+		{DomainErrorTerm("not_less_than_zero", Integer(-1)), "error(domain_error(not_less_than_zero, -1), _)"},
+		{EvaluationErrorTerm("zero_divisor"), "error(evaluation_error(zero_divisor), _)"},
+	}
+	for _, test := range tests {
+		if got := test.term.String(); got != test.exp {
+			t.Errorf("expected %s got %s", test.exp, got)
+		}
+	}
+
+	// an uncallable goal raises a type error
+	_, _, err := NewProg().Query(NewGoal(Integer(1))).First()
+	if e, ok := err.(*PrologError); !ok || fmt.Sprint(e.Term) != "error(type_error(callable, 1), _)" {
+		t.Errorf("expected callable type error, got %v", err)
+	}
+}
+
+func TestSpy(t *testing.T) {
+	x := NewVariable("X")
+	p := NewProg(
+		NewCompound("p", Integer(1)),
+		NewCompound("p", Integer(2)),
+		NewCompound("q", Integer(2)),
+		NewRule("r", []Term{x}, NewGoal(NewCompound("p", x))),
+	)
+	var events []string
+	p.Spy("p", 1, func(event string, goal *Compound) {
+		events = append(events, fmt.Sprintf("%s %s", event, resolve(goal)))
+	})
+	test := func(goal *Goal, exp ...string) {
+		t.Helper()
+		events = nil
+		if _, err := p.Query(goal).All(); err != nil {
+			t.Fatalf("%s: %v", goal, err)
+		}
+		if fmt.Sprint(events) != fmt.Sprint(exp) {
+			t.Errorf("%s: expected events %q got %q", goal, exp, events)
+		}
+	}
+
+	// the last solution leaves no choicepoint to redo
+	x = NewVariable("X")
+	test(NewGoal(NewCompound("p", x), NewCompound("q", x)),
+		"call p(X)", "exit p(1)", "redo p(X)", "exit p(2)")
+	x = NewVariable("X")
+	test(NewGoal(NewCompound("p", x), NewCompound("q", Integer(3))),
+		"call p(X)", "exit p(1)", "redo p(X)", "exit p(2)")
+	test(NewGoal(NewCompound("p", Integer(3))), "call p(3)", "fail p(3)")
+	test(NewGoal(NewCompound("q", Integer(2))))
+
+	// spied goals are reported when called by other predicates
+	x = NewVariable("X")
+	test(NewGoal(NewCompound("r", x), Cut),
+		"call p(X)", "exit p(1)")
+
+	p.Nospy("p", 1)
+	test(NewGoal(NewCompound("p", NewVariable("X"))))
+}
+
+// TestConcurrentQueries should be run with the race detector.
+func TestConcurrentQueries(t *testing.T) {
+	p := NewProg()
+	for i := 0; i < 10; i++ {
+		p.Add(NewCompound("num", Integer(i)))
+	}
+	x := NewVariable("X")
+	p.Add(NewRule("even", []Term{x}, NewGoal(NewCompound("num", x), NewCompound("even_num", x))))
+	for i := 0; i < 10; i += 2 {
+		p.Add(NewCompound("even_num", Integer(i)))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i % 4 {
+			case 0:
+				// change the program while it's being queried
+				p.Add(NewCompound("num", Integer(100+i)))
+				p.AddFirst(NewCompound("added", Integer(i)))
+				p.Abolish("added", 1)
+			case 1:
+				p.Spy("num", 1, func(string, *Compound) {})
+				p.Nospy("num", 1)
+			}
+			x := NewVariable("X")
+			all, err := p.Query(NewGoal(NewCompound("even", x))).All()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(all) != 5 {
+				errs <- fmt.Errorf("expected 5 solutions got %d", len(all))
+				return
+			}
+			// first argument lookups use the index
+			if _, ok, err := p.First(NewGoal(NewCompound("num", Integer(i%10)))); !ok || err != nil {
+				errs <- fmt.Errorf("num(%d): expected a solution, got %t %v", i%10, ok, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := p.ClauseCount("num", 1); n != 35 {
+		t.Errorf("expected 35 clauses got %d", n)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	likes := func(a, b string) *Compound { return NewCompound("likes", Atom(a), Atom(b)) }
+	p := NewProg(likes("bob", "pizza"), likes("bob", "beer"))
+	x := NewVariable("X")
+	goal := NewGoal(NewCompound("likes", Atom("bob"), x))
+	// index likes/2 before the transaction
+	if _, ok, err := p.First(NewGoal(likes("bob", "beer"))); !ok || err != nil {
+		t.Fatalf("expected a solution, got %t %v", ok, err)
+	}
+
+	errFailed := fmt.Errorf("failed")
+	err := p.Transaction(func(p *Prog) error {
+		p.Add(likes("bob", "wine"))
+		p.AddFirst(likes("bob", "tea"))
+		p.Add(NewCompound("person", Atom("bob")))
+		p.Abolish("likes", 2)
+		return errFailed
+	})
+	if err != errFailed {
+		t.Errorf("expected %v got %v", errFailed, err)
+	}
+	all, err := p.Query(goal).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0][x] != Atom("pizza") || all[1][x] != Atom("beer") {
+		t.Errorf("expected X = pizza and X = beer, got %v", all)
+	}
+	if sigs := p.ListSignatures(); len(sigs) != 1 || sigs[0] != "likes/2" {
+		t.Errorf("expected only likes/2 to be defined, got %v", sigs)
+	}
+
+	// changes are kept if fn succeeds
+	err = p.Transaction(func(p *Prog) error {
+		p.Add(likes("bob", "wine"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.ClauseCount("likes", 2); n != 3 {
+		t.Errorf("expected 3 clauses, got %d", n)
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	p := NewProg(NewCompound("a", Integer(1)))
+	func() {
+		defer func() {
+			if r := recover(); r != "oops" {
+				t.Errorf("expected panic oops, got %v", r)
+			}
+		}()
+		p.Transaction(func(p *Prog) error {
+			p.Add(NewCompound("a", Integer(2)))
+			panic("oops")
+		})
+	}()
+	if n := p.ClauseCount("a", 1); n != 1 {
+		t.Errorf("expected the transaction to be rolled back, got %d clauses", n)
+	}
+}
+
+func TestTransactionConcurrent(t *testing.T) {
+	p := NewProg()
+	added := make(chan struct{})
+	err := p.Transaction(func(tx *Prog) error {
+		tx.Add(NewCompound("a", Integer(1)))
+		go func() {
+			p.Add(NewCompound("b", Integer(1)))
+			close(added)
+		}()
+		// changes made outside of the transaction wait for it to end
+		select {
+		case <-added:
+			t.Errorf("change was made during the transaction")
+		case <-time.After(10 * time.Millisecond):
+		}
+		// and queries of it don't
+		if _, ok, err := tx.First(NewGoal(NewCompound("a", Integer(1)))); !ok || err != nil {
+			t.Errorf("expected a solution, got %t %v", ok, err)
+		}
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	<-added
+	// the rollback doesn't undo it
+	if a, b := p.ClauseCount("a", 1), p.ClauseCount("b", 1); a != 0 || b != 1 {
+		t.Errorf("expected 0 clauses of a and 1 of b, got %d and %d", a, b)
+	}
+}
@@ -0,0 +1,58 @@
+package syntax
+
+import "sync/atomic"
+
+// PrologStats holds statistics about the evaluation of a program's queries,
+// see Prog.Statistics.
+type PrologStats struct {
+	// TotalInferences is the number of attempts to match a goal against a
+	// clause, including each retry of a generator such as between/3.
+	TotalInferences int64
+	// BacktrackCount is the number of times evaluation backtracked because
+	// a goal had no more matching clauses.
+	BacktrackCount int64
+	// ChoicepointsPushed and ChoicepointsPopped are the number of
+	// choicepoints created and discarded, either by backtracking, by a goal
+	// having no alternatives left, or by a cut.
+	ChoicepointsPushed int64
+	ChoicepointsPopped int64
+	// ClauseCount is the number of clauses currently held by the program.
+	ClauseCount int
+}
+
+// counters holds the statistics of a program which are updated during
+// evaluation. They're updated atomically, since queries may be evaluated
+// concurrently.
+type counters struct {
+	inferences int64
+	backtracks int64
+	pushed     int64
+	popped     int64
+}
+
+// Statistics returns the statistics of the queries evaluated by the program,
+// including queries evaluated by builtins such as findall/3, since the
+// program was created or ResetStatistics was last called.
+func (p *Prog) Statistics() PrologStats {
+	p.clausesMu.RLock()
+	n := 0
+	for _, clauses := range p.clauses {
+		n += len(clauses)
+	}
+	p.clausesMu.RUnlock()
+	return PrologStats{
+		TotalInferences:    atomic.LoadInt64(&p.stats.inferences),
+		BacktrackCount:     atomic.LoadInt64(&p.stats.backtracks),
+		ChoicepointsPushed: atomic.LoadInt64(&p.stats.pushed),
+		ChoicepointsPopped: atomic.LoadInt64(&p.stats.popped),
+		ClauseCount:        n,
+	}
+}
+
+// ResetStatistics sets the counters reported by Statistics to zero.
+func (p *Prog) ResetStatistics() {
+	atomic.StoreInt64(&p.stats.inferences, 0)
+	atomic.StoreInt64(&p.stats.backtracks, 0)
+	atomic.StoreInt64(&p.stats.pushed, 0)
+	atomic.StoreInt64(&p.stats.popped, 0)
+}
@@ -0,0 +1,47 @@
+package syntax
+
+import "testing"
+
+func TestStatistics(t *testing.T) {
+	p := NewProg(
+		NewCompound("likes", Atom("bob"), Atom("pizza")),
+		NewCompound("likes", Atom("bob"), Atom("beer")),
+		NewCompound("good", Atom("beer")),
+	)
+	if s := p.Statistics(); s != (PrologStats{ClauseCount: 3}) {
+		t.Errorf("expected no inferences, got %+v", s)
+	}
+
+	// likes(bob, pizza) matches, but good(pizza) fails and evaluation
+	// backtracks to match likes(bob, beer) and good(beer)
+	x := NewVariable("X")
+	all, err := p.Query(NewGoal(NewCompound("likes", Atom("bob"), x), NewCompound("good", x))).All()
+	if err != nil || len(all) != 1 {
+		t.Fatalf("expected 1 solution, got %v %v", all, err)
+	}
+	exp := PrologStats{
+		TotalInferences:    4,
+		BacktrackCount:     1,
+		ChoicepointsPushed: 3,
+		ChoicepointsPopped: 3,
+		ClauseCount:        3,
+	}
+	if s := p.Statistics(); s != exp {
+		t.Errorf("expected %+v got %+v", exp, s)
+	}
+
+	p.ResetStatistics()
+	if s := p.Statistics(); s != (PrologStats{ClauseCount: 3}) {
+		t.Errorf("expected statistics to be reset, got %+v", s)
+	}
+
+	// a cut discards the choicepoints created since its clause was selected
+	p.Add(NewRule("first", []Term{x}, NewGoal(NewCompound("likes", Atom("bob"), x), Cut)))
+	x = NewVariable("X")
+	if _, ok, err := p.First(NewGoal(NewCompound("first", x))); !ok || err != nil {
+		t.Fatalf("expected a solution, got %t %v", ok, err)
+	}
+	if s := p.Statistics(); s.ChoicepointsPushed != 2 || s.ChoicepointsPopped != 2 || s.ClauseCount != 4 {
+		t.Errorf("expected 2 choicepoints pushed and popped, got %+v", s)
+	}
+}
@@ -32,13 +32,31 @@ type Clause interface {
 	// The caller owns the returned compound and may alter variables
 	// however it chooses. Call should therefore create a copy of variables
 	// before returning a match.
-	Call(args []Term) (body *Goal, matches bool)
+	//
+	// p is the program evaluating the call, allowing meta-predicates such as
+	// '\+' to evaluate goals of their own. A non-nil error aborts the
+	// evaluation of the query and is reported by Results.Err.
+	Call(p *Prog, args []Term) (body *Goal, matches bool, err error)
 
 	// Signature returns the callable signature of the underlying type.
 	// For example 'write/2'
 	Signature() (functor Atom, nArgs int)
 }
 
+// Generator is implemented by clauses which can match more than once, such as
+// between/3. When evaluating a Generator, the program calls Generate instead
+// of Call.
+type Generator interface {
+	Clause
+
+	// Generate returns a function which is called for each attempt to match
+	// the clause. Each call should return the next match, with the same
+	// meaning as the return values of Call, until matches is false. Bindings
+	// made by a previous call are undone before the function is called
+	// again.
+	Generate(p *Prog, args []Term) func() (body *Goal, matches bool, err error)
+}
+
 var (
 	AnonVariable Term = &anonVariable{}
 	Cut          Term = &cut{}
@@ -60,7 +78,9 @@ func (*cut) String() string      { return "!" }
 // Atom is a general-purpose name with no inherent meaning.
 type Atom string
 
-func (a Atom) Callable() *Compound { return nil }
+// Callable returns a compound with no arguments, allowing atoms such as 'nl'
+// to be used as goals.
+func (a Atom) Callable() *Compound { return &Compound{functor: a} }
 
 func (a Atom) Unify(t Term) bool {
 	switch t := t.(type) {
@@ -74,6 +94,28 @@ func (a Atom) Unify(t Term) bool {
 
 func (a Atom) String() string { return string(a) }
 
+// String is a sequence of characters, written in double quotes such as
+// "hello". Unlike an atom it has no meaning as a name, and it only unifies
+// with a String holding the same characters.
+type String string
+
+// NewString returns the string s as a term.
+func NewString(s string) Term { return String(s) }
+
+func (s String) Callable() *Compound { return nil }
+
+func (s String) Unify(t Term) bool {
+	switch t := t.(type) {
+	case *Variable:
+		return t.Unify(s)
+	case String:
+		return t == s
+	}
+	return false
+}
+
+func (s String) String() string { return strconv.Quote(string(s)) }
+
 // Integer aliases an interger type. It can be unified with other numeric types.
 type Integer int
 
@@ -121,9 +163,40 @@ func (f Float64) String() string {
 type Variable struct {
 	name  string // only for debugging.
 	value Term   // if nil, unset
+	attrs map[Atom]Term
+}
+
+// AttributedVariable is implemented by variables which can hold attributes,
+// values stored under a key which are carried along with the variable. For
+// example a constraint solver can attach the domain of a variable to it.
+type AttributedVariable interface {
+	// GetAttr returns the attribute stored under key, nil if there's none.
+	GetAttr(key string) Term
+	// PutAttr stores value under key, replacing any attribute already stored.
+	PutAttr(key string, value Term)
 }
 
-func NewVariable(name string) *Variable { return &Variable{name, nil} }
+func NewVariable(name string) *Variable { return &Variable{name: name} }
+
+// GetAttr returns the attribute stored under key, nil if there's none.
+// Variables bound to each other share their attributes.
+func (v *Variable) GetAttr(key string) Term {
+	return v.last().attrs[Atom(key)]
+}
+
+// PutAttr stores value under key, replacing any attribute already stored.
+// Like bindings, attributes put while evaluating a query are undone when the
+// query backtracks.
+func (v *Variable) PutAttr(key string, value Term) {
+	v = v.last()
+	// replace rather than alter the map, it may be held by a snapshot
+	attrs := make(map[Atom]Term, len(v.attrs)+1)
+	for k, val := range v.attrs {
+		attrs[k] = val
+	}
+	attrs[Atom(key)] = value
+	v.attrs = attrs
+}
 
 func (v *Variable) String() string {
 	return v.name
@@ -143,29 +216,124 @@ func (v *Variable) Value() Term {
 	}
 }
 
+// Deref returns the term a variable is bound to. If t is an unbound variable,
+// or a chain of variables bound to each other ending in one, the last
+// variable of the chain is returned, so variables which have been unified
+// deref to the same variable. Other terms are returned unaltered.
+func Deref(t Term) Term {
+	if v, ok := t.(*Variable); ok {
+		if val := v.Value(); val != nil {
+			return val
+		}
+		return v.last()
+	}
+	return t
+}
+
 func (v *Variable) Unify(t Term) (rv bool) {
-	v2, isVar := t.(*Variable)
-	if !isVar {
-		if v.value == nil {
+	v = v.last()
+	if v.value != nil {
+		return v.value.Unify(t)
+	}
+	switch t := t.(type) {
+	case *anonVariable:
+		return true
+	case *Variable:
+		// bind to the end of the other variable's chain, so binding two
+		// variables to each other never creates a cycle.
+		t = t.last()
+		switch {
+		case t == v:
+		case len(v.attrs) > 0 && len(t.attrs) == 0:
+			// keep the attributed variable unbound, so its attributes
+			// don't need to be checked
+			t.value = v
+		default:
 			v.value = t
-			return true
 		}
-		return v.value.Unify(t)
+		return true
 	}
+	v.value = t
+	return true
+}
 
-	// TODO: review this logic, prevent infinate loops
-	if v == v2 {
+// OccursCheck reports whether the variable occurs in t, following the
+// bindings of variables in t. Binding a variable to a term it occurs in
+// creates a cyclic term, see UnifyOC.
+func (v *Variable) OccursCheck(t Term) bool {
+	v = v.last()
+	occurs := false
+	seen := map[*Variable]bool{}
+	Walk(t, func(t Term) bool {
+		w, ok := t.(*Variable)
+		switch {
+		case occurs:
+			return false
+		case !ok:
+			return true
+		case w == v:
+			occurs = true
+			return false
+		case seen[w]:
+			// w may already be part of a cyclic term
+			return false
+		}
+		seen[w] = true
 		return true
-	}
-	if v.value == nil {
-		v.value = v2
+	})
+	return occurs
+}
+
+// UnifyOC unifies two terms like Unify, but fails rather than bind a
+// variable to a term it occurs in, such as X to f(X). Like Unify, it may
+// bind some variables before failing.
+func UnifyOC(a, b Term) bool {
+	a, b = Deref(a), Deref(b)
+	if a == AnonVariable || b == AnonVariable {
 		return true
 	}
-	if v2.value == nil {
-		v2.value = v
-		return true
+	if v, ok := a.(*Variable); ok {
+		if _, ok := b.(*Variable); !ok && v.OccursCheck(b) {
+			return false
+		}
+		return v.Unify(b)
+	}
+	if _, ok := b.(*Variable); ok {
+		return UnifyOC(b, a)
+	}
+	ac, ok := a.(*Compound)
+	if !ok {
+		return a.Unify(b)
 	}
-	return v.value.Unify(v2.value)
+	bc, ok := b.(*Compound)
+	if !ok || ac.functor != bc.functor || len(ac.args) != len(bc.args) {
+		return false
+	}
+	for i, arg := range ac.args {
+		if !UnifyOC(arg, bc.args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// last follows a chain of variables bound to variables, returning the final
+// variable of the chain.
+func (v *Variable) last() *Variable {
+	for {
+		next, ok := v.value.(*Variable)
+		if !ok {
+			return v
+		}
+		v = next
+	}
+}
+
+// IsGround reports whether the variable is bound to a term which contains no
+// unbound variables.
+func (v *Variable) IsGround() bool {
+	val := v.Value()
+	return val != nil && IsGround(val)
 }
 
 func (v *Variable) Callable() *Compound {
@@ -175,6 +343,30 @@ func (v *Variable) Callable() *Compound {
 	return v.value.Callable()
 }
 
+// IsGround reports whether a term is fully instantiated, that is it contains
+// no unbound variables. Bound variables are followed to their values and
+// compound arguments are checked recursively. The anonymous variable is never
+// ground.
+func IsGround(t Term) bool {
+	ground := true
+	walked := map[*Variable]bool{} // bound variables, t may be cyclic
+	Walk(t, func(t Term) bool {
+		switch t := t.(type) {
+		case *Variable:
+			if t.value == nil {
+				ground = false
+			} else if walked[t] {
+				return false
+			}
+			walked[t] = true
+		case *anonVariable:
+			ground = false
+		}
+		return ground
+	})
+	return ground
+}
+
 // Compound represents any term that is a functor with additional arguments.
 type Compound struct {
 	functor Atom
@@ -207,11 +399,23 @@ func (c *Compound) Callable() *Compound {
 	return c
 }
 
+// Functor returns the name of the compound. For example 'foo' for the term
+// 'foo(bar, baz)'.
+func (c *Compound) Functor() Atom { return c.functor }
+
+// Args returns the arguments of the compound. The returned slice is a copy and
+// may be altered by the caller without affecting the compound.
+func (c *Compound) Args() []Term {
+	args := make([]Term, len(c.args))
+	copy(args, c.args)
+	return args
+}
+
 func (c *Compound) Signature() (functor Atom, nArgs int) {
 	return c.functor, len(c.args)
 }
 
-func (c *Compound) Call(args []Term) (results *Goal, matches bool) {
+func (c *Compound) Call(p *Prog, args []Term) (results *Goal, matches bool, err error) {
 	if len(c.args) != len(args) {
 		return
 	}
@@ -221,10 +425,13 @@ func (c *Compound) Call(args []Term) (results *Goal, matches bool) {
 			return
 		}
 	}
-	return nil, true
+	return nil, true, nil
 }
 
 func (c *Compound) String() string {
+	if len(c.args) == 0 {
+		return string(c.functor)
+	}
 	var b bytes.Buffer
 	b.WriteString(string(c.functor))
 	b.WriteString("(")
@@ -256,6 +463,33 @@ func NewGoal(head Term, tail ...Term) *Goal {
 	return comp
 }
 
+// GoalFromSlice creates a goal from a list of terms. If terms is empty, nil is
+// returned.
+func GoalFromSlice(terms []Term) *Goal {
+	if len(terms) == 0 {
+		return nil
+	}
+	return NewGoal(terms[0], terms[1:]...)
+}
+
+// ToSlice returns the terms of the goal in order.
+func (g *Goal) ToSlice() []Term {
+	terms := make([]Term, 0, g.Len())
+	for ; g != nil; g = g.tail {
+		terms = append(terms, g.head)
+	}
+	return terms
+}
+
+// Len returns the number of terms in the goal. A nil goal has a length of 0.
+func (g *Goal) Len() int {
+	n := 0
+	for ; g != nil; g = g.tail {
+		n++
+	}
+	return n
+}
+
 func (g *Goal) String() string {
 	var b bytes.Buffer
 	goal := g
@@ -280,57 +514,125 @@ func NewRule(functor Atom, args []Term, body *Goal) *Rule {
 	return &Rule{functor, args, body}
 }
 
-// cp creates a copy of a Rule, recursively replacing all Variables with
-// unset ones.
-func (r *Rule) cp() *Rule {
-	vars := map[*Variable]*Variable{}
+// Copy returns a copy of a term, replacing all unbound variables with fresh
+// ones. Bound variables are replaced by a copy of their value. Variables which
+// occur several times in t share the same variable in the copy. The
+// attributes of variables are copied along with them. Copies of cyclic terms
+// are cyclic.
+func Copy(t Term) Term {
+	return copier{}.term(t)
+}
 
-	// declare anonymous functions for recursive use.
-	var cpTerm func(t Term) Term
-	var cpTerms func(terms []Term) []Term
+// copier maps the variables of a term to their copies.
+type copier map[*Variable]*Variable
 
-	cpTerm = func(t Term) Term {
-		switch t := t.(type) {
-		case *Variable:
-			newval, ok := vars[t]
-			if !ok {
-				newval = &Variable{name: t.name}
-				vars[t] = newval
-			}
-			return newval
-		case *Compound:
-			return &Compound{
-				functor: t.functor,
-				args:    cpTerms(t.args),
+func (c copier) term(t Term) Term {
+	switch t := t.(type) {
+	case *Variable:
+		if val := t.Value(); val != nil {
+			return c.bound(t, val)
+		}
+		// variables bound to each other share a copy
+		t = t.last()
+		newval, ok := c[t]
+		if !ok {
+			newval = &Variable{name: t.name}
+			c[t] = newval
+			for key, attr := range t.attrs {
+				newval.PutAttr(string(key), c.term(attr))
 			}
 		}
-		return t
+		return newval
+	case *Compound:
+		return &Compound{
+			functor: t.functor,
+			args:    c.terms(t.args),
+		}
 	}
+	return t
+}
 
-	cpTerms = func(terms []Term) []Term {
-		newTerms := make([]Term, len(terms))
-		for i, t := range terms {
-			newTerms[i] = cpTerm(t)
+// bound copies the value of the bound variable v. While the value is copied,
+// v maps to nil. If v is found again, the value is cyclic, such as the value
+// of X after 'X = f(X)', and a fresh variable is bound to the copy so the
+// copy is cyclic too.
+func (c copier) bound(v *Variable, val Term) Term {
+	if cv, ok := c[v]; ok {
+		if cv == nil {
+			cv = &Variable{name: v.name}
+			c[v] = cv
 		}
-		return newTerms
+		return cv
+	}
+	c[v] = nil
+	cp := c.term(val)
+	if cv := c[v]; cv != nil {
+		cv.value = cp
+	}
+	delete(c, v)
+	return cp
+}
+
+func (c copier) terms(terms []Term) []Term {
+	newTerms := make([]Term, len(terms))
+	for i, t := range terms {
+		newTerms[i] = c.term(t)
 	}
+	return newTerms
+}
 
-	cp := Rule{functor: r.functor, args: cpTerms(r.args)}
-	if r.body == nil {
-		return &cp
+// Substitute returns a copy of t in which each variable in subst is replaced
+// by its term. Bound variables are replaced by the substituted copy of their
+// value, and unbound variables not in subst are kept. Neither t nor the terms
+// of subst are altered.
+//
+// In a cyclic term, such as the value of X after 'X = f(X)', the variable
+// which refers back to the value being substituted is kept.
+func Substitute(t Term, subst map[*Variable]Term) Term {
+	return substituter{subst, map[*Variable]bool{}}.term(t)
+}
+
+type substituter struct {
+	subst map[*Variable]Term
+	// substituting holds the bound variables whose values are being
+	// substituted.
+	substituting map[*Variable]bool
+}
+
+func (s substituter) term(t Term) Term {
+	switch t := t.(type) {
+	case *Variable:
+		if sub, ok := s.subst[t]; ok {
+			return sub
+		}
+		if t.value == nil || s.substituting[t] {
+			return t
+		}
+		s.substituting[t] = true
+		defer delete(s.substituting, t)
+		return s.term(t.value)
+	case *Compound:
+		args := make([]Term, len(t.args))
+		for i, arg := range t.args {
+			args[i] = s.term(arg)
+		}
+		return &Compound{functor: t.functor, args: args}
 	}
-	cp.body = &Goal{cpTerm(r.body.head), nil}
-	last := cp.body
-	next := r.body.tail
+	return t
+}
 
-	for next != nil {
-		last.tail = &Goal{cpTerm(next.head), nil}
-		last, next = next, next.tail
+// cp creates a copy of a Rule, recursively replacing all Variables with
+// unset ones.
+func (r *Rule) cp() *Rule {
+	c := copier{}
+	cp := Rule{functor: r.functor, args: c.terms(r.args)}
+	if r.body != nil {
+		cp.body = GoalFromSlice(c.terms(r.body.ToSlice()))
 	}
 	return &cp
 }
 
-func (r *Rule) Call(args []Term) (results *Goal, matches bool) {
+func (r *Rule) Call(p *Prog, args []Term) (results *Goal, matches bool, err error) {
 	if len(args) != len(r.args) {
 		return
 	}
@@ -342,7 +644,14 @@ func (r *Rule) Call(args []Term) (results *Goal, matches bool) {
 			return
 		}
 	}
-	return ruleCP.body, true
+	return ruleCP.body, true, nil
+}
+
+// Parts returns the head and body of the rule. Both are copied with fresh
+// variables, which are shared between the head and the body.
+func (r *Rule) Parts() (head *Compound, body *Goal) {
+	cp := r.cp()
+	return &Compound{functor: cp.functor, args: cp.args}, cp.body
 }
 
 func (r *Rule) Signature() (Atom, int) { return r.functor, len(r.args) }
@@ -350,15 +659,19 @@ func (r *Rule) Signature() (Atom, int) { return r.functor, len(r.args) }
 func (r *Rule) String() string {
 	var b bytes.Buffer
 	b.WriteString(string(r.functor))
-	b.WriteString("(")
-	for i, arg := range r.args {
-		if i > 0 {
-			b.WriteString(", ")
+	if len(r.args) > 0 {
+		b.WriteString("(")
+		for i, arg := range r.args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprint(&b, arg)
 		}
-		fmt.Fprint(&b, arg)
+		b.WriteString(")")
+	}
+	if r.body != nil {
+		b.WriteString(" :- ")
+		fmt.Fprint(&b, r.body)
 	}
-	b.WriteString(")")
-	b.WriteString(" :- ")
-	fmt.Fprint(&b, r.body)
 	return b.String()
 }
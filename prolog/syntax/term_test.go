@@ -21,6 +21,19 @@ func TestAtomUnify(t *testing.T) {
 	testUnify(Atom("foobar"), Atom("foobar"), true, t)
 }
 
+func TestStringUnify(t *testing.T) {
+	testUnify(String("a"), String("a"), true, t)
+	testUnify(String("a"), String("b"), false, t)
+	testUnify(String("a"), Atom("a"), false, t)
+	testUnify(Atom("a"), String("a"), false, t)
+	testUnify(String("1"), Integer(1), false, t)
+
+	x := NewVariable("X")
+	testUnify(x, String("a"), true, t)
+	testUnify(String("a"), x, true, t)
+	testUnify(String("b"), x, false, t)
+}
+
 func TestNumberUnify(t *testing.T) {
 	testUnify(Float64(1.), Float64(1.), true, t)
 	testUnify(Float64(1.), Integer(1), true, t)
@@ -53,3 +66,311 @@ func TestFactUnify(t *testing.T) {
 	}
 	testUnify(t1, t2, true, t)
 }
+
+func TestCompoundAccessors(t *testing.T) {
+	x := NewVariable("X")
+	c := NewCompound("foo", Atom("bar"), x)
+	if f := c.Functor(); f != "foo" {
+		t.Errorf("expected functor foo, got %s", f)
+	}
+	args := c.Args()
+	if len(args) != 2 || args[0] != Atom("bar") || args[1] != x {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	// altering the returned slice must not alter the compound
+	args[0] = Atom("baz")
+	if got := c.Args()[0]; got != Atom("bar") {
+		t.Errorf("expected first argument to be bar, got %s", got)
+	}
+	testUnify(c, NewCompound("foo", Atom("bar"), Integer(1)), true, t)
+	testUnify(c, NewCompound("foo", Atom("baz"), Integer(1)), false, t)
+}
+
+func TestGoalSlice(t *testing.T) {
+	x := NewVariable("X")
+	g := NewGoal(
+		NewCompound("foo", x),
+		Atom("bar"),
+		Cut,
+		NewCompound("baz", x, Atom("qux")),
+		Atom("quux"),
+	)
+	if n := g.Len(); n != 5 {
+		t.Errorf("expected goal of length 5, got %d", n)
+	}
+	terms := g.ToSlice()
+	if len(terms) != 5 {
+		t.Fatalf("expected 5 terms, got %d: %v", len(terms), terms)
+	}
+	g2 := GoalFromSlice(terms)
+	if g.String() != g2.String() {
+		t.Errorf("expected %s, got %s", g, g2)
+	}
+
+	var empty *Goal
+	if n := empty.Len(); n != 0 {
+		t.Errorf("expected nil goal to have length 0, got %d", n)
+	}
+	if got := GoalFromSlice(nil); got != nil {
+		t.Errorf("expected nil goal, got %s", got)
+	}
+}
+
+func TestIsGround(t *testing.T) {
+	// chains of two and three variables
+	x, y, z := NewVariable("X"), NewVariable("Y"), NewVariable("Z")
+	x.Unify(y)
+	if x.IsGround() || IsGround(x) {
+		t.Errorf("variable bound to an unbound variable should not be ground")
+	}
+	y.Unify(z)
+	if IsGround(x) {
+		t.Errorf("chain of unbound variables should not be ground")
+	}
+	z.Unify(Atom("foo"))
+	if !x.IsGround() || !IsGround(y) {
+		t.Errorf("chain of variables bound to an atom should be ground")
+	}
+
+	a, b := NewVariable("A"), NewVariable("B")
+	a.Unify(b)
+	tests := []struct {
+		term   Term
+		ground bool
+	}{
+		{Atom("foo"), true},
+		{Integer(1), true},
+		{Float64(1.5), true},
+		{Cut, true},
+		{AnonVariable, false},
+		{NewVariable("V"), false},
+		{a, false},
+		{x, true},
+		{NewCompound("foo", Atom("bar"), x), true},
+		{NewCompound("foo", Atom("bar"), a), false},
+		{NewCompound("foo", NewCompound("bar", AnonVariable)), false},
+	}
+	for _, test := range tests {
+		if got := IsGround(test.term); got != test.ground {
+			t.Errorf("IsGround(%s): expected %t got %t", test.term, test.ground, got)
+		}
+	}
+
+	// cyclic terms, such as the value of C after 'C = f(C)'
+	c := NewVariable("C")
+	c.Unify(NewCompound("f", c))
+	if !IsGround(c) {
+		t.Errorf("expected C = f(C) to be ground")
+	}
+	d := NewVariable("D")
+	d.Unify(NewCompound("f", d, NewVariable("V")))
+	if IsGround(d) {
+		t.Errorf("expected D = f(D, V) not to be ground")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	x, y := NewVariable("X"), NewVariable("Y")
+	orig := NewCompound("foo", x, NewCompound("bar", x, y), Atom("baz"))
+	cp, ok := Copy(orig).(*Compound)
+	if !ok {
+		t.Fatalf("expected copy to be a compound")
+	}
+	if cp.String() != orig.String() {
+		t.Errorf("expected %s got %s", orig, cp)
+	}
+	if f, n := cp.Signature(); f != "foo" || n != 3 {
+		t.Errorf("expected foo/3, got %s/%d", f, n)
+	}
+
+	args := cp.Args()
+	x2, ok := args[0].(*Variable)
+	if !ok || x2 == x {
+		t.Fatalf("expected a fresh variable, got %v", args[0])
+	}
+	inner := args[1].(*Compound).Args()
+	if inner[0] != x2 {
+		t.Errorf("expected occurrences of X to share a variable in the copy")
+	}
+	if inner[1] == y {
+		t.Errorf("expected a fresh variable for Y")
+	}
+
+	// binding variables of the copy must not alter the original
+	x2.Unify(Atom("qux"))
+	if x.Value() != nil {
+		t.Errorf("binding the copy bound the original to %s", x.Value())
+	}
+
+	// bound variables are copied as their values
+	y.Unify(Integer(1))
+	if got := Copy(y); got != Integer(1) {
+		t.Errorf("expected copy of bound variable to be 1, got %s", got)
+	}
+}
+
+func TestCopyAttributes(t *testing.T) {
+	x, y := NewVariable("X"), NewVariable("Y")
+	var av AttributedVariable = x
+	av.PutAttr("domain", NewCompound("range", Integer(1), Integer(10)))
+	x.PutAttr("link", NewCompound("f", x, y))
+	if x.GetAttr("none") != nil {
+		t.Errorf("expected no attribute, got %s", x.GetAttr("none"))
+	}
+
+	x2, ok := Copy(NewCompound("t", x, y)).(*Compound).Args()[0].(*Variable)
+	if !ok || x2 == x {
+		t.Fatalf("expected a fresh variable")
+	}
+	if got := x2.GetAttr("domain"); got == nil || got.(*Compound).String() != "range(1, 10)" {
+		t.Errorf("expected domain attribute range(1, 10), got %v", got)
+	}
+	// variables in attributes are copied along with the term
+	link := x2.GetAttr("link").(*Compound).Args()
+	if link[0] != x2 || link[1] == y {
+		t.Errorf("expected link attribute to refer to the copied variables, got %v", link)
+	}
+
+	// altering the copy's attributes doesn't alter the original
+	x2.PutAttr("domain", Atom("none"))
+	if _, ok := x.GetAttr("domain").(*Compound); !ok {
+		t.Errorf("altering the copy changed the original to %s", x.GetAttr("domain"))
+	}
+}
+
+func TestRuleCopy(t *testing.T) {
+	x := NewVariable("X")
+	r := NewRule("foo", []Term{x}, NewGoal(
+		NewCompound("a", x), NewCompound("b", x), NewCompound("c", x),
+	))
+	body, ok, err := r.Call(NewProg(), []Term{Atom("bar")})
+	if err != nil || !ok {
+		t.Fatalf("expected rule to match")
+	}
+	goals := body.ToSlice()
+	if len(goals) != 3 {
+		t.Fatalf("expected 3 goals, got %s", body)
+	}
+	for _, g := range goals {
+		arg := g.(*Compound).Args()[0].(*Variable)
+		if arg.Value() != Atom("bar") {
+			t.Errorf("expected argument of %s to be bound to bar", g)
+		}
+	}
+	if x.Value() != nil {
+		t.Errorf("calling rule bound its variable to %s", x.Value())
+	}
+}
+
+func TestVariableChains(t *testing.T) {
+	x, y, z := NewVariable("X"), NewVariable("Y"), NewVariable("Z")
+	testUnify(x, y, true, t)
+	testUnify(y, x, true, t)
+	testUnify(y, z, true, t)
+	testUnify(z, x, true, t)
+	if x.Value() != nil {
+		t.Fatalf("expected X to be unbound, got %s", x.Value())
+	}
+	testUnify(z, Atom("foo"), true, t)
+	for _, v := range []*Variable{x, y, z} {
+		if v.Value() != Atom("foo") {
+			t.Errorf("expected %s to be foo, got %s", v, v.Value())
+		}
+	}
+	testUnify(x, Atom("bar"), false, t)
+}
+
+func TestUnboundVariableChains(t *testing.T) {
+	x, y, z := NewVariable("X"), NewVariable("Y"), NewVariable("Z")
+	testUnify(x, y, true, t)
+	testUnify(z, y, true, t)
+	// unified variables are identical, but distinct from other variables
+	if Deref(x) != Deref(y) || Deref(y) != Deref(z) {
+		t.Errorf("expected X, Y and Z to deref to the same variable")
+	}
+	if Compare(x, z) != 0 {
+		t.Errorf("expected X == Z")
+	}
+	if w := NewVariable("W"); Compare(x, w) == 0 {
+		t.Errorf("expected X \\== W")
+	}
+	// and share a copy
+	c := Copy(NewCompound("f", x, y, z)).(*Compound)
+	if c.args[0] != c.args[1] || c.args[1] != c.args[2] {
+		t.Errorf("expected the arguments of %s to be the same variable", c)
+	}
+	if c.args[0] == Deref(x) {
+		t.Errorf("expected a fresh variable in the copy")
+	}
+}
+
+func TestUnifyOC(t *testing.T) {
+	x, y := NewVariable("X"), NewVariable("Y")
+	f := func(args ...Term) Term { return NewCompound("f", args...) }
+	if !x.OccursCheck(f(Atom("a"), f(x))) {
+		t.Errorf("expected X to occur in f(a, f(X))")
+	}
+	if x.OccursCheck(f(y)) {
+		t.Errorf("expected X not to occur in f(Y)")
+	}
+	y.Unify(f(x))
+	if !x.OccursCheck(f(y)) {
+		t.Errorf("expected X to occur in f(Y) once Y = f(X)")
+	}
+
+	tests := []struct {
+		a, b func(x, y Term) Term
+		exp  bool
+	}{
+		{func(x, y Term) Term { return x }, func(x, y Term) Term { return f(x) }, false},
+		{func(x, y Term) Term { return f(x, y) }, func(x, y Term) Term { return f(y, f(x)) }, false},
+		{func(x, y Term) Term { return f(x, y) }, func(x, y Term) Term { return f(y, Atom("a")) }, true},
+		{func(x, y Term) Term { return x }, func(x, y Term) Term { return x }, true},
+		{func(x, y Term) Term { return x }, func(x, y Term) Term { return y }, true},
+		{func(x, y Term) Term { return f(x) }, func(x, y Term) Term { return f(AnonVariable) }, true},
+		{func(x, y Term) Term { return f(x) }, func(x, y Term) Term { return Atom("a") }, false},
+	}
+	for _, test := range tests {
+		x, y := NewVariable("X"), NewVariable("Y")
+		a, b := test.a(x, y), test.b(x, y)
+		if got := UnifyOC(a, b); got != test.exp {
+			t.Errorf("UnifyOC(%s, %s): expected %t got %t", a, b, test.exp, got)
+		}
+	}
+}
+
+func TestCopyCyclic(t *testing.T) {
+	x := NewVariable("X")
+	x.Unify(NewCompound("f", x))
+	cp, ok := Copy(x).(*Compound)
+	if !ok || cp.functor != "f" {
+		t.Fatalf("expected a copy of f(X), got %s", Copy(x))
+	}
+	// the argument of the copy refers back to the copy
+	v, ok := cp.args[0].(*Variable)
+	if !ok || v == x || v.Value() != cp {
+		t.Errorf("expected a cyclic copy, got %s", cp)
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	x, y, z := NewVariable("X"), NewVariable("Y"), NewVariable("Z")
+	foo := Atom("foo")
+	orig := NewCompound("f", x, NewCompound("g", x), y)
+	got := Substitute(orig, map[*Variable]Term{x: foo})
+	if exp := NewCompound("f", foo, NewCompound("g", foo), y); Compare(got, exp) != 0 {
+		t.Errorf("expected %s got %s", exp, got)
+	}
+	if x.Value() != nil || orig.String() != "f(X, g(X), Y)" {
+		t.Errorf("Substitute altered the original term %s", orig)
+	}
+
+	// bound variables are replaced by their substituted values, the
+	// substituted terms themselves aren't substituted
+	y.Unify(NewCompound("h", z))
+	got = Substitute(orig, map[*Variable]Term{x: z, z: Integer(1)})
+	if exp := NewCompound("f", z, NewCompound("g", z), NewCompound("h", Integer(1))); Compare(got, exp) != 0 {
+		t.Errorf("expected %s got %s", exp, got)
+	}
+}
@@ -0,0 +1,56 @@
+package syntax
+
+// Walk traverses t in pre-order, calling fn for t and each of its sub-terms.
+// The sub-terms of a compound are its arguments, and the sub-term of a bound
+// variable is its value. If fn returns false, Walk doesn't descend into the
+// term's sub-terms.
+//
+// Walk doesn't keep track of the variables it has visited, so fn should
+// return false for variables it has already seen if t may be cyclic, such as
+// the value of X after 'X = f(X)'.
+func Walk(t Term, fn func(Term) bool) {
+	if !fn(t) {
+		return
+	}
+	switch t := t.(type) {
+	case *Variable:
+		if t.value != nil {
+			Walk(t.value, fn)
+		}
+	case *Compound:
+		for _, arg := range t.args {
+			Walk(arg, fn)
+		}
+	}
+}
+
+// WalkPost traverses t in post-order, calling fn for each sub-term of a term
+// before the term itself, see Walk. If fn returns false, the walk stops and
+// fn isn't called again. In a cyclic term, the variable which refers back to
+// a value being walked is visited without walking the value again.
+func WalkPost(t Term, fn func(Term) bool) {
+	walkPost(t, fn, map[*Variable]bool{})
+}
+
+// walkPost walks t in post-order, where walking holds the bound variables
+// whose values are being walked. It returns false if the walk was stopped.
+func walkPost(t Term, fn func(Term) bool, walking map[*Variable]bool) bool {
+	switch t := t.(type) {
+	case *Variable:
+		if t.value != nil && !walking[t] {
+			walking[t] = true
+			ok := walkPost(t.value, fn, walking)
+			delete(walking, t)
+			if !ok {
+				return false
+			}
+		}
+	case *Compound:
+		for _, arg := range t.args {
+			if !walkPost(arg, fn, walking) {
+				return false
+			}
+		}
+	}
+	return fn(t)
+}
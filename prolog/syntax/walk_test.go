@@ -0,0 +1,91 @@
+package syntax
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	x, y := NewVariable("X"), NewVariable("Y")
+	y.Unify(NewCompound("g", Atom("c"), x))
+	term := NewCompound("f", Atom("a"), NewCompound("h", Atom("b"), y), Integer(1), x)
+
+	// count all atoms, including those in the values of bound variables
+	n := 0
+	Walk(term, func(t Term) bool {
+		if _, ok := t.(Atom); ok {
+			n++
+		}
+		return true
+	})
+	if n != 3 {
+		t.Errorf("expected 3 atoms, got %d", n)
+	}
+
+	// find all variables
+	var vars []*Variable
+	Walk(term, func(t Term) bool {
+		if v, ok := t.(*Variable); ok {
+			vars = append(vars, v)
+		}
+		return true
+	})
+	if len(vars) != 3 || vars[0] != y || vars[1] != x || vars[2] != x {
+		t.Errorf("expected variables Y, X, X, got %v", vars)
+	}
+
+	// terms are visited in pre-order and the walk stops descending when fn
+	// returns false
+	var visited []string
+	Walk(term, func(t Term) bool {
+		if c, ok := t.(*Compound); ok {
+			visited = append(visited, string(c.Functor()))
+			return c.Functor() != "h"
+		}
+		return true
+	})
+	if len(visited) != 2 || visited[0] != "f" || visited[1] != "h" {
+		t.Errorf("expected to visit f and h, got %v", visited)
+	}
+}
+
+func TestWalkPost(t *testing.T) {
+	term := NewCompound("f", NewCompound("g", Atom("a")), Atom("b"))
+	var visited []string
+	WalkPost(term, func(t Term) bool {
+		visited = append(visited, fmt.Sprint(t))
+		return true
+	})
+	exp := []string{"a", "g(a)", "b", "f(g(a), b)"}
+	if len(visited) != len(exp) {
+		t.Fatalf("expected %v got %v", exp, visited)
+	}
+	for i := range exp {
+		if visited[i] != exp[i] {
+			t.Errorf("expected %v got %v", exp, visited)
+			break
+		}
+	}
+
+	// the walk stops when fn returns false
+	n := 0
+	WalkPost(term, func(t Term) bool {
+		n++
+		return t != Atom("a")
+	})
+	if n != 1 {
+		t.Errorf("expected the walk to stop after 1 term, visited %d", n)
+	}
+
+	// cyclic terms are walked once
+	x := NewVariable("X")
+	x.Unify(NewCompound("f", x))
+	n = 0
+	WalkPost(x, func(t Term) bool {
+		n++
+		return true
+	})
+	if n != 3 {
+		t.Errorf("expected to visit X, f(X) and X, visited %d terms", n)
+	}
+}